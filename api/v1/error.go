@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
@@ -35,3 +36,203 @@ func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
 func (e ErrOffsetOutOfRange) Error() string {
 	return e.GRPCStatus().Err().Error()
 }
+
+// ErrCorruptRecord는 저장된 레코드의 체크섬이 맞지 않거나 레코드가 잘려 있어서 읽을 수 없을 때의 에러이다.
+type ErrCorruptRecord struct {
+	Offset uint64
+}
+
+func (e ErrCorruptRecord) GRPCStatus() *status.Status {
+	st := status.New(
+		codes.DataLoss,
+		fmt.Sprintf("corrupt record: %d", e.Offset),
+	)
+	msg := fmt.Sprintf(
+		"The record at offset %d failed its integrity check",
+		e.Offset,
+	)
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+	return std
+}
+
+func (e ErrCorruptRecord) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrTopicNotFound는 만들지 않은 토픽을 요청했을 때의 에러이다.
+type ErrTopicNotFound struct {
+	Topic string
+}
+
+func (e ErrTopicNotFound) GRPCStatus() *status.Status {
+	return status.New(
+		codes.NotFound,
+		fmt.Sprintf("topic not found: %s", e.Topic),
+	)
+}
+
+func (e ErrTopicNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrTopicExists는 이미 있는 토픽을 다시 만들려고 할 때의 에러이다.
+type ErrTopicExists struct {
+	Topic string
+}
+
+func (e ErrTopicExists) GRPCStatus() *status.Status {
+	return status.New(
+		codes.AlreadyExists,
+		fmt.Sprintf("topic already exists: %s", e.Topic),
+	)
+}
+
+func (e ErrTopicExists) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrInvalidTopic은 토픽의 이름이나 설정이 올바르지 않을 때의 에러이다.
+type ErrInvalidTopic struct {
+	Topic  string
+	Reason string
+}
+
+func (e ErrInvalidTopic) GRPCStatus() *status.Status {
+	return status.New(
+		codes.InvalidArgument,
+		fmt.Sprintf("invalid topic %q: %s", e.Topic, e.Reason),
+	)
+}
+
+func (e ErrInvalidTopic) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrPartitionNotFound는 로그의 파티션 수보다 큰 파티션을 요청했을 때의 에러이다.
+type ErrPartitionNotFound struct {
+	Partition uint32
+}
+
+func (e ErrPartitionNotFound) GRPCStatus() *status.Status {
+	return status.New(
+		codes.NotFound,
+		fmt.Sprintf("partition not found: %d", e.Partition),
+	)
+}
+
+func (e ErrPartitionNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrNoCommittedOffset는 컨슈머 그룹이 파티션의 오프셋을 커밋한 적이 없을 때의 에러이다.
+type ErrNoCommittedOffset struct {
+	Group     string
+	Topic     string
+	Partition uint32
+}
+
+func (e ErrNoCommittedOffset) GRPCStatus() *status.Status {
+	return status.New(
+		codes.NotFound,
+		fmt.Sprintf("no committed offset: group %q, topic %q, partition %d", e.Group, e.Topic, e.Partition),
+	)
+}
+
+func (e ErrNoCommittedOffset) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrUnknownMember는 컨슈머 그룹에 없는(떠났거나 세션이 만료된) 멤버의 요청일 때의 에러이다. 멤버는 그룹에 다시 참여해야 한다.
+type ErrUnknownMember struct {
+	Group    string
+	MemberID string
+}
+
+func (e ErrUnknownMember) GRPCStatus() *status.Status {
+	return status.New(
+		codes.NotFound,
+		fmt.Sprintf("unknown member %q in group %q", e.MemberID, e.Group),
+	)
+}
+
+func (e ErrUnknownMember) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrStaleGeneration은 리밸런스 전의 세대(generation)로 오프셋을 커밋하려고 할 때의 에러이다.
+// 그 사이에 파티션이 다른 멤버에게 할당되었을 수 있으므로 커밋을 거부한다.
+type ErrStaleGeneration struct {
+	Group      string
+	Generation uint64
+	Current    uint64
+}
+
+func (e ErrStaleGeneration) GRPCStatus() *status.Status {
+	return status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf("stale generation %d of group %q: current generation is %d", e.Generation, e.Group, e.Current),
+	)
+}
+
+func (e ErrStaleGeneration) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrInvalidGroupRequest는 그룹 참여 요청이 잘못되었을 때의 에러이다(알 수 없는 할당 전략, 그룹과 다른 전략 등).
+type ErrInvalidGroupRequest struct {
+	Group  string
+	Reason string
+}
+
+func (e ErrInvalidGroupRequest) GRPCStatus() *status.Status {
+	return status.New(
+		codes.InvalidArgument,
+		fmt.Sprintf("invalid request for group %q: %s", e.Group, e.Reason),
+	)
+}
+
+func (e ErrInvalidGroupRequest) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrOutOfOrderSequence는 멱등 프로듀서의 시퀀스가 건너뛰었거나 중복을 확인할 수 없을 만큼 오래되었을 때의 에러이다.
+type ErrOutOfOrderSequence struct {
+	ProducerID uint64
+	Sequence   uint64
+	Expected   uint64
+}
+
+func (e ErrOutOfOrderSequence) GRPCStatus() *status.Status {
+	return status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf("out of order sequence %d for producer %d: expected %d", e.Sequence, e.ProducerID, e.Expected),
+	)
+}
+
+func (e ErrOutOfOrderSequence) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrInvalidTxn은 트랜잭션의 상태로는 할 수 없는 요청의 에러이다(열리지 않은 트랜잭션에 생산, 이미 중단된 트랜잭션의 커밋 등).
+type ErrInvalidTxn struct {
+	TxnID  uint64
+	Reason string
+}
+
+func (e ErrInvalidTxn) GRPCStatus() *status.Status {
+	return status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf("invalid transaction %d: %s", e.TxnID, e.Reason),
+	)
+}
+
+func (e ErrInvalidTxn) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
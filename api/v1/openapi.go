@@ -0,0 +1,8 @@
+package log_v1
+
+import _ "embed"
+
+// OpenAPI는 log.proto의 HTTP 규칙으로 생성한 OpenAPI(Swagger 2.0) 문서이다. 서버가 /openapi.json으로 회신한다.
+//
+//go:embed log.swagger.json
+var OpenAPI []byte
@@ -0,0 +1,121 @@
+/*
+client 패키지는 proglog 서버의 Go 클라이언트이다. 생성된 api.LogClient를 직접 쓰는 대신 다음을 제공한다.
+
+  - Producer: 레코드를 버퍼에 모았다가 ProduceStream으로 비동기로 보낸다. 레코드마다 결과(Result)를 기다릴 수 있고,
+    서버에 연결할 수 없으면(Unavailable) 백오프하면서 다시 보낸다. Idempotent를 켜면 다시 보낸 레코드를 서버가 한 번만 추가한다.
+
+  - Consumer: ConsumeStream으로 레코드를 하나씩 읽는다. 연결이 끊기면 마지막으로 받은 레코드의 다음 오프셋부터 다시 연결한다.
+
+    c, err := client.Dial("127.0.0.1:8400", client.Config{
+    TLS: &client.TLSConfig{CertFile: cert, KeyFile: key, CAFile: ca},
+    })
+    p := c.NewProducer(client.ProducerConfig{Topic: "orders"})
+    res, err := p.Send(&api.Record{Value: []byte("hello")}).Wait(ctx) // res.Offset, res.Partition
+
+주소를 "proglog:///<서버 주소>"로 주면 클러스터의 서버 목록을 받아서 생산 요청은 리더에게, 소비 요청은 팔로워들에게 보낸다(loadbalance 패키지).
+*/
+package client
+
+import (
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/config"
+	_ "github.com/sodami-hub/proglog/internal/loadbalance"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// TLSConfig는 서버와의 TLS 상호 인증 설정이다. 서버와 같은 config.TLSConfig를 사용한다.
+// 클라이언트 인증서(CertFile, KeyFile)의 주체가 서버의 ACL에서 권한을 확인하는 ID이다.
+type TLSConfig = config.TLSConfig
+
+type Config struct {
+	// TLS가 nil이면 암호화하지 않고 연결한다.
+	TLS *TLSConfig
+	// DialOptions는 연결에 추가할 gRPC 옵션이다.
+	DialOptions []grpc.DialOption
+}
+
+// Client는 서버와의 연결이다. 하나의 Client로 여러 Producer와 Consumer를 만들 수 있다.
+type Client struct {
+	conn *grpc.ClientConn
+	log  api.LogClient
+}
+
+// Dial 함수는 addr의 서버에 연결하는 Client를 만든다. gRPC는 첫 번째 요청을 보낼 때 실제로 연결한다.
+func Dial(addr string, c Config) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if c.TLS != nil {
+		tlsConfig, err := config.SetupTLSConfig(*c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, c.DialOptions...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn: conn,
+		log:  api.NewLogClient(conn),
+	}, nil
+}
+
+// Log 메서드는 Producer와 Consumer가 제공하지 않는 요청(토픽 관리, 컨슈머 그룹 등)을 위한 api.LogClient를 리턴한다.
+func (c *Client) Log() api.LogClient {
+	return c.log
+}
+
+// Close 메서드는 연결을 닫는다. 먼저 Producer와 Consumer들을 닫아야 한다.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Backoff는 서버에 연결할 수 없을 때 다시 시도하는 간격이다. 시도할 때마다 간격을 두 배로 늘린다.
+type Backoff struct {
+	Initial time.Duration // 첫 번째 재시도까지의 간격. 0이면 100밀리초이다.
+	Max     time.Duration // 가장 긴 간격. 0이면 5초이다.
+	// Retries는 연속으로 실패했을 때 다시 시도하는 최대 횟수이다. 0이면 10번이고, 음수면 제한하지 않는다.
+	Retries int
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial == 0 {
+		b.Initial = 100 * time.Millisecond
+	}
+	if b.Max == 0 {
+		b.Max = 5 * time.Second
+	}
+	if b.Retries == 0 {
+		b.Retries = 10
+	}
+	return b
+}
+
+// delay 메서드는 attempt번째(1부터) 재시도 전에 기다릴 시간을 리턴한다.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// exhausted 메서드는 연속으로 failures번 실패했다면 더 시도하지 않아야 하는지를 리턴한다.
+func (b Backoff) exhausted(failures int) bool {
+	return b.Retries > 0 && failures > b.Retries
+}
+
+// retryable 함수는 다시 보내면 성공할 수 있는 에러인지를 리턴한다. 서버에 연결할 수 없거나 서버가 멈추는 중일 때이다.
+func retryable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
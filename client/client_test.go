@@ -0,0 +1,323 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/config"
+	"github.com/sodami-hub/proglog/internal/log"
+	"github.com/sodami-hub/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestClient(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, s *testServer){
+		"produce and consume in order":              testProduceConsume,
+		"a rejected record fails only its result":   testRejectedRecord,
+		"unauthorized records fail":                 testUnauthorized,
+		"closed producer rejects records":           testClosedProducer,
+		"producer retries while the server is down": testProducerRetry,
+		"idempotent producer appends retries once":  testIdempotentProducer,
+		"consumer reconnects from the next offset":  testConsumerReconnect,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			s := newTestServer(t)
+			defer s.teardown()
+			fn(t, s)
+		})
+	}
+}
+
+// testServer는 다시 시작할 수 있는 서버이다. 다시 시작해도 같은 주소와 같은 로그를 사용한다.
+type testServer struct {
+	t      *testing.T
+	addr   string
+	dir    string
+	clog   *log.Log
+	server *grpc.Server
+	// dropResponse가 true이면 서버는 다음 생산 요청의 레코드를 추가한 후 응답을 보내지 않고 스트림을 Unavailable로 끝낸다.
+	dropResponse atomic.Bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "client-test")
+	require.NoError(t, err)
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	s := &testServer{t: t, addr: "127.0.0.1:0", dir: dir, clog: clog}
+	s.start()
+	return s
+}
+
+func (s *testServer) start() {
+	s.t.Helper()
+	l, err := net.Listen("tcp", s.addr)
+	require.NoError(s.t, err)
+	s.addr = l.Addr().String()
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: s.addr,
+		Server:        true,
+	})
+	require.NoError(s.t, err)
+	s.server, err = server.NewGRPCServer(&server.Config{
+		CommitLog:  s.clog,
+		Authorizer: auth.New(config.ACLModelFile, config.ACLPolicyFile),
+	}, grpc.Creds(credentials.NewTLS(serverTLSConfig)), grpc.ChainStreamInterceptor(s.lossyStream))
+	require.NoError(s.t, err)
+	go func() {
+		s.server.Serve(l)
+	}()
+}
+
+func (s *testServer) lossyStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &lossyServerStream{ServerStream: ss, s: s})
+}
+
+type lossyServerStream struct {
+	grpc.ServerStream
+	s *testServer
+}
+
+func (ss *lossyServerStream) SendMsg(m any) error {
+	if _, ok := m.(*api.ProduceResponse); ok && ss.s.dropResponse.CompareAndSwap(true, false) {
+		return status.Error(codes.Unavailable, "response lost")
+	}
+	return ss.ServerStream.SendMsg(m)
+}
+
+func (s *testServer) stop() {
+	s.server.Stop()
+}
+
+func (s *testServer) teardown() {
+	s.stop()
+	s.clog.Close()
+	os.RemoveAll(s.dir)
+}
+
+// dial 메서드는 인증서로 서버에 연결하는 Client를 만든다.
+func (s *testServer) dial(certFile, keyFile string) *Client {
+	s.t.Helper()
+	c, err := Dial(s.addr, Config{
+		TLS: &TLSConfig{
+			CertFile: certFile,
+			KeyFile:  keyFile,
+			CAFile:   config.CAFile,
+		},
+	})
+	require.NoError(s.t, err)
+	s.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func (s *testServer) root() *Client {
+	return s.dial(config.RootClientCertFile, config.RootClientKeyFile)
+}
+
+// testBackoff는 테스트가 빨리 끝나도록 짧게 기다린다.
+var testBackoff = Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Retries: -1}
+
+func wait(t *testing.T, r *Result) *api.ProduceResponse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := r.Wait(ctx)
+	require.NoError(t, err)
+	return res
+}
+
+func testProduceConsume(t *testing.T, s *testServer) {
+	c := s.root()
+	p := c.NewProducer(ProducerConfig{BatchSize: 3, Linger: 10 * time.Millisecond, MaxInFlight: 2})
+	var results []*Result
+	for i := 0; i < 10; i++ {
+		results = append(results, p.Send(&api.Record{Value: []byte{byte(i)}}))
+	}
+	// 배치가 차지 않은 마지막 레코드는 Linger가 지나면 보낸다.
+	for i, r := range results {
+		require.Equal(t, uint64(i), wait(t, r).Offset)
+	}
+	require.NoError(t, p.Close())
+
+	cons := c.NewConsumer(ConsumerConfig{Offset: 4})
+	defer cons.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := uint64(4)
+	for record, err := range cons.Records(ctx) {
+		require.NoError(t, err)
+		require.Equal(t, want, record.Offset)
+		require.Equal(t, []byte{byte(want)}, record.Value)
+		if want++; want == 10 {
+			break
+		}
+	}
+
+	// 끝까지 읽었다면 다음 레코드를 기다린다.
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	_, err := cons.Next(short)
+	require.Equal(t, context.DeadlineExceeded, err)
+	_, err = s.clog.Append(&api.Record{Value: []byte("next")})
+	require.NoError(t, err)
+	record, err := cons.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), record.Offset)
+
+	require.NoError(t, cons.Close())
+	_, err = cons.Next(ctx)
+	require.Equal(t, ErrConsumerClosed, err)
+}
+
+func testRejectedRecord(t *testing.T, s *testServer) {
+	p := s.root().NewProducer(ProducerConfig{BatchSize: 3, Linger: time.Second})
+	defer p.Close()
+	ok1 := p.Send(&api.Record{Value: []byte("first")})
+	// 제어 마커는 서버만 쓸 수 있으므로 서버가 거부하고 스트림을 끝낸다.
+	bad := p.Send(&api.Record{Control: api.ControlType_CONTROL_COMMIT, TxnId: 1})
+	ok2 := p.Send(&api.Record{Value: []byte("second")})
+
+	require.Equal(t, uint64(0), wait(t, ok1).Offset)
+	_, err := bad.Wait(context.Background())
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	// 나머지 레코드는 새 스트림으로 다시 보낸다.
+	require.Equal(t, uint64(1), wait(t, ok2).Offset)
+}
+
+func testUnauthorized(t *testing.T, s *testServer) {
+	c := s.dial(config.NobodyClientCertFile, config.NobodyClientKeyFile)
+	p := c.NewProducer(ProducerConfig{})
+	r := p.Send(&api.Record{Value: []byte("hello")})
+	require.NoError(t, p.Close())
+	_, err := r.Wait(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	cons := c.NewConsumer(ConsumerConfig{})
+	defer cons.Close()
+	_, err = cons.Next(context.Background())
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func testClosedProducer(t *testing.T, s *testServer) {
+	p := s.root().NewProducer(ProducerConfig{Linger: time.Hour})
+	r := p.Send(&api.Record{Value: []byte("hello")})
+	// Close는 Linger를 기다리지 않고 남은 레코드를 보낸다.
+	require.NoError(t, p.Close())
+	select {
+	case <-r.Done():
+	default:
+		t.Fatal("Close returned before the record was sent")
+	}
+	require.Equal(t, uint64(0), wait(t, r).Offset)
+
+	_, err := p.Send(&api.Record{Value: []byte("hello")}).Wait(context.Background())
+	require.Equal(t, ErrProducerClosed, err)
+	require.NoError(t, p.Close())
+}
+
+func testProducerRetry(t *testing.T, s *testServer) {
+	p := s.root().NewProducer(ProducerConfig{Backoff: testBackoff})
+	defer p.Close()
+	require.Equal(t, uint64(0), wait(t, p.Send(&api.Record{Value: []byte("before")})).Offset)
+
+	s.stop()
+	r := p.Send(&api.Record{Value: []byte("during")})
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-r.Done():
+		t.Fatal("record completed while the server was down")
+	default:
+	}
+	s.start()
+	require.Equal(t, uint64(1), wait(t, r).Offset)
+
+	// 재시도 횟수를 넘으면 에러로 실패한다.
+	s.stop()
+	q := s.root().NewProducer(ProducerConfig{Backoff: Backoff{Initial: time.Millisecond, Retries: 2}})
+	defer q.Close()
+	_, err := q.Send(&api.Record{Value: []byte("lost")}).Wait(context.Background())
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func testIdempotentProducer(t *testing.T, s *testServer) {
+	p := s.root().NewProducer(ProducerConfig{Idempotent: true, Backoff: testBackoff})
+	defer p.Close()
+	require.Equal(t, uint64(0), wait(t, p.Send(&api.Record{Value: []byte("first")})).Offset)
+
+	// 서버가 레코드를 추가한 후 응답을 잃어버렸다. 같은 시퀀스로 다시 보낸 레코드는 다시 추가하지 않고 처음 추가한 오프셋을 회신한다.
+	s.dropResponse.Store(true)
+	require.Equal(t, uint64(1), wait(t, p.Send(&api.Record{Value: []byte("second")})).Offset)
+	require.Equal(t, uint64(2), wait(t, p.Send(&api.Record{Value: []byte("third")})).Offset)
+	for i, value := range []string{"first", "second", "third"} {
+		record, err := s.clog.Read(uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, []byte(value), record.Value)
+		require.NotZero(t, record.ProducerId)
+		require.Equal(t, uint64(i+1), record.Sequence)
+	}
+
+	// 서버가 거부한 레코드의 시퀀스는 추가되지 않았으므로, 뒤의 레코드는 새 프로듀서 ID로 보낸다.
+	bad := p.Send(&api.Record{Control: api.ControlType_CONTROL_COMMIT, TxnId: 1})
+	next := p.Send(&api.Record{Value: []byte("after rejected")})
+	_, err := bad.Wait(context.Background())
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, uint64(3), wait(t, next).Offset)
+
+	// 키가 있는 레코드는 클라이언트가 파티션을 알 수 없으므로 시퀀스 없이 보낸다.
+	res := wait(t, p.Send(&api.Record{Key: []byte("k"), Value: []byte("keyed")}))
+	record, err := s.clog.Read(res.Offset)
+	require.NoError(t, err)
+	require.Zero(t, record.ProducerId)
+}
+
+func testConsumerReconnect(t *testing.T, s *testServer) {
+	for i := 0; i < 3; i++ {
+		_, err := s.clog.Append(&api.Record{Value: []byte{byte(i)}})
+		require.NoError(t, err)
+	}
+	cons := s.root().NewConsumer(ConsumerConfig{Backoff: testBackoff})
+	defer cons.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		record, err := cons.Next(ctx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), record.Offset)
+	}
+
+	// 서버가 멈춘 동안 추가한 레코드를, 서버가 다시 시작하면 마지막으로 받은 레코드의 다음부터 이어서 읽는다.
+	s.stop()
+	type result struct {
+		record *api.Record
+		err    error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		record, err := cons.Next(ctx)
+		resc <- result{record, err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err := s.clog.Append(&api.Record{Value: []byte{3}})
+	require.NoError(t, err)
+	s.start()
+
+	res := <-resc
+	require.NoError(t, res.err)
+	require.Equal(t, uint64(3), res.record.Offset)
+	require.Equal(t, []byte{3}, res.record.Value)
+}
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrConsumerClosed는 닫은 Consumer로 레코드를 읽었을 때의 에러이다.
+var ErrConsumerClosed = errors.New("client: consumer is closed")
+
+type ConsumerConfig struct {
+	// Topic과 Partition은 읽을 토픽의 파티션이다. 모든 파티션을 읽으려면 파티션마다 Consumer를 만든다.
+	Topic     string
+	Partition uint32
+	// Offset은 처음 읽을 오프셋이다. StartTime을 지정했다면 그 시각 이후의 첫 레코드부터 읽는다.
+	Offset    uint64
+	StartTime time.Time
+	// Group을 지정했다면 그룹이 커밋한 오프셋부터 읽는다. 커밋한 오프셋이 없다면 Offset이나 StartTime부터이다.
+	Group          string
+	IsolationLevel api.IsolationLevel
+	Backoff        Backoff
+}
+
+/*
+Consumer는 ConsumeStream으로 파티션의 레코드를 차례대로 읽는다.
+받은 레코드의 다음 오프셋을 기억하고 있다가, 스트림이 끊기면(Unavailable, 또는 서버가 멈추면서 스트림을 끝내면) Backoff만큼 기다렸다가 그 오프셋부터 다시 연결한다.
+그래서 서버가 다시 시작하거나 클러스터의 다른 서버로 옮겨가더라도 레코드를 빠뜨리거나 두 번 받지 않는다.
+Group, StartTime은 처음 시작할 오프셋을 정할 때만 쓰고, 레코드를 하나라도 받은 후에는 기억한 오프셋부터 읽는다.
+*/
+type Consumer struct {
+	client api.LogClient
+	config ConsumerConfig
+
+	// mu는 Next를 한 번에 하나만 실행하게 한다. Close는 mu를 잡기 전에 ctx를 취소해서 기다리던 Next를 깨운다.
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stream    api.Log_ConsumeStreamClient
+	cancelRPC context.CancelFunc
+	// next는 다음에 읽을 오프셋이다. started가 false라면 아직 받은 레코드가 없으므로 config로 시작 오프셋을 정한다.
+	next    uint64
+	started bool
+}
+
+// NewConsumer 메서드는 Consumer를 만든다. 서버에는 처음 Next를 호출할 때 연결한다. 다 쓴 Consumer는 Close해야 한다.
+func (c *Client) NewConsumer(config ConsumerConfig) *Consumer {
+	config.Backoff = config.Backoff.withDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{
+		client: c.log,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		next:   config.Offset,
+	}
+}
+
+// Next 메서드는 다음 레코드를 리턴한다. 파티션의 끝까지 읽었다면 레코드가 추가될 때까지 기다린다.
+// 다시 연결할 수 없는 에러이거나 연속으로 Backoff.Retries번을 넘게 연결하지 못했다면 에러를 리턴하고, 다시 호출하면 같은 오프셋부터 다시 시도한다.
+func (c *Consumer) Next(ctx context.Context) (*api.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := 0
+	for {
+		if c.ctx.Err() != nil {
+			return nil, ErrConsumerClosed
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var err error
+		if c.stream == nil {
+			err = c.connect()
+		}
+		if err == nil {
+			var res *api.ConsumeResponse
+			if res, err = c.recv(ctx); err == nil {
+				c.next, c.started = res.Record.Offset+1, true
+				return res.Record, nil
+			}
+		}
+		if c.ctx.Err() != nil {
+			return nil, ErrConsumerClosed
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.disconnect()
+		if err != io.EOF && !retryable(err) {
+			return nil, err
+		}
+		failures++
+		if c.config.Backoff.exhausted(failures) {
+			return nil, err
+		}
+		select {
+		case <-time.After(c.config.Backoff.delay(failures)):
+		case <-ctx.Done():
+		case <-c.ctx.Done():
+		}
+	}
+}
+
+// recv 메서드는 스트림에서 응답을 하나 받는다. ctx가 먼저 끝나면 에러를 리턴하고, 받던 응답은 다음 호출이 받는다.
+func (c *Consumer) recv(ctx context.Context) (*api.ConsumeResponse, error) {
+	if ctx.Done() == nil {
+		return c.stream.Recv()
+	}
+	type result struct {
+		res *api.ConsumeResponse
+		err error
+	}
+	stream := c.stream
+	resc := make(chan result, 1)
+	go func() {
+		res, err := stream.Recv()
+		resc <- result{res, err}
+	}()
+	select {
+	case r := <-resc:
+		return r.res, r.err
+	case <-ctx.Done():
+		// 받던 응답을 버릴 수 없으므로 스트림을 닫고, 다음 Next가 기억한 오프셋부터 다시 연결한다.
+		c.disconnect()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Consumer) connect() error {
+	req := &api.ConsumeRequest{
+		Topic:          c.config.Topic,
+		Partition:      c.config.Partition,
+		Offset:         c.next,
+		IsolationLevel: c.config.IsolationLevel,
+	}
+	if !c.started {
+		req.Group = c.config.Group
+		if !c.config.StartTime.IsZero() {
+			req.StartTime = timestamppb.New(c.config.StartTime)
+		}
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	stream, err := c.client.ConsumeStream(ctx, req)
+	if err != nil {
+		cancel()
+		return err
+	}
+	c.stream, c.cancelRPC = stream, cancel
+	return nil
+}
+
+func (c *Consumer) disconnect() {
+	if c.stream == nil {
+		return
+	}
+	c.cancelRPC()
+	c.stream, c.cancelRPC = nil, nil
+}
+
+/*
+Records 메서드는 레코드들을 차례대로 돌려주는 이터레이터를 리턴한다. Next가 에러를 리턴하면 에러와 함께 한 번 돌려주고 끝난다.
+
+	for record, err := range consumer.Records(ctx) {
+		if err != nil {
+			...
+		}
+	}
+*/
+func (c *Consumer) Records(ctx context.Context) iter.Seq2[*api.Record, error] {
+	return func(yield func(*api.Record, error) bool) {
+		for {
+			record, err := c.Next(ctx)
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close 메서드는 스트림을 닫는다. 기다리던 Next는 ErrConsumerClosed를 리턴한다.
+func (c *Consumer) Close() error {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disconnect()
+	return nil
+}
@@ -0,0 +1,338 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+// ErrProducerClosed는 닫은 Producer로 레코드를 보냈을 때의 에러이다.
+var ErrProducerClosed = errors.New("client: producer is closed")
+
+type ProducerConfig struct {
+	// Topic은 레코드를 추가할 토픽이다. 비어있다면 서버의 기본 로그이다.
+	Topic string
+	// BatchSize만큼 레코드가 모이면 Linger를 기다리지 않고 보낸다. 0이면 100개이다.
+	BatchSize int
+	// Linger는 첫 번째 레코드가 들어온 후 배치가 차기를 기다리는 최대 시간이다. 0이면 기다리지 않고 바로 보낸다.
+	Linger time.Duration
+	// MaxInFlight는 응답을 받지 못한 채로 보낼 수 있는 레코드의 최대 수이다. 0이면 1000개이다.
+	MaxInFlight int
+	// BufferSize는 Send가 기다리지 않고 넘길 수 있는 레코드의 수이다. 버퍼가 차면 Send는 자리가 날 때까지 기다린다. 0이면 1000개이다.
+	BufferSize int
+	Backoff    Backoff
+	/*
+		Idempotent가 true이면 Producer는 서버에서 프로듀서 ID를 받고(InitProducer) 레코드마다 시퀀스를 붙여서 보낸다.
+		다시 보낸 레코드는 서버가 중복을 걸러내므로 한 번만 추가된다. 서버는 프로듀서마다 최근 maxIdempotentInFlight개의 시퀀스만 기억하므로
+		MaxInFlight는 그 이하로 줄인다.
+
+		시퀀스는 (프로듀서, 파티션)마다 매기는데, 키가 있는 레코드의 파티션은 서버가 키의 해시로 정하므로 클라이언트가 알 수 없다.
+		그래서 키가 있는 레코드는 시퀀스 없이 보내고, 이전처럼 최소 한 번 추가된다. 키가 없는 레코드는 모두 프로듀서 ID로 정한 한 파티션에 추가된다.
+	*/
+	Idempotent bool
+}
+
+// maxIdempotentInFlight는 멱등 Producer가 응답을 받지 못한 채로 보낼 수 있는 레코드의 최대 수이다. 서버의 중복 제거 테이블이
+// 프로듀서마다 기억하는 최근 구간의 수와 같다. 다른 프로듀서의 레코드가 사이에 끼면 레코드마다 한 구간이 되므로, 더 많이 보냈다가
+// 다시 보내면 서버는 오래된 시퀀스를 중복으로 알아보지 못한다.
+const maxIdempotentInFlight = 8
+
+/*
+Producer는 레코드를 비동기로 보낸다. Send는 레코드를 버퍼에 넣고 바로 리턴하며, 레코드의 결과는 리턴한 Result로 기다린다.
+
+레코드는 ProduceStream 하나로 보낸다. 서버는 스트림의 요청을 받은 순서대로 처리해서 응답하므로, Producer는 보낸 레코드들을 큐(inflight)에 넣어두고
+응답을 받을 때마다 큐의 맨 앞 레코드의 결과를 정한다.
+  - 스트림이 Unavailable(또는 io.EOF)로 끊기면 서버에 연결할 수 없는 것이므로 응답을 받지 못한 레코드들을 다시 보낼 레코드의 앞에 돌려놓고
+    Backoff만큼 기다렸다가 새 스트림으로 다시 보낸다. 연속으로 Backoff.Retries번을 넘게 실패하면 보내지 못한 레코드들이 그 에러로 실패한다.
+  - 그 밖의 에러라면 서버가 맨 앞 레코드를 거부하고 스트림을 끝낸 것이다. 그 레코드만 실패하고 나머지는 새 스트림으로 다시 보낸다.
+
+끊긴 스트림에서 서버가 추가했지만 응답이 오지 않은 레코드는 다시 보내면 한 번 더 추가된다. 즉 Producer는 레코드를 최소 한 번(at-least-once) 추가한다.
+ProducerConfig.Idempotent를 켜면 다시 보낸 레코드도 같은 시퀀스를 가지므로, 서버는 추가하지 않고 처음 추가한 오프셋을 회신한다.
+레코드가 실패하면(서버가 거부했거나 재시도 횟수를 넘었다면) 그 시퀀스가 추가되었는지 알 수 없으므로 새 프로듀서 ID를 받아서 시퀀스를 다시 시작한다.
+Producer의 상태는 run 메서드를 실행하는 고루틴 하나만 다루고, 다른 고루틴(Send, 스트림의 응답을 받는 고루틴)과는 채널로 주고받는다.
+*/
+type Producer struct {
+	client api.LogClient
+	config ProducerConfig
+
+	// mu는 Close한 후에 records 채널에 보내지 않도록 Send와 Close를 동기화한다.
+	mu      sync.RWMutex
+	closed  bool
+	records chan *Result
+	acks    chan ack
+	done    chan struct{}
+}
+
+// Result는 Send로 보낸 레코드의 결과이다.
+type Result struct {
+	record *api.Record
+	done   chan struct{}
+	res    *api.ProduceResponse
+	err    error
+
+	// producerID와 sequence는 처음 보낼 때 붙인 멱등 생산의 프로듀서 ID와 시퀀스이다. 다시 보낼 때도 같은 값을 쓴다.
+	producerID uint64
+	sequence   uint64
+}
+
+// Done 메서드는 결과가 정해지면 닫히는 채널을 리턴한다.
+func (r *Result) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait 메서드는 레코드를 추가할 때까지 기다리고 레코드의 오프셋과 파티션을 리턴한다.
+func (r *Result) Wait(ctx context.Context) (*api.ProduceResponse, error) {
+	select {
+	case <-r.done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Result) complete(res *api.ProduceResponse, err error) {
+	r.res, r.err = res, err
+	close(r.done)
+}
+
+// NewProducer 메서드는 Producer를 만들고 레코드를 보내는 고루틴을 시작한다. 다 쓴 Producer는 Close해야 한다.
+func (c *Client) NewProducer(config ProducerConfig) *Producer {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 1000
+	}
+	if config.Idempotent && config.MaxInFlight > maxIdempotentInFlight {
+		config.MaxInFlight = maxIdempotentInFlight
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 1000
+	}
+	config.Backoff = config.Backoff.withDefaults()
+	p := &Producer{
+		client:  c.log,
+		config:  config,
+		records: make(chan *Result, config.BufferSize),
+		acks:    make(chan ack),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Send 메서드는 레코드를 보낼 버퍼에 넣는다. 버퍼가 차있다면 자리가 날 때까지 기다린다.
+// Producer가 레코드를 보내는 동안 record를 사용하므로 결과가 정해지기 전에 record를 고치면 안 된다.
+func (p *Producer) Send(record *api.Record) *Result {
+	r := &Result{record: record, done: make(chan struct{})}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		r.complete(nil, ErrProducerClosed)
+		return r
+	}
+	p.records <- r
+	return r
+}
+
+// Close 메서드는 버퍼와 배치에 남은 레코드들을 모두 보내고, 모든 결과가 정해질 때까지 기다린다.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.records)
+	}
+	p.mu.Unlock()
+	<-p.done
+	return nil
+}
+
+// produceStream은 Producer가 연 ProduceStream이다. 응답을 받는 고루틴은 ctx가 취소되면 끝난다.
+type produceStream struct {
+	stream api.Log_ProduceStreamClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	// broken은 Send가 실패한 스트림이다. 더 보내지 않고 응답을 받는 고루틴이 에러를 알려주기를 기다린다.
+	broken bool
+}
+
+// ack는 스트림에서 받은 응답이나 에러이다. 이미 버린 스트림의 것은 무시한다.
+type ack struct {
+	stream *produceStream
+	res    *api.ProduceResponse
+	err    error
+}
+
+func (p *Producer) run() {
+	defer close(p.done)
+
+	var (
+		// pending은 아직 보내지 않은 레코드들이다. 앞의 flushing개는 보낼 차례가 된 레코드들이다.
+		pending  []*Result
+		flushing int
+		inflight []*Result
+		stream   *produceStream
+		failures int
+		lingerC  <-chan time.Time
+		retryC   <-chan time.Time
+		input    = p.records
+		// producerID와 sequence는 멱등 생산의 프로듀서 ID와 마지막으로 붙인 시퀀스이다. producerID가 0이면 새로 받아야 한다.
+		producerID uint64
+		sequence   uint64
+	)
+	defer func() {
+		if stream != nil {
+			stream.cancel()
+		}
+	}()
+
+	for {
+		// 연결할 수 있고 보낼 레코드가 있으면 스트림을 연다.
+		if stream == nil && retryC == nil && flushing > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			var s api.Log_ProduceStreamClient
+			var err error
+			if p.config.Idempotent && producerID == 0 {
+				var res *api.InitProducerResponse
+				if res, err = p.client.InitProducer(ctx, &api.InitProducerRequest{}); err == nil {
+					producerID, sequence = res.ProducerId, 0
+				}
+			}
+			if err == nil {
+				s, err = p.client.ProduceStream(ctx)
+			}
+			if err != nil {
+				cancel()
+				failures++
+				if !retryable(err) || p.config.Backoff.exhausted(failures) {
+					fail(pending[:flushing], err)
+					pending, flushing, failures = pending[flushing:], 0, 0
+				} else {
+					retryC = time.After(p.config.Backoff.delay(failures))
+				}
+				continue
+			}
+			stream = &produceStream{stream: s, ctx: ctx, cancel: cancel}
+			go p.receive(stream)
+		}
+		// 보낼 차례인 레코드들을 in-flight 한도까지 보낸다.
+		for stream != nil && !stream.broken && flushing > 0 && len(inflight) < p.config.MaxInFlight {
+			r := pending[0]
+			pending, flushing = pending[1:], flushing-1
+			inflight = append(inflight, r)
+			if r.producerID == 0 && producerID != 0 && len(r.record.Key) == 0 {
+				sequence++
+				r.producerID, r.sequence = producerID, sequence
+			}
+			if err := stream.stream.Send(&api.ProduceRequest{
+				Record:     r.record,
+				Topic:      p.config.Topic,
+				ProducerId: r.producerID,
+				Sequence:   r.sequence,
+			}); err != nil {
+				// 스트림이 끊겼다. 실제 에러는 응답을 받는 고루틴이 알려준다.
+				stream.broken = true
+			}
+		}
+		if input == nil && len(pending) == 0 && len(inflight) == 0 {
+			if stream != nil {
+				_ = stream.stream.CloseSend()
+			}
+			return
+		}
+
+		// 배치가 차있다면 배치가 빠져나갈 때까지 새 레코드를 받지 않는다. 기다리는 레코드들은 records 채널에 쌓인다.
+		recv := input
+		if len(pending)-flushing >= p.config.BatchSize {
+			recv = nil
+		}
+		select {
+		case r, ok := <-recv:
+			if !ok {
+				// Close했다. 남은 레코드들은 Linger를 기다리지 않고 보낸다.
+				input, lingerC = nil, nil
+				flushing = len(pending)
+				continue
+			}
+			pending = append(pending, r)
+			switch {
+			case p.config.Linger <= 0 || len(pending)-flushing >= p.config.BatchSize:
+				flushing, lingerC = len(pending), nil
+			case len(pending)-flushing == 1:
+				lingerC = time.After(p.config.Linger)
+			}
+		case <-lingerC:
+			flushing, lingerC = len(pending), nil
+		case <-retryC:
+			retryC = nil
+		case a := <-p.acks:
+			if a.stream != stream {
+				continue
+			}
+			if a.err == nil {
+				if len(inflight) == 0 {
+					continue
+				}
+				inflight[0].complete(a.res, nil)
+				inflight = inflight[1:]
+				failures = 0
+				continue
+			}
+			// 스트림이 끊겼다. 응답을 받지 못한 레코드들을 보낼 레코드들의 맨 앞에 돌려놓는다.
+			stream.cancel()
+			stream = nil
+			if a.err == io.EOF || retryable(a.err) {
+				failures++
+				if p.config.Backoff.exhausted(failures) {
+					fail(inflight, a.err)
+					fail(pending[:flushing], a.err)
+					pending, inflight, flushing, failures = pending[flushing:], nil, 0, 0
+					producerID = 0
+					continue
+				}
+				retryC = time.After(p.config.Backoff.delay(failures))
+			} else if len(inflight) > 0 {
+				// 서버가 맨 앞 레코드를 거부했다. 뒤의 레코드들은 처리하지 않았으므로 새 프로듀서 ID로 시퀀스를 다시 붙인다.
+				inflight[0].complete(nil, a.err)
+				inflight = inflight[1:]
+				producerID = 0
+				for _, r := range inflight {
+					r.producerID, r.sequence = 0, 0
+				}
+			} else {
+				// 레코드를 보내기 전에 거부했다면 다시 연결해도 마찬가지이다.
+				fail(pending[:flushing], a.err)
+				pending, flushing = pending[flushing:], 0
+			}
+			pending = append(inflight, pending...)
+			flushing += len(inflight)
+			inflight = nil
+		}
+	}
+}
+
+// fail 함수는 results의 결과를 모두 err로 정한다.
+func fail(results []*Result, err error) {
+	for _, r := range results {
+		r.complete(nil, err)
+	}
+}
+
+// receive 메서드는 스트림의 응답들을 run 메서드에 넘긴다. 에러를 받으면 끝난다.
+func (p *Producer) receive(s *produceStream) {
+	for {
+		res, err := s.stream.Recv()
+		select {
+		case p.acks <- ack{stream: s, res: res, err: err}:
+		case <-s.ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -1,27 +1,283 @@
 /*
-/handleProduce 요청의 Body에 일반적인 문자열을 value에 넣으면 아래와 같은 메시지가 응답된다.
-illegal base64 data at input byte 0
+proglog 서버를 실행한다. 세그먼트 로그(internal/log)를 데이터 디렉터리에 열고, TLS 상호 인증과 ACL 권한 확인을 하는 gRPC 서버로 서비스한다.
 
-Go의 encoding/json 패키지는 []byte를 base64-encoding string으로 인코딩한다. 그래서 value 값으로
-base64로 인코딩된 값을 넣어야 된다.
+인증서와 ACL 파일의 기본 경로는 config 패키지와 같다($CONFIG_DIR 또는 $HOME/.proglog). make gencert로 인증서를 만들 수 있다.
 
-$ curl -X POST localhost:8080 -d '{"record" : {"value":"TGV0J3MgR28gIzEk"}}'
-{"offset":0}
-$ curl -X GET localhost:8080 -d '{"offset":0}'
-{"record":{"value":"TGV0J3MgR28gIzEk","offset":0}}
+	$ go run ./cmd/server -addr :8400 -data-dir /var/lib/proglog
+
+SIGINT나 SIGTERM을 받으면 새 연결을 받지 않고, 처리 중인 요청과 스트림이 끝나기를 기다린 후(GracefulStop) 로그를 닫는다.
+레코드를 기다리던 ConsumeStream은 로그의 끝까지 보낸 후에 끝난다. -shutdown-timeout 동안 끝나지 않으면 연결을 강제로 끊는다.
+
+-peers로 다른 서버들을 정하면 각 서버의 로그를 가져와서(pull) 로컬 로그에 복제한다(log.Replicator). 피어에는 -peer-tls-* 클라이언트 인증서로
+연결하므로 이 인증서의 주체는 피어의 ACL에서 소비 권한이 있어야 한다(-peers가 없으면 이 인증서는 읽지 않는다). 각 서버는 피어가 직접 받은 레코드만 복제하므로
+모든 레코드를 모든 서버에 복제하려면 서버들이 서로를 모두 피어로 정해야 한다.
+
+	$ go run ./cmd/server -addr :8400 -data-dir /tmp/proglog-0 -peers 1=127.0.0.1:8401
+	$ go run ./cmd/server -addr :8401 -data-dir /tmp/proglog-1 -peers 0=127.0.0.1:8400
+
+토픽은 -topics-dir(기본값은 <data-dir>/topics) 아래에 토픽마다 독립된 로그로 저장한다. topic이 비어있는 요청은 -data-dir의 기본 로그를 사용한다.
+컨슈머 그룹이 커밋한 오프셋은 -offsets-dir(기본값은 <data-dir>/offsets)의 내부 로그에 저장한다(log.OffsetStore).
+그룹의 멤버십과 파티션 할당(group.Coordinator)은 메모리에만 있으므로 서버를 다시 시작하면 멤버들이 다시 참여한다.
+트랜잭션은 로그에 마커로 기록하므로 서버를 다시 시작해도 이어서 끝낼 수 있고, -txn-timeout 동안 끝나지 않은 트랜잭션은 중단한다.
+
+같은 포트(-addr)로 JSON/HTTP API도 서비스한다(server.NewMux). 연결의 첫 요청으로 gRPC와 HTTP를 나누며, 둘 다 같은 서버 인증서로
+TLS 상호 인증을 하고 같은 ACL을 적용한다. API의 OpenAPI 문서는 /openapi.json이다.
+
+	$ curl --cert client.pem --key client-key.pem --cacert ca.pem https://127.0.0.1:8400/v1/records/0
 */
 
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	stdlog "log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/config"
+	"github.com/sodami-hub/proglog/internal/group"
+	"github.com/sodami-hub/proglog/internal/log"
 	"github.com/sodami-hub/proglog/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+type cfg struct {
+	Addr            string
+	DataDir         string
+	TopicsDir       string
+	OffsetsDir      string
+	CertFile        string
+	KeyFile         string
+	CAFile          string
+	ACLModelFile    string
+	ACLPolicyFile   string
+	MaxConsumeWait  time.Duration
+	ShutdownTimeout time.Duration
+	Log             log.Config
+	// Peers는 복제할 서버들의 이름과 gRPC 주소이다.
+	Peers        map[string]string
+	PeerCertFile string
+	PeerKeyFile  string
+	PeerCAFile   string
+}
+
 func main() {
-	srv := server.NewHTTPServer(":8080")
-	fmt.Println("Listening localhost:8080 ... ")
-	log.Fatal(srv.ListenAndServe())
+	var c cfg
+	flag.StringVar(&c.Addr, "addr", ":8400", "gRPC와 JSON/HTTP API가 받을 주소")
+	flag.StringVar(&c.DataDir, "data-dir", filepath.Join(os.TempDir(), "proglog"), "로그를 저장할 디렉터리")
+	flag.StringVar(&c.TopicsDir, "topics-dir", "", "토픽들을 저장할 디렉터리(비어있으면 <data-dir>/topics)")
+	flag.StringVar(&c.OffsetsDir, "offsets-dir", "", "컨슈머 그룹의 오프셋을 저장할 디렉터리(비어있으면 <data-dir>/offsets)")
+	flag.StringVar(&c.CertFile, "server-tls-cert-file", config.ServerCertFile, "서버 인증서")
+	flag.StringVar(&c.KeyFile, "server-tls-key-file", config.ServerKeyFile, "서버 인증서의 키")
+	flag.StringVar(&c.CAFile, "server-tls-ca-file", config.CAFile, "클라이언트 인증서를 검증할 CA 인증서")
+	flag.StringVar(&c.ACLModelFile, "acl-model-file", config.ACLModelFile, "Casbin ACL 모델 파일")
+	flag.StringVar(&c.ACLPolicyFile, "acl-policy-file", config.ACLPolicyFile, "Casbin ACL 정책 파일")
+	flag.DurationVar(&c.MaxConsumeWait, "max-consume-wait", 0, "Consume 요청이 새 레코드를 기다리는 최대 시간(롱 폴링)")
+	flag.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "종료할 때 처리 중인 요청을 기다리는 최대 시간")
+	flag.Uint64Var(&c.Log.Segment.MaxStoreBytes, "segment-max-store-bytes", 0, "세그먼트 스토어의 최대 크기(0이면 기본값)")
+	flag.Uint64Var(&c.Log.Segment.MaxIndexBytes, "segment-max-index-bytes", 0, "세그먼트 인덱스의 최대 크기(0이면 기본값)")
+	flag.DurationVar(&c.Log.Transaction.Timeout, "txn-timeout", time.Minute, "끝나지 않은 트랜잭션을 중단하기까지의 시간(0이면 중단하지 않는다)")
+	flag.Func("peers", "복제할 서버들(name=addr,name=addr,...)", func(v string) (err error) {
+		c.Peers, err = parsePeers(v)
+		return err
+	})
+	flag.StringVar(&c.PeerCertFile, "peer-tls-cert-file", config.RootClientCertFile, "피어에 연결할 때 사용할 클라이언트 인증서")
+	flag.StringVar(&c.PeerKeyFile, "peer-tls-key-file", config.RootClientKeyFile, "피어에 연결할 때 사용할 클라이언트 인증서의 키")
+	flag.StringVar(&c.PeerCAFile, "peer-tls-ca-file", config.CAFile, "피어의 서버 인증서를 검증할 CA 인증서")
+	flag.Parse()
+
+	if err := run(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parsePeers 함수는 "name=addr,name=addr" 형식의 피어 목록을 파싱한다.
+func parsePeers(v string) (map[string]string, error) {
+	peers := map[string]string{}
+	for _, peer := range strings.Split(v, ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(peer, "=")
+		if !ok || name == "" || addr == "" {
+			return nil, fmt.Errorf("invalid peer %q: want name=addr", peer)
+		}
+		if _, ok := peers[name]; ok {
+			return nil, fmt.Errorf("duplicate peer %q", name)
+		}
+		peers[name] = addr
+	}
+	return peers, nil
+}
+
+func run(c cfg) error {
+	if err := os.MkdirAll(c.DataDir, 0755); err != nil {
+		return err
+	}
+	clog, err := log.NewLog(c.DataDir, c.Log)
+	if err != nil {
+		return err
+	}
+	// 복구 보고는 다른 컴포넌트들의 진단 메시지처럼 표준 에러에 접두어와 시각을 붙여서 남긴다.
+	if r := clog.Recovery(); r.Repaired() || r.OpenTransactions > 0 {
+		stdlog.New(os.Stderr, "recovery: ", stdlog.LstdFlags).Print(r.String())
+	}
+
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: c.CertFile,
+		KeyFile:  c.KeyFile,
+		CAFile:   c.CAFile,
+		Server:   true,
+	})
+	if err != nil {
+		clog.Close()
+		return err
+	}
+
+	if c.TopicsDir == "" {
+		c.TopicsDir = filepath.Join(c.DataDir, "topics")
+	}
+	topics, err := log.NewTopicManager(c.TopicsDir, c.Log)
+	if err != nil {
+		clog.Close()
+		return err
+	}
+	if c.OffsetsDir == "" {
+		c.OffsetsDir = filepath.Join(c.DataDir, "offsets")
+	}
+	offsets, err := log.NewOffsetStore(c.OffsetsDir, c.Log)
+	if err != nil {
+		topics.Close()
+		clog.Close()
+		return err
+	}
+	// closeLogs 함수는 기본 로그와 열어둔 토픽들의 로그, 오프셋의 내부 로그를 닫는다.
+	closeLogs := func() error {
+		err := offsets.Close()
+		if cerr := topics.Close(); err == nil {
+			err = cerr
+		}
+		if cerr := clog.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	shutdown := make(chan struct{})
+	serverConfig := &server.Config{
+		CommitLog:      clog,
+		Authorizer:     auth.New(c.ACLModelFile, c.ACLPolicyFile),
+		MaxConsumeWait: c.MaxConsumeWait,
+		Shutdown:       shutdown,
+		Topics:         topicManager{topics},
+		Offsets:        offsets,
+		Groups:         group.New(group.Config{}),
+	}
+	ln, err := net.Listen("tcp", c.Addr)
+	if err != nil {
+		closeLogs()
+		return err
+	}
+	srv, err := server.NewMux(ln, tlsConfig, serverConfig)
+	if err != nil {
+		ln.Close()
+		closeLogs()
+		return err
+	}
+
+	replicator, err := setupReplicator(c, clog)
+	if err != nil {
+		srv.Close()
+		closeLogs()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve()
+	}()
+	fmt.Printf("Listening %s ... (data dir: %s)\n", srv.Addr(), c.DataDir)
+
+	select {
+	case err = <-serveErr:
+		// 서버가 스스로 멈췄다면 복제를 멈추고 로그를 닫는다.
+		if replicator != nil {
+			replicator.Close()
+		}
+		srv.Close()
+		if cerr := closeLogs(); err == nil {
+			err = cerr
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down ...")
+	close(shutdown)
+	// 복제를 먼저 멈춰야 로그를 닫은 후에 복제한 레코드를 추가하지 않는다.
+	if replicator != nil {
+		replicator.Close()
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	srv.Shutdown(sctx)
+	cancel()
+	// 모든 요청이 끝난 후에 로그를 닫아야 레코드를 추가하는 중에 파일이 닫히지 않는다.
+	return closeLogs()
+}
+
+// topicManager는 log.TopicManager를 server.TopicManager로 쓸 수 있게 토픽의 로그를 server.CommitLog로 리턴한다.
+type topicManager struct {
+	*log.TopicManager
+}
+
+func (m topicManager) Topic(name string) (server.CommitLog, error) {
+	l, err := m.TopicManager.Topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// setupReplicator 함수는 피어에 mTLS로 연결해서 피어들의 로그를 clog에 복제하는 Replicator를 시작한다.
+// 피어가 없다면 복제하지 않으므로 피어의 인증서도 읽지 않고 nil을 리턴한다.
+func setupReplicator(c cfg, clog *log.Log) (*log.Replicator, error) {
+	if len(c.Peers) == 0 {
+		return nil, nil
+	}
+	peerTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: c.PeerCertFile,
+		KeyFile:  c.PeerKeyFile,
+		CAFile:   c.PeerCAFile,
+		Server:   false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	replicator := &log.Replicator{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(peerTLSConfig)),
+		},
+		LocalServer: clog,
+	}
+	for name, addr := range c.Peers {
+		if err := replicator.Join(name, addr); err != nil {
+			replicator.Close()
+			return nil, err
+		}
+		fmt.Printf("Replicating %s (%s)\n", name, addr)
+	}
+	return replicator, nil
 }
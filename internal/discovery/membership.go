@@ -0,0 +1,206 @@
+package discovery
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+/*
+서비스 디스커버리는 클러스터의 서버들이 서로를 자동으로 찾게 해준다. 서버가 클러스터에 들어오거나 나가면
+다른 서버들이 이를 알아채고, 복제 같은 작업을 시작하거나 멈춘다.
+
+Serf는 가십(gossip) 프로토콜로 클러스터의 멤버십을 관리한다. 각 노드는 Serf 인스턴스를 실행하고,
+클러스터의 노드 중 하나 이상의 주소(시드)로 클러스터에 참여한다. 그 후로는 노드들이 서로 가십을 주고받으며
+누가 클러스터에 있는지를 알게 된다.
+
+Membership은 Serf를 감싸서 노드가 들어오거나 나갈 때 Handler를 호출한다.
+노드는 RPC 주소를 Serf의 태그(rpcAddrTag)로 알리므로, 다른 노드들은 이 주소로 복제 등을 위해 연결할 수 있다.
+*/
+type Membership struct {
+	Config
+	handler Handler
+	serf    *serf.Serf
+	events  chan serf.Event
+	logger  *log.Logger
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// rpcAddrTag는 노드의 RPC 주소를 알리는 Serf 태그이다.
+const rpcAddrTag = "rpc_addr"
+
+type Config struct {
+	// NodeName은 클러스터에서 노드를 구분하는 고유한 이름이다.
+	NodeName string
+	// BindAddr는 Serf가 가십을 주고받을 주소이다.
+	BindAddr string
+	// RPCAddr는 다른 노드들이 이 노드에 연결할 RPC 주소이다. 태그로 알린다.
+	RPCAddr string
+	// Tags는 RPCAddr 외에 다른 노드들에게 알릴 추가 정보이다.
+	Tags map[string]string
+	// StartJoinAddrs는 클러스터에 참여할 때 연결할 시드 노드들의 Serf 주소이다. 비어있다면 새 클러스터를 시작한다.
+	StartJoinAddrs []string
+	// RejoinInterval은 시드 노드에 모두 연결하지 못했을 때 다시 시도하는 간격이다. 0이면 1초이다.
+	RejoinInterval time.Duration
+}
+
+// Handler는 노드가 클러스터에 들어오거나 나갈 때 호출된다. 복제를 담당하는 계층이 구현한다.
+type Handler interface {
+	Join(name, addr string) error
+	Leave(name string) error
+}
+
+func New(handler Handler, config Config) (*Membership, error) {
+	if config.RejoinInterval == 0 {
+		config.RejoinInterval = time.Second
+	}
+	c := &Membership{
+		Config:  config,
+		handler: handler,
+		logger:  log.New(os.Stderr, "membership: ", log.LstdFlags),
+		done:    make(chan struct{}),
+	}
+	if err := c.setupSerf(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (m *Membership) setupSerf() (err error) {
+	addr, err := net.ResolveTCPAddr("tcp", m.BindAddr)
+	if err != nil {
+		return err
+	}
+	config := serf.DefaultConfig()
+	config.Init()
+	config.MemberlistConfig.BindAddr = addr.IP.String()
+	config.MemberlistConfig.BindPort = addr.Port
+	m.events = make(chan serf.Event)
+	config.EventCh = m.events
+	config.Tags = map[string]string{}
+	for k, v := range m.Tags {
+		config.Tags[k] = v
+	}
+	config.Tags[rpcAddrTag] = m.RPCAddr
+	config.NodeName = m.NodeName
+	m.serf, err = serf.Create(config)
+	if err != nil {
+		return err
+	}
+	m.wg.Add(1)
+	go m.eventHandler()
+	if m.StartJoinAddrs != nil {
+		// 시드 노드가 모두 아직 떠있지 않을 수 있다. 하나라도 연결할 때까지 백그라운드에서 다시 시도한다.
+		if _, err = m.serf.Join(m.StartJoinAddrs, true); err != nil {
+			m.logger.Printf("failed to join %v, retrying: %v", m.StartJoinAddrs, err)
+			m.wg.Add(1)
+			go m.rejoin()
+		}
+	}
+	return nil
+}
+
+// rejoin 메서드는 시드 노드 중 하나에 연결할 때까지 RejoinInterval마다 다시 시도한다.
+// 한 번 클러스터에 참여한 후에는 Serf가 연결이 끊긴 노드들에 다시 연결한다.
+func (m *Membership) rejoin() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.RejoinInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			if _, err := m.serf.Join(m.StartJoinAddrs, true); err == nil {
+				return
+			}
+		}
+	}
+}
+
+/*
+eventHandler 메서드는 Serf의 이벤트 채널을 읽으면서 이벤트의 종류에 따라 처리한다.
+노드가 들어오면 handler의 Join을, 떠나거나 실패하면 Leave를 호출한다.
+Serf는 여러 멤버의 변경을 하나의 이벤트로 묶어서 보낼 수 있으므로 이벤트의 멤버들을 모두 확인한다.
+자기 자신에 대한 이벤트는 무시한다.
+*/
+func (m *Membership) eventHandler() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case e := <-m.events:
+			switch e.EventType() {
+			case serf.EventMemberJoin:
+				for _, member := range e.(serf.MemberEvent).Members {
+					if m.isLocal(member) {
+						continue
+					}
+					m.handleJoin(member)
+				}
+			case serf.EventMemberLeave, serf.EventMemberFailed:
+				for _, member := range e.(serf.MemberEvent).Members {
+					if m.isLocal(member) {
+						continue
+					}
+					m.handleLeave(member)
+				}
+			}
+		}
+	}
+}
+
+func (m *Membership) handleJoin(member serf.Member) {
+	if err := m.handler.Join(
+		member.Name,
+		member.Tags[rpcAddrTag],
+	); err != nil {
+		m.logError(err, "failed to join", member)
+	}
+}
+
+func (m *Membership) handleLeave(member serf.Member) {
+	if err := m.handler.Leave(
+		member.Name,
+	); err != nil {
+		m.logError(err, "failed to leave", member)
+	}
+}
+
+// isLocal 메서드는 멤버가 이 노드 자신인지 확인한다.
+func (m *Membership) isLocal(member serf.Member) bool {
+	return m.serf.LocalMember().Name == member.Name
+}
+
+// Members 메서드는 클러스터 멤버들의 스냅숏을 리턴한다.
+func (m *Membership) Members() []serf.Member {
+	return m.serf.Members()
+}
+
+// Leave 메서드는 이 노드가 클러스터를 떠난다고 알리고 Serf를 멈춘다.
+// Serf가 떠나는 동안 보내는 이벤트를 받을 수 있도록 Serf를 멈춘 후에 이벤트 처리 고루틴을 멈춘다.
+func (m *Membership) Leave() error {
+	select {
+	case <-m.done:
+		return nil
+	default:
+	}
+	err := m.serf.Leave()
+	if serr := m.serf.Shutdown(); err == nil {
+		err = serr
+	}
+	close(m.done)
+	m.wg.Wait()
+	return err
+}
+
+func (m *Membership) logError(err error, msg string, member serf.Member) {
+	m.logger.Printf("%s: %v (name=%s, rpc_addr=%s)", msg, err, member.Name, member.Tags[rpcAddrTag])
+}
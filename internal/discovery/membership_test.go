@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMembership(t *testing.T) {
+	m, handler := setupMember(t, nil, nil)
+	m, _ = setupMember(t, m, nil)
+	m, _ = setupMember(t, m, nil)
+
+	require.Eventually(t, func() bool {
+		return len(handler.joins) == 2 &&
+			len(m[0].Members()) == 3 &&
+			len(handler.leaves) == 0
+	}, 3*time.Second, 250*time.Millisecond)
+
+	// 다른 노드들의 RPC 주소를 태그로 받는다.
+	joined := map[string]string{}
+	for i := 0; i < 2; i++ {
+		join := <-handler.joins
+		joined[join["name"]] = join["addr"]
+	}
+	require.Equal(t, map[string]string{
+		"1": m[1].RPCAddr,
+		"2": m[2].RPCAddr,
+	}, joined)
+
+	require.NoError(t, m[2].Leave())
+
+	require.Eventually(t, func() bool {
+		left := false
+		for _, member := range m[0].Members() {
+			if member.Name == "2" {
+				left = member.Status == serf.StatusLeft
+			}
+		}
+		return left && len(handler.leaves) == 1
+	}, 3*time.Second, 250*time.Millisecond)
+
+	require.Equal(t, fmt.Sprintf("%d", 2), <-handler.leaves)
+}
+
+// 시드 노드가 아직 떠있지 않더라도 다시 시도해서 클러스터에 참여한다.
+func TestMembershipSeedDown(t *testing.T) {
+	seedAddr := freeAddr(t)
+	m, handler := setupMember(t, nil, func(c *Config) {
+		c.NodeName = "late-joiner"
+		c.StartJoinAddrs = []string{freeAddr(t), seedAddr}
+		c.RejoinInterval = 50 * time.Millisecond
+	})
+	defer m[0].Leave()
+
+	time.Sleep(100 * time.Millisecond)
+	seed, _ := setupMember(t, nil, func(c *Config) {
+		c.NodeName = "seed"
+		c.BindAddr = seedAddr
+	})
+	defer seed[0].Leave()
+
+	require.Eventually(t, func() bool {
+		return len(handler.joins) == 1 && len(m[0].Members()) == 2
+	}, 3*time.Second, 50*time.Millisecond)
+	require.Equal(t, "seed", (<-handler.joins)["name"])
+}
+
+// setupMember 함수는 루프백 주소에 멤버를 만든다. 이미 멤버가 있다면 첫 번째 멤버를 시드로 참여한다.
+func setupMember(t *testing.T, members []*Membership, fn func(*Config)) (
+	[]*Membership, *handler,
+) {
+	id := len(members)
+	c := Config{
+		NodeName: fmt.Sprintf("%d", id),
+		BindAddr: freeAddr(t),
+		RPCAddr:  freeAddr(t),
+	}
+	h := &handler{}
+	if len(members) == 0 {
+		h.joins = make(chan map[string]string, 3)
+		h.leaves = make(chan string, 3)
+	} else {
+		c.StartJoinAddrs = []string{
+			members[0].BindAddr,
+		}
+	}
+	if fn != nil {
+		fn(&c)
+	}
+	m, err := New(h, c)
+	require.NoError(t, err)
+	members = append(members, m)
+	return members, h
+}
+
+// freeAddr 함수는 루프백 주소에서 사용하지 않는 포트를 찾는다.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// handler는 Membership이 호출한 Join, Leave를 기록하는 테스트용 Handler이다.
+type handler struct {
+	joins  chan map[string]string
+	leaves chan string
+}
+
+func (h *handler) Join(id, addr string) error {
+	if h.joins != nil {
+		h.joins <- map[string]string{
+			"name": id,
+			"addr": addr,
+		}
+	}
+	return nil
+}
+
+func (h *handler) Leave(id string) error {
+	if h.leaves != nil {
+		h.leaves <- id
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package group
+
+import (
+	"sort"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+/*
+Assignor는 그룹의 멤버들에게 구독한 토픽들의 파티션을 나눠주는 할당 전략이다. 멤버가 들어오거나 나갈 때마다(리밸런스) 호출한다.
+각 파티션은 그 토픽을 구독한 멤버 중 정확히 하나에게 할당해야 한다. 구독한 멤버가 없는 토픽의 파티션은 할당하지 않는다.
+
+	members    : 멤버들(ID 순서로 정렬되어 있다)
+	partitions : 토픽마다의 파티션 수
+	previous   : 이전 세대의 할당. 멤버 ID가 키이다. sticky 전략처럼 이전 할당을 유지하려는 전략이 사용한다.
+
+리턴하는 맵은 멤버 ID가 키이며, 할당받지 못한 멤버는 빠져도 된다.
+*/
+type Assignor interface {
+	Name() string
+	Assign(members []Member, partitions map[string]uint32, previous map[string][]*api.TopicPartition) map[string][]*api.TopicPartition
+}
+
+// Member는 할당 전략에 전달하는 멤버와 멤버가 구독한 토픽들이다.
+type Member struct {
+	ID     string
+	Topics []string
+}
+
+func (m Member) subscribes(topic string) bool {
+	for _, t := range m.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedTopics 함수는 파티션을 할당할 토픽들을 이름 순서로 리턴한다.
+func sortedTopics(partitions map[string]uint32) []string {
+	topics := make([]string, 0, len(partitions))
+	for topic := range partitions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+/*
+RangeAssignor는 토픽마다 파티션을 연속한 범위로 나눈다. 파티션이 n개이고 구독한 멤버가 k명이면 멤버마다 n/k개씩,
+앞의 n%k명은 하나씩 더 받는다. 여러 토픽을 같은 키로 나눠서 쓴다면 같은 번호의 파티션들이 같은 멤버에게 간다.
+*/
+type RangeAssignor struct{}
+
+func (RangeAssignor) Name() string { return "range" }
+
+func (RangeAssignor) Assign(members []Member, partitions map[string]uint32, _ map[string][]*api.TopicPartition) map[string][]*api.TopicPartition {
+	assignments := make(map[string][]*api.TopicPartition)
+	for _, topic := range sortedTopics(partitions) {
+		var subscribers []Member
+		for _, m := range members {
+			if m.subscribes(topic) {
+				subscribers = append(subscribers, m)
+			}
+		}
+		if len(subscribers) == 0 {
+			continue
+		}
+		n, k := partitions[topic], uint32(len(subscribers))
+		p := uint32(0)
+		for i, m := range subscribers {
+			count := n / k
+			if uint32(i) < n%k {
+				count++
+			}
+			for end := p + count; p < end; p++ {
+				assignments[m.ID] = append(assignments[m.ID], &api.TopicPartition{Topic: topic, Partition: p})
+			}
+		}
+	}
+	return assignments
+}
+
+// RoundRobinAssignor는 모든 토픽의 파티션을 (토픽, 파티션) 순서로 늘어놓고 멤버들에게 돌아가면서 나눈다.
+// 구독하지 않은 멤버는 건너뛴다. 멤버마다 받는 파티션 수의 차이가 range 전략보다 작다.
+type RoundRobinAssignor struct{}
+
+func (RoundRobinAssignor) Name() string { return "roundrobin" }
+
+func (RoundRobinAssignor) Assign(members []Member, partitions map[string]uint32, _ map[string][]*api.TopicPartition) map[string][]*api.TopicPartition {
+	assignments := make(map[string][]*api.TopicPartition)
+	if len(members) == 0 {
+		return assignments
+	}
+	next := 0
+	for _, topic := range sortedTopics(partitions) {
+		for p := uint32(0); p < partitions[topic]; p++ {
+			for i := 0; i < len(members); i++ {
+				m := members[(next+i)%len(members)]
+				if !m.subscribes(topic) {
+					continue
+				}
+				assignments[m.ID] = append(assignments[m.ID], &api.TopicPartition{Topic: topic, Partition: p})
+				next = (next + i + 1) % len(members)
+				break
+			}
+		}
+	}
+	return assignments
+}
+
+/*
+StickyAssignor는 리밸런스 전후로 파티션이 옮겨가는 것을 최소로 한다. 파티션을 옮기면 새 멤버는 커밋된 오프셋부터 다시 읽어야 하고,
+이전 멤버가 만든 캐시 같은 상태도 버려야 하기 때문이다.
+ 1. 이전 세대에 할당받은 파티션은 멤버가 남아있고 여전히 구독한다면 그대로 둔다.
+ 2. 주인이 없는 파티션은 그 토픽을 구독한 멤버 중 가장 적게 받은 멤버에게 준다.
+ 3. 파티션을 받을 수 있는 다른 멤버보다 두 개 이상 많이 받은 멤버의 파티션을 옮겨서 균형을 맞춘다.
+*/
+type StickyAssignor struct{}
+
+func (StickyAssignor) Name() string { return "sticky" }
+
+func (StickyAssignor) Assign(members []Member, partitions map[string]uint32, previous map[string][]*api.TopicPartition) map[string][]*api.TopicPartition {
+	type tp struct {
+		topic     string
+		partition uint32
+	}
+	owner := make(map[tp]string)
+	count := make(map[string]int)
+	for _, m := range members {
+		count[m.ID] = 0
+	}
+	// 1. 이전 할당을 유지한다. 멤버 ID 순서로 보므로 두 멤버가 같은 파티션을 가졌었다면 앞의 멤버가 가진다.
+	for _, m := range members {
+		for _, a := range previous[m.ID] {
+			k := tp{a.Topic, a.Partition}
+			if !m.subscribes(a.Topic) || a.Partition >= partitions[a.Topic] {
+				continue
+			}
+			if _, ok := owner[k]; ok {
+				continue
+			}
+			owner[k] = m.ID
+			count[m.ID]++
+		}
+	}
+	// leastLoaded 함수는 topic을 구독한 멤버 중 가장 적게 받은 멤버를 리턴한다.
+	leastLoaded := func(topic string) (string, bool) {
+		best, found := "", false
+		for _, m := range members {
+			if !m.subscribes(topic) {
+				continue
+			}
+			if !found || count[m.ID] < count[best] {
+				best, found = m.ID, true
+			}
+		}
+		return best, found
+	}
+	// 2. 주인이 없는 파티션을 나눠준다.
+	topics := sortedTopics(partitions)
+	for _, topic := range topics {
+		for p := uint32(0); p < partitions[topic]; p++ {
+			k := tp{topic, p}
+			if _, ok := owner[k]; ok {
+				continue
+			}
+			if id, ok := leastLoaded(topic); ok {
+				owner[k] = id
+				count[id]++
+			}
+		}
+	}
+	// 3. 더 옮길 파티션이 없을 때까지 균형을 맞춘다. 한 번 옮길 때마다 두 멤버의 차이가 줄어들므로 반드시 끝난다.
+	for moved := true; moved; {
+		moved = false
+		for _, topic := range topics {
+			for p := uint32(0); p < partitions[topic]; p++ {
+				k := tp{topic, p}
+				from, ok := owner[k]
+				if !ok {
+					continue
+				}
+				to, _ := leastLoaded(topic)
+				if count[from]-count[to] > 1 {
+					owner[k] = to
+					count[from]--
+					count[to]++
+					moved = true
+				}
+			}
+		}
+	}
+
+	assignments := make(map[string][]*api.TopicPartition)
+	for _, topic := range topics {
+		for p := uint32(0); p < partitions[topic]; p++ {
+			if id, ok := owner[tp{topic, p}]; ok {
+				assignments[id] = append(assignments[id], &api.TopicPartition{Topic: topic, Partition: p})
+			}
+		}
+	}
+	return assignments
+}
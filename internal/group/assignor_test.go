@@ -0,0 +1,99 @@
+package group
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// names 함수는 할당을 비교하기 쉽게 "토픽/파티션" 문자열로 바꾼다.
+func names(assignments []*api.TopicPartition) []string {
+	var s []string
+	for _, tp := range assignments {
+		s = append(s, fmt.Sprintf("%s/%d", tp.Topic, tp.Partition))
+	}
+	return s
+}
+
+func TestRangeAssignor(t *testing.T) {
+	members := []Member{
+		{ID: "a", Topics: []string{"t0", "t1"}},
+		{ID: "b", Topics: []string{"t0", "t1"}},
+		{ID: "c", Topics: []string{"t1"}},
+	}
+	got := RangeAssignor{}.Assign(members, map[string]uint32{"t0": 3, "t1": 4}, nil)
+	require.Equal(t, []string{"t0/0", "t0/1", "t1/0", "t1/1"}, names(got["a"]))
+	require.Equal(t, []string{"t0/2", "t1/2"}, names(got["b"]))
+	require.Equal(t, []string{"t1/3"}, names(got["c"]))
+}
+
+func TestRoundRobinAssignor(t *testing.T) {
+	members := []Member{
+		{ID: "a", Topics: []string{"t0", "t1"}},
+		{ID: "b", Topics: []string{"t0", "t1"}},
+		{ID: "c", Topics: []string{"t1"}},
+	}
+	got := RoundRobinAssignor{}.Assign(members, map[string]uint32{"t0": 3, "t1": 4}, nil)
+	require.Equal(t, []string{"t0/0", "t0/2", "t1/2"}, names(got["a"]))
+	require.Equal(t, []string{"t0/1", "t1/0", "t1/3"}, names(got["b"]))
+	require.Equal(t, []string{"t1/1"}, names(got["c"]))
+}
+
+func TestStickyAssignor(t *testing.T) {
+	partitions := map[string]uint32{"t": 6}
+	sticky := StickyAssignor{}
+
+	first := sticky.Assign([]Member{
+		{ID: "a", Topics: []string{"t"}},
+		{ID: "b", Topics: []string{"t"}},
+	}, partitions, nil)
+	require.Equal(t, 3, len(first["a"]))
+	require.Equal(t, 3, len(first["b"]))
+
+	// c가 들어오면 a와 b는 하나씩만 내주고 나머지는 그대로 가진다.
+	second := sticky.Assign([]Member{
+		{ID: "a", Topics: []string{"t"}},
+		{ID: "b", Topics: []string{"t"}},
+		{ID: "c", Topics: []string{"t"}},
+	}, partitions, first)
+	for _, id := range []string{"a", "b", "c"} {
+		require.Equal(t, 2, len(second[id]), id)
+	}
+	require.Subset(t, names(first["a"]), names(second["a"]))
+	require.Subset(t, names(first["b"]), names(second["b"]))
+
+	// b가 떠나면 b의 파티션만 a와 c에게 간다.
+	third := sticky.Assign([]Member{
+		{ID: "a", Topics: []string{"t"}},
+		{ID: "c", Topics: []string{"t"}},
+	}, partitions, second)
+	require.Equal(t, 3, len(third["a"]))
+	require.Equal(t, 3, len(third["c"]))
+	require.Subset(t, names(third["a"]), names(second["a"]))
+	require.Subset(t, names(third["c"]), names(second["c"]))
+}
+
+// 모든 전략은 구독한 토픽의 파티션을 정확히 한 번씩 할당한다.
+func TestAssignorsCoverPartitions(t *testing.T) {
+	members := []Member{
+		{ID: "a", Topics: []string{"t0"}},
+		{ID: "b", Topics: []string{"t0", "t1"}},
+		{ID: "c", Topics: []string{"t1", "t2"}},
+		{ID: "d", Topics: []string{"t2"}},
+	}
+	partitions := map[string]uint32{"t0": 5, "t1": 1, "t2": 7}
+	for _, assignor := range []Assignor{RangeAssignor{}, RoundRobinAssignor{}, StickyAssignor{}} {
+		seen := make(map[string]bool)
+		for _, m := range members {
+			for _, tp := range assignor.Assign(members, partitions, nil)[m.ID] {
+				require.True(t, m.subscribes(tp.Topic), assignor.Name())
+				name := fmt.Sprintf("%s/%d", tp.Topic, tp.Partition)
+				require.False(t, seen[name], assignor.Name())
+				seen[name] = true
+			}
+		}
+		require.Equal(t, 13, len(seen), assignor.Name())
+	}
+}
@@ -0,0 +1,329 @@
+package group
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Coordinator는 컨슈머 그룹의 멤버십을 관리하고 멤버들에게 파티션을 할당한다. 같은 그룹의 멤버들이 모두 ConsumeStream으로
+모든 레코드를 읽는 대신, 각 파티션을 한 멤버만 읽도록 나눠준다.
+
+  - JoinGroup: 멤버가 그룹에 참여한다. 구독할 토픽들과 할당 전략을 알린다.
+  - Heartbeat: 멤버가 살아있음을 알린다. 세션 타임아웃 동안 하트비트가 없는 멤버는 그룹에서 빠진다.
+  - LeaveGroup: 멤버가 그룹을 떠난다.
+
+멤버가 들어오거나 나가면 그룹의 세대(generation)를 올리고 할당 전략으로 파티션을 다시 나눈다(리밸런스).
+다른 멤버들은 다음 하트비트의 응답으로 새 세대와 할당을 받는다. 오프셋 커밋은 현재 세대로만 할 수 있으므로(ValidateCommit),
+리밸런스를 알아채지 못한 멤버가 이미 다른 멤버에게 넘어간 파티션의 오프셋을 덮어쓸 수 없다(fencing).
+
+멤버가 세션 타임아웃이 지났는지는 그 그룹에 요청이 올 때마다 확인한다. 살아있는 멤버들은 하트비트를 계속 보내므로,
+죽은 멤버는 늦어도 다른 멤버의 다음 하트비트에서 빠진다. 그룹의 상태는 메모리에만 있으므로 서버가 다시 시작하면
+멤버들은 ErrUnknownMember를 받고 다시 참여한다.
+*/
+type Coordinator struct {
+	Config
+
+	mu     sync.Mutex
+	groups map[string]*group
+	// seq는 새 멤버의 ID를 만드는 데 사용한다.
+	seq uint64
+	now func() time.Time
+}
+
+type Config struct {
+	// SessionTimeout은 참여 요청에서 세션 타임아웃을 정하지 않았을 때의 기본값이다. 0이면 10초이다.
+	SessionTimeout time.Duration
+	// MinSessionTimeout, MaxSessionTimeout은 참여 요청의 세션 타임아웃의 범위이다. 범위를 벗어나면 가까운 값을 쓴다.
+	// 0이면 각각 100밀리초, 5분이다.
+	MinSessionTimeout time.Duration
+	MaxSessionTimeout time.Duration
+	// Assignors는 사용할 수 있는 할당 전략들이다. 비어있으면 range, roundrobin, sticky이다.
+	Assignors []Assignor
+}
+
+// group은 한 컨슈머 그룹의 상태이다. 그룹의 할당 전략은 첫 번째 멤버가 정한다. 멤버가 모두 떠나면 그룹을 지우므로 다시 정할 수 있다.
+type group struct {
+	generation  uint64
+	assignor    Assignor
+	members     map[string]*member
+	partitions  map[string]uint32
+	assignments map[string][]*api.TopicPartition
+}
+
+type member struct {
+	topics         []string
+	sessionTimeout time.Duration
+	deadline       time.Time
+}
+
+// JoinRequest는 그룹 참여 요청이다. Partitions는 구독할 토픽들의 파티션 수이며 호출자(서버)가 토픽의 로그로부터 채운다.
+type JoinRequest struct {
+	Group          string
+	MemberID       string
+	Strategy       string
+	SessionTimeout time.Duration
+	Partitions     map[string]uint32
+}
+
+// Assignment는 멤버가 현재 세대에서 할당받은 파티션들이다.
+type Assignment struct {
+	MemberID   string
+	Generation uint64
+	Partitions []*api.TopicPartition
+}
+
+func New(c Config) *Coordinator {
+	if c.SessionTimeout == 0 {
+		c.SessionTimeout = 10 * time.Second
+	}
+	if c.MinSessionTimeout == 0 {
+		c.MinSessionTimeout = 100 * time.Millisecond
+	}
+	if c.MaxSessionTimeout == 0 {
+		c.MaxSessionTimeout = 5 * time.Minute
+	}
+	if len(c.Assignors) == 0 {
+		c.Assignors = []Assignor{RangeAssignor{}, RoundRobinAssignor{}, StickyAssignor{}}
+	}
+	return &Coordinator{
+		Config: c,
+		groups: make(map[string]*group),
+		now:    time.Now,
+	}
+}
+
+/*
+Join 메서드는 멤버를 그룹에 참여시키고 리밸런스한 후 멤버의 할당을 리턴한다.
+MemberID가 비어있으면 새 멤버이다. 이미 있는 멤버가 같은 토픽들로 다시 참여하면 리밸런스하지 않고 세션만 연장한다.
+*/
+func (c *Coordinator) Join(req JoinRequest) (Assignment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, exists := c.group(req.Group)
+	assignor, err := c.assignor(req.Strategy)
+	if err != nil {
+		return Assignment{}, api.ErrInvalidGroupRequest{Group: req.Group, Reason: err.Error()}
+	}
+	if exists && g.assignor.Name() != assignor.Name() {
+		return Assignment{}, api.ErrInvalidGroupRequest{
+			Group:  req.Group,
+			Reason: fmt.Sprintf("group uses strategy %q", g.assignor.Name()),
+		}
+	}
+	if len(req.Partitions) == 0 {
+		return Assignment{}, api.ErrInvalidGroupRequest{Group: req.Group, Reason: "no topics"}
+	}
+
+	id := req.MemberID
+	var m *member
+	ok := false
+	if exists {
+		m, ok = g.members[id]
+	}
+	if id != "" && !ok {
+		return Assignment{}, api.ErrUnknownMember{Group: req.Group, MemberID: id}
+	}
+	topics := make([]string, 0, len(req.Partitions))
+	for topic := range req.Partitions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	rebalance := !ok || !equal(m.topics, topics)
+	if !exists {
+		g = &group{
+			members:    make(map[string]*member),
+			partitions: make(map[string]uint32),
+		}
+		c.groups[req.Group] = g
+	}
+	if !ok {
+		c.seq++
+		id = fmt.Sprintf("%s-%d", req.Group, c.seq)
+		m = &member{}
+		g.members[id] = m
+	}
+	m.topics = topics
+	m.sessionTimeout = c.sessionTimeout(req.SessionTimeout)
+	m.deadline = c.now().Add(m.sessionTimeout)
+	g.assignor = assignor
+	for topic, n := range req.Partitions {
+		g.partitions[topic] = n
+	}
+	if rebalance {
+		g.rebalance()
+	}
+	return g.assignment(id), nil
+}
+
+// Heartbeat 메서드는 멤버의 세션을 연장하고 현재 세대와 멤버의 할당을 리턴한다.
+func (c *Coordinator) Heartbeat(groupID, memberID string) (Assignment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.member(groupID, memberID)
+	if !ok {
+		return Assignment{}, api.ErrUnknownMember{Group: groupID, MemberID: memberID}
+	}
+	g := c.groups[groupID]
+	m.deadline = c.now().Add(m.sessionTimeout)
+	return g.assignment(memberID), nil
+}
+
+// Leave 메서드는 멤버를 그룹에서 빼고 남은 멤버들에게 다시 할당한다.
+func (c *Coordinator) Leave(groupID, memberID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.member(groupID, memberID); !ok {
+		return api.ErrUnknownMember{Group: groupID, MemberID: memberID}
+	}
+	g := c.groups[groupID]
+	delete(g.members, memberID)
+	c.rebalance(groupID, g)
+	return nil
+}
+
+/*
+ValidateCommit 메서드는 오프셋 커밋을 허락할지 확인한다. 멤버가 있는 그룹은 현재 세대의 멤버만 커밋할 수 있다.
+멤버가 없는 그룹은 멤버십 없이 오프셋만 쓰는 소비자를 위해 세대 0의 커밋을 허락한다.
+*/
+func (c *Coordinator) ValidateCommit(groupID, memberID string, generation uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.group(groupID)
+	if !ok && memberID == "" && generation == 0 {
+		return nil
+	}
+	if _, ok := c.member(groupID, memberID); !ok {
+		return api.ErrUnknownMember{Group: groupID, MemberID: memberID}
+	}
+	if generation != g.generation {
+		return api.ErrStaleGeneration{Group: groupID, Generation: generation, Current: g.generation}
+	}
+	return nil
+}
+
+/*
+group 메서드는 그룹의 상태를 리턴한다. 먼저 세션 타임아웃이 지난 멤버들을 빼고 리밸런스한다. c.mu를 잡은 상태에서 호출한다.
+멤버가 모두 떠난 그룹은 지운다. 멤버 ID는 그룹을 지운 후에도 다시 쓰지 않으므로 이전 멤버의 커밋은 계속 거부된다.
+*/
+func (c *Coordinator) group(id string) (*group, bool) {
+	g, ok := c.groups[id]
+	if !ok {
+		return nil, false
+	}
+	now := c.now()
+	expired := false
+	for memberID, m := range g.members {
+		if now.After(m.deadline) {
+			delete(g.members, memberID)
+			expired = true
+		}
+	}
+	if expired {
+		c.rebalance(id, g)
+	}
+	return c.groups[id], c.groups[id] != nil
+}
+
+// member 메서드는 그룹의 멤버를 리턴한다. c.mu를 잡은 상태에서 호출한다.
+func (c *Coordinator) member(groupID, memberID string) (*member, bool) {
+	g, ok := c.group(groupID)
+	if !ok {
+		return nil, false
+	}
+	m, ok := g.members[memberID]
+	return m, ok
+}
+
+// rebalance 메서드는 그룹을 리밸런스한다. 남은 멤버가 없다면 그룹을 지운다.
+func (c *Coordinator) rebalance(id string, g *group) {
+	if len(g.members) == 0 {
+		delete(c.groups, id)
+		return
+	}
+	g.rebalance()
+}
+
+func (c *Coordinator) assignor(strategy string) (Assignor, error) {
+	if strategy == "" {
+		return c.Assignors[0], nil
+	}
+	for _, a := range c.Assignors {
+		if a.Name() == strategy {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown strategy %q", strategy)
+}
+
+func (c *Coordinator) sessionTimeout(d time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return c.SessionTimeout
+	case d < c.MinSessionTimeout:
+		return c.MinSessionTimeout
+	case d > c.MaxSessionTimeout:
+		return c.MaxSessionTimeout
+	}
+	return d
+}
+
+// rebalance 메서드는 세대를 올리고 멤버들에게 파티션을 다시 할당한다.
+func (g *group) rebalance() {
+	g.generation++
+	members := make([]Member, 0, len(g.members))
+	for id, m := range g.members {
+		members = append(members, Member{ID: id, Topics: m.topics})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+	// 구독하는 멤버가 없는 토픽은 잊는다.
+	for topic := range g.partitions {
+		subscribed := false
+		for _, m := range members {
+			if m.subscribes(topic) {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			delete(g.partitions, topic)
+		}
+	}
+	g.assignments = g.assignor.Assign(members, g.partitions, g.assignments)
+}
+
+// assignment 메서드는 멤버의 할당을 복사해서 리턴한다. 호출자가 바꾸더라도 그룹의 상태는 바뀌지 않는다.
+func (g *group) assignment(memberID string) Assignment {
+	a := Assignment{
+		MemberID:   memberID,
+		Generation: g.generation,
+	}
+	for _, tp := range g.assignments[memberID] {
+		a.Partitions = append(a.Partitions, proto.Clone(tp).(*api.TopicPartition))
+	}
+	return a
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
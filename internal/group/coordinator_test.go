@@ -0,0 +1,132 @@
+package group
+
+import (
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinator(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, c *Coordinator, clock *time.Time){
+		"members share partitions":             testJoinRebalance,
+		"stale generation cannot commit":       testFencing,
+		"expired members leave the group":      testSessionTimeout,
+		"rejoin with same topics keeps gen":    testRejoin,
+		"invalid join requests fail":           testInvalidJoin,
+		"commits without membership are valid": testStandaloneCommit,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			clock := time.Unix(0, 0)
+			c := New(Config{SessionTimeout: time.Second})
+			c.now = func() time.Time { return clock }
+			fn(t, c, &clock)
+		})
+	}
+}
+
+func testJoinRebalance(t *testing.T, c *Coordinator, _ *time.Time) {
+	a, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 4}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), a.Generation)
+	require.Equal(t, []string{"t/0", "t/1", "t/2", "t/3"}, names(a.Partitions))
+
+	b, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 4}})
+	require.NoError(t, err)
+	require.NotEqual(t, a.MemberID, b.MemberID)
+	require.Equal(t, uint64(2), b.Generation)
+	require.Equal(t, 2, len(b.Partitions))
+
+	// a는 하트비트로 리밸런스를 알게 된다.
+	a, err = c.Heartbeat("g", a.MemberID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), a.Generation)
+	require.Equal(t, 2, len(a.Partitions))
+	require.NotEqual(t, names(a.Partitions), names(b.Partitions))
+
+	require.NoError(t, c.Leave("g", b.MemberID))
+	a, err = c.Heartbeat("g", a.MemberID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), a.Generation)
+	require.Equal(t, 4, len(a.Partitions))
+
+	_, err = c.Heartbeat("g", b.MemberID)
+	require.Equal(t, api.ErrUnknownMember{Group: "g", MemberID: b.MemberID}, err)
+}
+
+func testFencing(t *testing.T, c *Coordinator, _ *time.Time) {
+	a, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 2}})
+	require.NoError(t, err)
+	require.NoError(t, c.ValidateCommit("g", a.MemberID, a.Generation))
+
+	b, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 2}})
+	require.NoError(t, err)
+	// a는 아직 리밸런스를 모르므로 이전 세대로 커밋하려고 한다.
+	require.Equal(t, api.ErrStaleGeneration{Group: "g", Generation: 1, Current: 2},
+		c.ValidateCommit("g", a.MemberID, a.Generation))
+	require.NoError(t, c.ValidateCommit("g", b.MemberID, b.Generation))
+	require.IsType(t, api.ErrUnknownMember{}, c.ValidateCommit("g", "", 0))
+}
+
+func testSessionTimeout(t *testing.T, c *Coordinator, clock *time.Time) {
+	a, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 2}})
+	require.NoError(t, err)
+	b, err := c.Join(JoinRequest{
+		Group:          "g",
+		Partitions:     map[string]uint32{"t": 2},
+		SessionTimeout: 3 * time.Second,
+	})
+	require.NoError(t, err)
+
+	*clock = clock.Add(2 * time.Second)
+	b, err = c.Heartbeat("g", b.MemberID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), b.Generation)
+	require.Equal(t, 2, len(b.Partitions))
+
+	_, err = c.Heartbeat("g", a.MemberID)
+	require.IsType(t, api.ErrUnknownMember{}, err)
+	require.IsType(t, api.ErrUnknownMember{}, c.ValidateCommit("g", a.MemberID, a.Generation))
+
+	// 마지막 멤버도 만료되면 그룹이 사라진다.
+	*clock = clock.Add(4 * time.Second)
+	_, err = c.Heartbeat("g", b.MemberID)
+	require.IsType(t, api.ErrUnknownMember{}, err)
+	require.Equal(t, 0, len(c.groups))
+}
+
+func testRejoin(t *testing.T, c *Coordinator, _ *time.Time) {
+	a, err := c.Join(JoinRequest{Group: "g", Partitions: map[string]uint32{"t": 2}})
+	require.NoError(t, err)
+	again, err := c.Join(JoinRequest{Group: "g", MemberID: a.MemberID, Partitions: map[string]uint32{"t": 2}})
+	require.NoError(t, err)
+	require.Equal(t, a, again)
+
+	// 구독을 바꾸면 리밸런스한다.
+	again, err = c.Join(JoinRequest{Group: "g", MemberID: a.MemberID, Partitions: map[string]uint32{"t": 2, "u": 1}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), again.Generation)
+	require.Equal(t, []string{"t/0", "t/1", "u/0"}, names(again.Partitions))
+}
+
+func testInvalidJoin(t *testing.T, c *Coordinator, _ *time.Time) {
+	_, err := c.Join(JoinRequest{Group: "g", Strategy: "random", Partitions: map[string]uint32{"t": 1}})
+	require.IsType(t, api.ErrInvalidGroupRequest{}, err)
+	_, err = c.Join(JoinRequest{Group: "g"})
+	require.IsType(t, api.ErrInvalidGroupRequest{}, err)
+	_, err = c.Join(JoinRequest{Group: "g", MemberID: "g-100", Partitions: map[string]uint32{"t": 1}})
+	require.IsType(t, api.ErrUnknownMember{}, err)
+	require.Equal(t, 0, len(c.groups))
+
+	_, err = c.Join(JoinRequest{Group: "g", Strategy: "sticky", Partitions: map[string]uint32{"t": 1}})
+	require.NoError(t, err)
+	_, err = c.Join(JoinRequest{Group: "g", Strategy: "range", Partitions: map[string]uint32{"t": 1}})
+	require.IsType(t, api.ErrInvalidGroupRequest{}, err)
+}
+
+func testStandaloneCommit(t *testing.T, c *Coordinator, _ *time.Time) {
+	require.NoError(t, c.ValidateCommit("g", "", 0))
+	require.IsType(t, api.ErrUnknownMember{}, c.ValidateCommit("g", "g-1", 1))
+	require.Equal(t, 0, len(c.groups))
+}
@@ -0,0 +1,84 @@
+package loadbalance
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+/*
+Picker는 RPC마다 보낼 서버를 고른다. 복제된 로그를 읽기만 하는 요청(readOnly의 소비 요청 등)은 팔로워들에게 돌아가면서(round-robin)
+보내서 리더의 부하를 줄인다. 팔로워가 없다면 리더에게 보낸다.
+그 밖의 요청은 모두 리더에게 보낸다. 생산과 트랜잭션처럼 로그에 쓰는 요청은 리더만 처리할 수 있고, 프로듀서 ID, 토픽, 컨슈머 그룹의
+오프셋과 멤버십처럼 상태를 바꾸거나 한 서버가 관리하는 상태를 읽는 요청도 같은 서버로 보내야 한다.
+새 RPC는 readOnly에 추가하기 전까지 리더에게 가므로, 목록에 빠뜨려도 잘못된 서버에 쓰는 일은 없다.
+
+gRPC의 base 밸런서가 서버마다 연결(SubConn)을 관리하고, 연결할 수 있는 서버들이 바뀔 때마다 Build를 호출해서 새 피커를 만든다.
+*/
+type Picker struct {
+	leader    balancer.SubConn
+	followers []balancer.SubConn
+	current   uint64
+}
+
+var _ base.PickerBuilder = (*Picker)(nil)
+
+func init() {
+	balancer.Register(
+		base.NewBalancerBuilder(Name, &Picker{}, base.Config{}),
+	)
+}
+
+// Build 메서드는 준비된 연결들을 리졸버가 알려준 속성에 따라 리더와 팔로워로 나눈 새 피커를 만든다.
+func (p *Picker) Build(buildInfo base.PickerBuildInfo) balancer.Picker {
+	picker := &Picker{}
+	for sc, scInfo := range buildInfo.ReadySCs {
+		isLeader, _ := scInfo.Address.Attributes.Value(isLeaderAttr).(bool)
+		if isLeader {
+			picker.leader = sc
+			continue
+		}
+		picker.followers = append(picker.followers, sc)
+	}
+	return picker
+}
+
+var _ balancer.Picker = (*Picker)(nil)
+
+/*
+Pick 메서드는 요청의 메서드 이름으로 보낼 서버를 고른다. 고를 서버가 없다면 ErrNoSubConnAvailable을 리턴해서
+gRPC가 새 피커가 만들어질 때까지 요청을 기다리게 한다.
+*/
+func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var result balancer.PickResult
+	if isWrite(info.FullMethodName) || len(p.followers) == 0 {
+		result.SubConn = p.leader
+	} else {
+		result.SubConn = p.nextFollower()
+	}
+	if result.SubConn == nil {
+		return result, balancer.ErrNoSubConnAvailable
+	}
+	return result, nil
+}
+
+// readOnly는 팔로워가 처리할 수 있는, 복제된 로그를 읽기만 하는 요청의 메서드 이름이다.
+var readOnly = map[string]bool{
+	"Consume":       true,
+	"ConsumeStream": true,
+	"ConsumeBatch":  true,
+	"OffsetForTime": true,
+	"GetServers":    true,
+}
+
+// isWrite 함수는 리더에게 보내야 하는 요청인지를 리턴한다. method는 "/log.v1.Log/Consume" 형식의 전체 이름이다.
+func isWrite(method string) bool {
+	return !readOnly[method[strings.LastIndex(method, "/")+1:]]
+}
+
+func (p *Picker) nextFollower() balancer.SubConn {
+	cur := atomic.AddUint64(&p.current, uint64(1))
+	return p.followers[cur%uint64(len(p.followers))]
+}
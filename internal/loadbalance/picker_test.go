@@ -0,0 +1,128 @@
+package loadbalance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestPickerNoSubConnAvailable(t *testing.T) {
+	picker := (&Picker{}).Build(base.PickerBuildInfo{})
+	for _, method := range []string{
+		"/log.vX.Log/Produce",
+		"/log.vX.Log/Consume",
+	} {
+		info := balancer.PickInfo{
+			FullMethodName: method,
+		}
+		result, err := picker.Pick(info)
+		require.Equal(t, balancer.ErrNoSubConnAvailable, err)
+		require.Nil(t, result.SubConn)
+	}
+}
+
+func TestPickerWritesToLeader(t *testing.T) {
+	picker, subConns := setupPicker(3)
+	for _, method := range []string{
+		"/log.vX.Log/Produce",
+		"/log.vX.Log/ProduceStream",
+		"/log.vX.Log/ProduceBatch",
+		"/log.vX.Log/BeginTxn",
+		"/log.vX.Log/CommitTxn",
+		"/log.vX.Log/AbortTxn",
+		// 상태를 바꾸거나 한 서버가 관리하는 상태를 읽는 요청
+		"/log.vX.Log/InitProducer",
+		"/log.vX.Log/CreateTopic",
+		"/log.vX.Log/DeleteTopic",
+		"/log.vX.Log/ListTopics",
+		"/log.vX.Log/CommitOffset",
+		"/log.vX.Log/FetchCommittedOffset",
+		"/log.vX.Log/JoinGroup",
+		"/log.vX.Log/Heartbeat",
+		"/log.vX.Log/LeaveGroup",
+		// 모르는 요청
+		"/log.vX.Log/Unknown",
+	} {
+		info := balancer.PickInfo{
+			FullMethodName: method,
+		}
+		for i := 0; i < 5; i++ {
+			gotPick, err := picker.Pick(info)
+			require.NoError(t, err)
+			require.Equal(t, subConns[0], gotPick.SubConn)
+		}
+	}
+}
+
+func TestPickerConsumesFromFollowers(t *testing.T) {
+	picker, subConns := setupPicker(3)
+	for _, method := range []string{
+		"/log.vX.Log/Consume",
+		"/log.vX.Log/ConsumeStream",
+		"/log.vX.Log/ConsumeBatch",
+		"/log.vX.Log/OffsetForTime",
+		"/log.vX.Log/GetServers",
+	} {
+		info := balancer.PickInfo{
+			FullMethodName: method,
+		}
+		// 팔로워들에게 돌아가면서 보낸다.
+		picked := map[balancer.SubConn]int{}
+		for i := 0; i < 4; i++ {
+			pick, err := picker.Pick(info)
+			require.NoError(t, err)
+			require.NotEqual(t, subConns[0], pick.SubConn)
+			picked[pick.SubConn]++
+		}
+		require.Equal(t, map[balancer.SubConn]int{
+			subConns[1]: 2,
+			subConns[2]: 2,
+		}, picked)
+	}
+}
+
+// 팔로워가 없다면 소비 요청도 리더에게 보낸다.
+func TestPickerConsumesFromLeaderWithoutFollowers(t *testing.T) {
+	picker, subConns := setupPicker(1)
+	pick, err := picker.Pick(balancer.PickInfo{
+		FullMethodName: "/log.vX.Log/Consume",
+	})
+	require.NoError(t, err)
+	require.Equal(t, subConns[0], pick.SubConn)
+}
+
+// setupPicker 함수는 count개의 연결로 피커를 만든다. 첫 번째 연결이 리더이다.
+func setupPicker(count int) (balancer.Picker, []balancer.SubConn) {
+	var subConns []balancer.SubConn
+	buildInfo := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo),
+	}
+	for i := 0; i < count; i++ {
+		sc := &subConn{}
+		addr := resolver.Address{
+			Attributes: attributes.New(isLeaderAttr, i == 0),
+		}
+		// 0번째 연결이 리더이다.
+		sc.UpdateAddresses([]resolver.Address{addr})
+		buildInfo.ReadySCs[sc] = base.SubConnInfo{Address: addr}
+		subConns = append(subConns, sc)
+	}
+	picker := (&Picker{}).Build(buildInfo)
+	return picker, subConns
+}
+
+// subConn은 balancer.SubConn을 구현하는 테스트용 연결이다.
+type subConn struct {
+	balancer.SubConn
+	addrs []resolver.Address
+}
+
+func (s *subConn) UpdateAddresses(addrs []resolver.Address) {
+	s.addrs = addrs
+}
+
+func (s *subConn) Connect() {}
@@ -0,0 +1,151 @@
+package loadbalance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+/*
+클라이언트가 서버 하나의 주소로만 연결하면 그 서버가 리더가 아닐 때 생산할 수 없고, 모든 소비 요청이 한 서버에 몰린다.
+gRPC는 클라이언트 측 로드 밸런싱을 리졸버(resolver)와 피커(picker)로 나눈다.
+  - 리졸버는 타깃 주소를 서버들의 주소 목록으로 바꾼다. 서버 목록이 바뀌면 gRPC에 알린다.
+  - 피커는 RPC마다 어느 서버로 보낼지 고른다.
+
+Resolver는 "proglog" 스킴의 리졸버이다. "proglog:///<서버 주소>"로 연결하면 그 서버에 GetServers를 요청해서 클러스터의 서버 목록을 받고,
+각 서버가 리더인지를 주소의 속성(isLeaderAttr)으로 피커에게 전달한다.
+서버와의 연결이 끊기면 gRPC가 ResolveNow를 호출하므로 서버 목록을 다시 받는다.
+*/
+type Resolver struct {
+	clientConn    resolver.ClientConn
+	resolverConn  *grpc.ClientConn
+	serviceConfig *serviceconfig.ParseResult
+	logger        *log.Logger
+
+	resolve chan struct{}
+	// ctx는 리졸버를 닫으면 취소되어 진행 중인 GetServers 요청을 멈춘다.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ resolver.Builder = (*Resolver)(nil)
+
+// Name은 리졸버의 스킴이자 밸런서의 이름이다.
+const Name = "proglog"
+
+// isLeaderAttr는 주소가 리더 서버인지를 담는 속성의 키이다.
+const isLeaderAttr = "is_leader"
+
+// resolveTimeout은 GetServers 요청 하나를 기다리는 최대 시간이다.
+const resolveTimeout = 5 * time.Second
+
+func init() {
+	resolver.Register(&Resolver{})
+}
+
+// Scheme 메서드는 리졸버의 스킴을 리턴한다. gRPC는 타깃 주소의 스킴으로 리졸버를 찾는다.
+func (r *Resolver) Scheme() string {
+	return Name
+}
+
+/*
+Build 메서드는 타깃 주소마다 새 리졸버를 만든다. 리졸버는 클라이언트와 같은 자격 증명으로 타깃 서버에 연결하고,
+서비스 설정으로 proglog 밸런서를 사용하게 한다. 서버 목록은 백그라운드 고루틴에서 받는다.
+*/
+func (r *Resolver) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	var dialOpts []grpc.DialOption
+	if opts.DialCreds != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.DialCreds))
+	}
+	resolverConn, err := grpc.NewClient(target.Endpoint(), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res := &Resolver{
+		clientConn:   cc,
+		resolverConn: resolverConn,
+		serviceConfig: cc.ParseServiceConfig(
+			fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, Name),
+		),
+		logger:  log.New(os.Stderr, "resolver: ", log.LstdFlags),
+		resolve: make(chan struct{}, 1),
+	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	res.wg.Add(1)
+	go res.run()
+	res.ResolveNow(resolver.ResolveNowOptions{})
+	return res, nil
+}
+
+// ResolveNow 메서드는 서버 목록을 다시 받으라고 알린다. gRPC가 여러 번 동시에 호출할 수 있으므로 요청을 하나로 합친다.
+func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolve <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Resolver) run() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.resolve:
+			r.resolveServers()
+		}
+	}
+}
+
+// resolveServers 메서드는 GetServers로 받은 서버 목록을 gRPC에 알린다. 실패하면 에러를 알려서 gRPC가 다시 시도하게 한다.
+func (r *Resolver) resolveServers() {
+	ctx, cancel := context.WithTimeout(r.ctx, resolveTimeout)
+	defer cancel()
+	client := api.NewLogClient(r.resolverConn)
+	res, err := client.GetServers(ctx, &api.GetServersRequest{})
+	if err != nil {
+		if r.ctx.Err() != nil {
+			// 리졸버를 닫았다.
+			return
+		}
+		r.logger.Printf("failed to resolve servers: %v", err)
+		r.clientConn.ReportError(err)
+		return
+	}
+	var addrs []resolver.Address
+	for _, server := range res.Servers {
+		// RPC 주소를 아직 모르는 서버에는 연결할 수 없다.
+		if server.RpcAddr == "" {
+			continue
+		}
+		addrs = append(addrs, resolver.Address{
+			Addr:       server.RpcAddr,
+			Attributes: attributes.New(isLeaderAttr, server.IsLeader),
+		})
+	}
+	if err = r.clientConn.UpdateState(resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: r.serviceConfig,
+	}); err != nil {
+		r.logger.Printf("failed to update state: %v", err)
+	}
+}
+
+// Close 메서드는 서버 목록을 받는 고루틴을 멈추고 타깃 서버와의 연결을 닫는다.
+func (r *Resolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+	if err := r.resolverConn.Close(); err != nil {
+		r.logger.Printf("failed to close conn: %v", err)
+	}
+}
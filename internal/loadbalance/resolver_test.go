@@ -0,0 +1,196 @@
+package loadbalance
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/config"
+	"github.com/sodami-hub/proglog/internal/log"
+	"github.com/sodami-hub/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+세 서버를 띄우고 각 서버의 로그에 서버를 구분하는 레코드를 하나씩 넣는다. 서버들은 같은 getServers를 공유하므로 모두 같은 서버 목록을 알려준다.
+클라이언트는 "proglog:///<팔로워 주소>"로 연결하지만 생산 요청은 리더에게, 소비 요청은 팔로워들에게 간다.
+*/
+func TestResolver(t *testing.T) {
+	cluster := setupCluster(t, 3)
+
+	conn := dial(t, cluster.servers[1].addr)
+	client := api.NewLogClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("produced")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.Offset)
+	record, err := cluster.servers[0].log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("produced"), record.Value)
+
+	// 팔로워들과의 연결이 모두 준비되어야 피커가 둘에게 돌아가면서 보낸다.
+	seen := map[string]bool{}
+	require.Eventually(t, func() bool {
+		res, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+		if err != nil {
+			return false
+		}
+		seen[string(res.Record.Value)] = true
+		return len(seen) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	consumed := map[string]int{}
+	for i := 0; i < 4; i++ {
+		res, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+		require.NoError(t, err)
+		consumed[string(res.Record.Value)]++
+	}
+	require.Equal(t, map[string]int{"server 1": 2, "server 2": 2}, consumed)
+}
+
+// 리더와의 연결이 끊기면 서버 목록을 다시 받아서 새 리더에게 생산 요청을 보낸다.
+func TestResolverRefreshOnFailure(t *testing.T) {
+	cluster := setupCluster(t, 3)
+
+	conn := dial(t, cluster.servers[1].addr)
+	client := api.NewLogClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("to leader 0")},
+	})
+	require.NoError(t, err)
+
+	// 0번 서버가 죽고 1번 서버가 리더가 되었다.
+	cluster.getServers.set([]*api.Server{
+		{Id: "1", RpcAddr: cluster.servers[1].addr, IsLeader: true},
+		{Id: "2", RpcAddr: cluster.servers[2].addr},
+		// RPC 주소를 아직 모르는 서버는 건너뛴다.
+		{Id: "3"},
+	})
+	cluster.servers[0].gsrv.Stop()
+
+	require.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("to leader 1")},
+		})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	record, err := cluster.servers[1].log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("to leader 1"), record.Value)
+}
+
+type testServer struct {
+	addr string
+	log  *log.Log
+	gsrv *grpc.Server
+}
+
+type testCluster struct {
+	servers    []*testServer
+	getServers *getServers
+}
+
+// setupCluster 함수는 루프백 주소에 mTLS gRPC 서버 count개를 띄운다. 0번 서버가 리더이다.
+func setupCluster(t *testing.T, count int) *testCluster {
+	t.Helper()
+	cluster := &testCluster{getServers: &getServers{}}
+	var servers []*api.Server
+	for i := 0; i < count; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile:      config.ServerCertFile,
+			KeyFile:       config.ServerKeyFile,
+			CAFile:        config.CAFile,
+			ServerAddress: ln.Addr().String(),
+			Server:        true,
+		})
+		require.NoError(t, err)
+
+		dir, err := os.MkdirTemp("", "loadbalance-test")
+		require.NoError(t, err)
+		clog, err := log.NewLog(dir, log.Config{})
+		require.NoError(t, err)
+		_, err = clog.Append(&api.Record{Value: []byte(fmt.Sprintf("server %d", i))})
+		require.NoError(t, err)
+
+		gsrv, err := server.NewGRPCServer(&server.Config{
+			CommitLog:   clog,
+			Authorizer:  auth.New(config.ACLModelFile, config.ACLPolicyFile),
+			GetServerer: cluster.getServers,
+		}, grpc.Creds(credentials.NewTLS(serverTLSConfig)))
+		require.NoError(t, err)
+		go gsrv.Serve(ln)
+
+		t.Cleanup(func() {
+			gsrv.Stop()
+			require.NoError(t, clog.Remove())
+		})
+		cluster.servers = append(cluster.servers, &testServer{
+			addr: ln.Addr().String(),
+			log:  clog,
+			gsrv: gsrv,
+		})
+		servers = append(servers, &api.Server{
+			Id:       fmt.Sprintf("%d", i),
+			RpcAddr:  ln.Addr().String(),
+			IsLeader: i == 0,
+		})
+	}
+	cluster.getServers.set(servers)
+	return cluster
+}
+
+// dial 함수는 루트 클라이언트 인증서로 proglog 스킴의 타깃에 연결한다.
+func dial(t *testing.T, addr string) *grpc.ClientConn {
+	t.Helper()
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.RootClientCertFile,
+		KeyFile:  config.RootClientKeyFile,
+		CAFile:   config.CAFile,
+		Server:   false,
+	})
+	require.NoError(t, err)
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:///%s", Name, addr),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// getServers는 테스트에서 정한 서버 목록을 알려주는 server.GetServerer이다.
+type getServers struct {
+	mu      sync.Mutex
+	servers []*api.Server
+}
+
+func (s *getServers) set(servers []*api.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.servers = servers
+}
+
+func (s *getServers) GetServers() ([]*api.Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers, nil
+}
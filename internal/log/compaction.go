@@ -0,0 +1,193 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+/*
+로그 압축(compaction)은 봉인된(활성 세그먼트가 아닌) 세그먼트를 다시 써서 키마다 마지막 레코드만 남긴다.
+로그를 상태 테이블의 변경 이력(changelog)으로 쓸 때, 로그가 끝없이 커지지 않게 해준다.
+  - 키가 없는 레코드는 압축할 수 없으므로 그대로 남긴다.
+  - 키가 있고 값이 비어있는 레코드는 툼스톤이다. 키의 마지막 레코드가 툼스톤이고 Compaction.TombstoneRetention보다
+    오래되었다면 툼스톤도 지운다. 그 전까지는 소비자가 키가 지워졌다는 것을 알 수 있도록 남겨둔다.
+  - 중단한 트랜잭션의 레코드는 지운다. 열려있는 트랜잭션의 레코드는 중단될 수 있으므로 키의 마지막 레코드로 보지 않고 그대로 남긴다.
+  - 레코드의 오프셋은 바뀌지 않는다. 그래서 압축한 세그먼트는 오프셋 사이에 빈 곳이 생기며, Read는 빈 곳을 건너뛴다.
+
+세그먼트는 임시 디렉터리(compactDir)에 새로 쓴 후 파일을 바꿔치기한다. 인덱스는 스토어로부터 다시 만들 수 있으므로
+.offset과 .timeindex를 먼저 지우고 스토어 파일을 rename으로 바꾼다. 중간에 멈추더라도 다음에 시작할 때
+인덱스 파일이 없는 세그먼트는 스토어(압축 전 또는 압축 후)로부터 인덱스를 다시 만들기 때문에 안전하다.
+*/
+
+// 압축한 세그먼트를 쓰는 임시 디렉터리의 이름. Log를 시작할 때 남아있다면 지운다.
+const compactDir = ".compact"
+
+// Compact 메서드는 봉인된 세그먼트들을 압축한다. Compaction.Enabled와 상관없이 호출할 수 있다.
+func (l *Log) Compact() error {
+	return l.compact(time.Now())
+}
+
+func (l *Log) compact(now time.Time) error {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
+
+	l.mu.Lock()
+	sealed := append([]*segment(nil), l.segments[:len(l.segments)-1]...)
+	active := l.activeSegment
+	// 트랜잭션의 상태는 지금의 것으로 판단한다. 그래서 지금보다 나중에 추가된 레코드는 보지 않는다.
+	next := active.nextOffset
+	open := make(map[uint64]bool, len(l.txns.open))
+	for id := range l.txns.open {
+		open[id] = true
+	}
+	aborted := make(map[uint64]bool, len(l.txns.aborted))
+	for id := range l.txns.aborted {
+		aborted[id] = true
+	}
+	l.mu.Unlock()
+	if len(sealed) == 0 {
+		return nil
+	}
+
+	// 키마다 마지막 레코드의 오프셋을 구한다. 봉인된 세그먼트는 바뀌지 않으므로 l.mu 없이 읽고,
+	// 활성 세그먼트는 Append와 겹치지 않도록 l.mu를 잡고 읽는다.
+	latest := make(map[string]uint64)
+	track := func(record *api.Record) (bool, error) {
+		if record.Offset >= next {
+			return false, nil
+		}
+		if len(record.Key) > 0 && !open[record.TxnId] && !aborted[record.TxnId] {
+			latest[string(record.Key)] = record.Offset
+		}
+		return true, nil
+	}
+	for _, s := range sealed {
+		if err := s.scan(s.baseOffset, track); err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	err := active.scan(active.baseOffset, track)
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	keep := func(record *api.Record) bool {
+		if record.Control == api.ControlType_CONTROL_NONE && aborted[record.TxnId] {
+			return false
+		}
+		if len(record.Key) == 0 || open[record.TxnId] {
+			return true
+		}
+		if latest[string(record.Key)] != record.Offset {
+			return false
+		}
+		if len(record.Value) == 0 {
+			return now.Sub(record.Timestamp.AsTime()) <= l.Config.Compaction.TombstoneRetention
+		}
+		return true
+	}
+	for _, s := range sealed {
+		if err := l.compactSegment(s, keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactSegment 메서드는 keep이 true인 레코드만 남긴 세그먼트를 새로 써서 s를 대신한다. 지울 레코드가 없다면 아무것도 하지 않는다.
+func (l *Log) compactSegment(s *segment, keep func(*api.Record) bool) error {
+	dirty := false
+	if err := s.scan(s.baseOffset, func(record *api.Record) (bool, error) {
+		dirty = !keep(record)
+		return !dirty, nil
+	}); err != nil || !dirty {
+		return err
+	}
+
+	tmp := filepath.Join(l.Dir, compactDir)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	ns, err := newSegment(tmp, s.baseOffset, l.Config)
+	if err != nil {
+		return err
+	}
+	if err = s.scan(s.baseOffset, func(record *api.Record) (bool, error) {
+		if !keep(record) {
+			return true, nil
+		}
+		return true, ns.write(record)
+	}); err != nil {
+		ns.Close()
+		return err
+	}
+	if err = ns.store.Sync(); err != nil {
+		ns.Close()
+		return err
+	}
+	if err = ns.Close(); err != nil {
+		return err
+	}
+	// 보존 정책이 압축한 세그먼트를 새 세그먼트로 보지 않도록 수정 시각을 유지한다.
+	if err = os.Chtimes(ns.store.Name(), s.modified, s.modified); err != nil {
+		return err
+	}
+
+	// 인덱스 파일들을 먼저 지우고 스토어, 인덱스, 시간 인덱스 순서로 바꿔치기한다.
+	for _, name := range []string{s.index.Name(), s.timeIndex.Name()} {
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+	for _, ext := range []string{".store", ".offset", ".timeindex"} {
+		name := fmt.Sprintf("%d%s", s.baseOffset, ext)
+		if err = os.Rename(filepath.Join(tmp, name), filepath.Join(l.Dir, name)); err != nil {
+			return err
+		}
+	}
+	if ns, err = newSegment(l.Dir, s.baseOffset, l.Config); err != nil {
+		return err
+	}
+	ns.created, ns.modified = s.created, s.modified
+
+	l.mu.Lock()
+	for i, cur := range l.segments {
+		if cur == s {
+			l.segments[i] = ns
+			break
+		}
+	}
+	l.mu.Unlock()
+	// 이전 세그먼트의 파일들은 이미 지우거나 바꿨으므로 닫기만 한다.
+	return s.Close()
+}
+
+// startCompactor 메서드는 압축을 주기적으로 하는 고루틴을 시작한다.
+func (l *Log) startCompactor() {
+	if !l.Config.Compaction.Enabled {
+		return
+	}
+	l.wg.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.Config.Compaction.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 실패한 압축은 다음 주기에 다시 시도한다.
+				_ = l.Compact()
+			}
+		}
+	}(l.done)
+}
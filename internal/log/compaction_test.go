@@ -0,0 +1,85 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCompaction(t *testing.T) {
+	dir, err := os.MkdirTemp("", "compaction_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = entWidth * 4
+	c.Timestamp.ProducerSupplied = true
+	c.Compaction.TombstoneRetention = time.Hour
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+
+	now := time.Now()
+	old := timestamppb.New(now.Add(-2 * time.Hour))
+	records := []*api.Record{
+		{Key: []byte("a"), Value: []byte("a1")}, // 0 - a2가 대신한다.
+		{Key: []byte("b"), Value: []byte("b1")}, // 1 - 툼스톤이 대신한다.
+		{Value: []byte("no key")},               // 2 - 키가 없으므로 남는다.
+		{Key: []byte("a"), Value: []byte("a2"), Headers: map[string][]byte{"h": []byte("v")}}, // 3
+		{Key: []byte("b"), Timestamp: old},      // 4 - 오래된 툼스톤이므로 지운다.
+		{Key: []byte("c"), Value: []byte("c1")}, // 5 - 활성 세그먼트의 c2가 대신한다.
+		{Key: []byte("d")},                      // 6 - 최근 툼스톤이므로 남는다.
+		{Key: []byte("c"), Value: []byte("c2")}, // 7 - 활성 세그먼트
+	}
+	for _, record := range records {
+		_, err := log.Append(record)
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Compact())
+
+	want := []uint64{2, 3, 6, 7}
+	var got []uint64
+	for off := uint64(0); off < 8; {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		got = append(got, record.Offset)
+		off = record.Offset + 1
+	}
+	require.Equal(t, want, got)
+
+	record, err := log.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a2"), record.Value)
+	require.Equal(t, []byte("v"), record.Headers["h"])
+
+	// 다음 오프셋은 바뀌지 않고, 다시 열어도 빈 곳이 있는 오프셋을 그대로 읽는다.
+	off, err := log.Append(&api.Record{Value: []byte("next")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), off)
+	require.NoError(t, log.Close())
+
+	log, err = NewLog(dir, c)
+	require.NoError(t, err)
+	require.False(t, log.Recovery().Repaired())
+	record, err = log.Read(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), record.Offset)
+	off, err = log.OffsetForTime(now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+	require.NoError(t, log.Close())
+
+	// 압축한 세그먼트의 인덱스 파일이 없어도 레코드의 오프셋으로 인덱스를 다시 만든다.
+	require.NoError(t, os.Remove(log.segments[0].index.Name()))
+	log, err = NewLog(dir, c)
+	require.NoError(t, err)
+	require.True(t, log.Recovery().Segments[0].IndexRebuilt)
+	record, err = log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), record.Offset)
+	require.NoError(t, log.Close())
+}
@@ -1,9 +1,72 @@
 package log
 
+import (
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
 type Config struct {
+	// Raft는 DistributedLog의 설정이다. 단일 노드의 Log는 사용하지 않는다.
+	Raft struct {
+		raft.Config
+		// StreamLayer는 Raft 노드들이 서로 연결하는 네트워크 계층이다.
+		StreamLayer *StreamLayer
+		// Bootstrap이 true인 노드는 자기 자신만으로 클러스터를 시작한다. 클러스터의 첫 번째 노드만 설정한다.
+		Bootstrap bool
+		// RPCAddr는 이 노드의 gRPC 주소이다. Raft 주소(StreamLayer)와 다르며, GetServers가 클라이언트에게 알린다.
+		RPCAddr string
+	}
 	Segment struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
 		InitialOffset uint64
+		// 시간 인덱스에 항목을 쓰는 간격(스토어에 쓴 바이트 수)
+		TimeIndexIntervalBytes uint64
+	}
+	Timestamp struct {
+		// true면 생산자가 정한 Record.Timestamp를 그대로 쓴다. 비어있거나 false면 서버가 추가한 시각을 쓴다.
+		ProducerSupplied bool
+	}
+	// Durability는 Log.Append가 리턴하기 전에 레코드를 디스크에 얼마나 확실히 기록할지(fsync)를 정한다.
+	Durability struct {
+		Mode     DurabilityMode
+		Records  uint64        // DurabilityEveryRecords 모드에서 fsync 사이의 레코드 수
+		Interval time.Duration // DurabilityInterval 모드에서 fsync 주기
+	}
+	// Retention은 오래된 세그먼트를 지우는 보존 정책이다. 0인 항목은 사용하지 않는다.
+	// 활성 세그먼트는 지우지 않으며, 가장 오래된 세그먼트부터 통째로 지운다.
+	Retention struct {
+		MaxBytes      uint64        // 로그 전체(스토어+인덱스)의 최대 크기
+		MaxSegmentAge time.Duration // 세그먼트를 만든 후 보존하는 기간
+		MaxRecordAge  time.Duration // 세그먼트의 마지막 레코드를 쓴 후 보존하는 기간
+		CheckInterval time.Duration // 보존 정책을 확인하는 주기
+	}
+	// Compaction은 봉인된 세그먼트를 다시 써서 키마다 마지막 레코드만 남기는 로그 압축 설정이다.
+	Compaction struct {
+		Enabled            bool
+		TombstoneRetention time.Duration // 툼스톤(값이 빈 레코드)을 남겨두는 기간
+		Interval           time.Duration // 압축하는 주기
+	}
+	// Transaction은 트랜잭션 설정이다(txn.go).
+	Transaction struct {
+		Timeout       time.Duration // 시작한 후 이 기간이 지나도록 끝나지 않은 트랜잭션은 중단한다. 0이면 중단하지 않는다.
+		CheckInterval time.Duration // 타임아웃을 확인하는 주기
 	}
 }
+
+// DurabilityMode는 fsync 정책이다.
+type DurabilityMode int
+
+const (
+	// DurabilityNone 모드는 fsync를 하지 않는다. 운영체제가 알아서 디스크에 쓴다.
+	DurabilityNone DurabilityMode = iota
+	// DurabilityEveryRecords 모드는 Durability.Records 개의 레코드마다 fsync한다.
+	// fsync를 일으킨 Append는 fsync가 끝난 후에 리턴한다.
+	DurabilityEveryRecords
+	// DurabilityInterval 모드는 백그라운드에서 Durability.Interval 마다 fsync한다.
+	DurabilityInterval
+	// DurabilityAlways 모드는 모든 Append가 fsync가 끝난 후에 리턴한다.
+	// 동시에 Append한 호출들은 한 번의 fsync를 함께 기다린다.(group commit)
+	DurabilityAlways
+)
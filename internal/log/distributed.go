@@ -0,0 +1,973 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+/*
+DistributedLog는 Raft로 복제하는 로그이다. Raft는 리더를 선출하고, 리더가 받은 명령을 팔로워들에게 복제해서
+과반수의 노드에 기록되면(커밋) 각 노드의 상태 머신(FSM)에 적용한다.
+
+Raft 인스턴스는 다음으로 구성된다.
+  - FSM(유한 상태 머신) : 커밋된 명령을 적용한다. 여기서는 레코드를 로컬 Log에 추가한다.
+  - 로그 저장소 : Raft가 복제할 명령을 저장한다. 이것도 Log를 사용한다.(logStore)
+  - 안정 저장소 : 현재 임기(term)나 투표한 후보와 같은 Raft의 메타데이터를 저장한다. Bolt를 사용한다.
+  - 스냅숏 저장소 : 로그 저장소가 끝없이 커지지 않도록 상태의 스냅숏을 저장한다. 스냅숏은 Log.Reader()로 만든다.
+  - 전송 계층 : Raft 노드들을 연결한다.(StreamLayer)
+
+디렉터리 구조
+  - dataDir/log : 복제된 레코드(상태)
+  - dataDir/raft/log : Raft의 로그 저장소
+  - dataDir/raft/stable : 안정 저장소
+  - dataDir/raft/snapshots : 스냅숏
+*/
+type DistributedLog struct {
+	config  Config
+	log     *Log
+	raftLog *logStore
+	// stable은 안정 저장소이다. Bolt 파일에 잠금을 걸고 있으므로 Close에서 닫아야 같은 디렉터리를 다시 열 수 있다.
+	stable *raftboltdb.BoltStore
+	raft   *raft.Raft
+	// progress는 리더가 팔로워들의 복제 진행 상황을 추적한다.
+	progress *progress
+
+	// rpcAddrs는 Join으로 알게 된 노드들의 gRPC 주소이다. Raft 설정에는 Raft 주소만 있으므로 따로 기억한다.
+	mu       sync.Mutex
+	rpcAddrs map[raft.ServerID]string
+}
+
+func NewDistributedLog(dataDir string, config Config) (*DistributedLog, error) {
+	l := &DistributedLog{
+		config:   config,
+		progress: newProgress(),
+		rpcAddrs: map[raft.ServerID]string{
+			config.Raft.LocalID: config.Raft.RPCAddr,
+		},
+	}
+	if err := l.setupLog(dataDir); err != nil {
+		return nil, err
+	}
+	if err := l.setupRaft(dataDir); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// setupLog 메서드는 복제된 레코드를 저장할 로컬 로그를 만든다.
+// 레코드의 타임스탬프는 리더가 정해서 복제하므로 모든 노드가 같은 값을 그대로 저장한다.
+func (l *DistributedLog) setupLog(dataDir string) error {
+	logDir := filepath.Join(dataDir, "log")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return err
+	}
+	config := l.config
+	config.Timestamp.ProducerSupplied = true
+	// 로컬 로그가 스스로 ABORT 마커를 추가하면 노드마다 오프셋이 달라지므로 트랜잭션 타임아웃을 쓰지 않는다.
+	// 트랜잭션의 마커는 모두 Append로 Raft를 거쳐서 추가된다.
+	config.Transaction.Timeout = 0
+	var err error
+	l.log, err = NewLog(logDir, config)
+	return err
+}
+
+func (l *DistributedLog) setupRaft(dataDir string) error {
+	applied, err := lastAppliedIndex(l.log)
+	if err != nil {
+		return err
+	}
+	fsm := &fsm{log: l.log, progress: l.progress, applied: applied}
+
+	logDir := filepath.Join(dataDir, "raft", "log")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return err
+	}
+	// Raft의 로그는 인덱스가 1부터 시작하고, Raft가 스냅숏을 찍은 후에 직접 지운다.
+	logConfig := Config{}
+	logConfig.Segment = l.config.Segment
+	logConfig.Segment.InitialOffset = 1
+	logConfig.Durability = l.config.Durability
+	l.raftLog, err = newLogStore(logDir, logConfig)
+	if err != nil {
+		return err
+	}
+
+	l.stable, err = raftboltdb.NewBoltStore(
+		filepath.Join(dataDir, "raft", "stable"),
+	)
+	if err != nil {
+		return err
+	}
+
+	retain := 1
+	snapshotStore, err := raft.NewFileSnapshotStore(
+		filepath.Join(dataDir, "raft"),
+		retain,
+		os.Stderr,
+	)
+	if err != nil {
+		return err
+	}
+
+	maxPool := 5
+	timeout := 10 * time.Second
+	transport := &progressTransport{
+		NetworkTransport: raft.NewNetworkTransport(
+			l.config.Raft.StreamLayer,
+			maxPool,
+			timeout,
+			os.Stderr,
+		),
+		progress: l.progress,
+	}
+
+	config := raft.DefaultConfig()
+	config.LocalID = l.config.Raft.LocalID
+	if l.config.Raft.HeartbeatTimeout != 0 {
+		config.HeartbeatTimeout = l.config.Raft.HeartbeatTimeout
+	}
+	if l.config.Raft.ElectionTimeout != 0 {
+		config.ElectionTimeout = l.config.Raft.ElectionTimeout
+	}
+	if l.config.Raft.LeaderLeaseTimeout != 0 {
+		config.LeaderLeaseTimeout = l.config.Raft.LeaderLeaseTimeout
+	}
+	if l.config.Raft.CommitTimeout != 0 {
+		config.CommitTimeout = l.config.Raft.CommitTimeout
+	}
+	if l.config.Raft.SnapshotThreshold != 0 {
+		config.SnapshotThreshold = l.config.Raft.SnapshotThreshold
+	}
+	if l.config.Raft.SnapshotInterval != 0 {
+		config.SnapshotInterval = l.config.Raft.SnapshotInterval
+	}
+	if l.config.Raft.TrailingLogs != 0 {
+		config.TrailingLogs = l.config.Raft.TrailingLogs
+	}
+	if l.config.Raft.Logger != nil {
+		config.Logger = l.config.Raft.Logger
+	}
+
+	l.raft, err = raft.NewRaft(
+		config,
+		fsm,
+		l.raftLog,
+		l.stable,
+		snapshotStore,
+		transport,
+	)
+	if err != nil {
+		return err
+	}
+
+	hasState, err := raft.HasExistingState(
+		l.raftLog,
+		l.stable,
+		snapshotStore,
+	)
+	if err != nil {
+		return err
+	}
+	if l.config.Raft.Bootstrap && !hasState {
+		config := raft.Configuration{
+			Servers: []raft.Server{{
+				ID:      config.LocalID,
+				Address: transport.LocalAddr(),
+			}},
+		}
+		err = l.raft.BootstrapCluster(config).Error()
+	}
+	return err
+}
+
+/*
+Append 메서드는 레코드를 로그에 추가하라는 명령을 Raft에 적용한다. 리더만 호출할 수 있고,
+과반수의 노드에 복제되어 커밋된 후에 리더의 FSM이 추가한 오프셋을 리턴한다.
+타임스탬프는 리더가 정해서 명령에 담으므로 모든 노드의 레코드가 같은 타임스탬프를 가진다.
+*/
+func (l *DistributedLog) Append(record *api.Record) (uint64, error) {
+	l.stamp(record)
+	res, err := l.apply(
+		AppendRequestType,
+		&api.ProduceRequest{Record: record},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.ProduceResponse).Offset, nil
+}
+
+// AppendBatch 메서드는 배치를 하나의 Raft 명령으로 복제한다. 모든 노드에서 배치 전체가 연속한 오프셋으로 추가된다.
+func (l *DistributedLog) AppendBatch(records []*api.Record) (uint64, error) {
+	if len(records) == 0 {
+		return 0, ErrEmptyBatch
+	}
+	for _, record := range records {
+		l.stamp(record)
+	}
+	res, err := l.apply(
+		AppendBatchRequestType,
+		&api.ProduceBatchRequest{Records: records},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.ProduceBatchResponse).FirstOffset, nil
+}
+
+// stamp 메서드는 Log.Append와 같은 규칙으로 레코드의 타임스탬프를 정한다.
+func (l *DistributedLog) stamp(record *api.Record) {
+	if record.Timestamp == nil || !l.config.Timestamp.ProducerSupplied {
+		record.Timestamp = timestamppb.Now()
+	}
+}
+
+/*
+apply 메서드는 요청의 종류를 나타내는 1바이트 뒤에 요청을 직렬화해서 Raft에 적용한다.
+Raft가 명령을 복제하고 커밋하면 FSM의 Apply가 리턴한 값이 응답이 된다. FSM이 에러를 리턴했다면 그 에러를 리턴한다.
+*/
+func (l *DistributedLog) apply(reqType RequestType, req proto.Message) (interface{}, error) {
+	var buf bytes.Buffer
+	_, err := buf.Write([]byte{byte(reqType)})
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	_, err = buf.Write(b)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+	future := l.raft.Apply(buf.Bytes(), timeout)
+	if future.Error() != nil {
+		return nil, future.Error()
+	}
+	res := future.Response()
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+/*
+읽기는 Raft를 거치지 않고 이 노드의 로컬 로그에서 바로 읽는다. 따라서 팔로워에서 읽으면 아직 복제되지 않은 최신 레코드는 보이지 않을 수 있다.(relaxed consistency)
+모든 읽기가 최신 레코드를 봐야 한다면 리더를 거쳐야 하지만, 그만큼 읽기 성능을 잃는다.
+*/
+func (l *DistributedLog) Read(offset uint64) (*api.Record, error) {
+	record, err := l.log.Read(offset)
+	if err != nil {
+		return nil, err
+	}
+	delete(record.Headers, raftIndexHeader)
+	return record, nil
+}
+
+func (l *DistributedLog) ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	records, err := l.log.ReadRange(from, maxRecords, maxBytes)
+	for _, record := range records {
+		delete(record.Headers, raftIndexHeader)
+	}
+	return records, err
+}
+
+func (l *DistributedLog) OffsetForTime(t time.Time) (uint64, error) {
+	return l.log.OffsetForTime(t)
+}
+
+// Wait 메서드는 이 노드에 off 오프셋의 레코드가 적용될 때까지 기다린다.
+func (l *DistributedLog) Wait(ctx context.Context, off uint64) error {
+	return l.log.Wait(ctx, off)
+}
+
+// 트랜잭션의 상태는 FSM이 로컬 로그에 마커를 추가하면서 모든 노드에서 같게 만들어진다.
+func (l *DistributedLog) LastStableOffset() uint64 {
+	return l.log.LastStableOffset()
+}
+
+func (l *DistributedLog) Aborted(txnID uint64) bool {
+	return l.log.Aborted(txnID)
+}
+
+func (l *DistributedLog) WaitStable(ctx context.Context, off uint64) error {
+	return l.log.WaitStable(ctx, off)
+}
+
+/*
+Join 메서드는 id의 노드를 Raft 주소 addr로 클러스터에 투표자로 추가한다. 투표자를 추가하는 것은 리더만 할 수 있다.
+rpcAddr는 노드의 gRPC 주소이며 GetServers가 알린다. 리더가 바뀌어도 새 리더가 알 수 있도록, 멤버십(Serf)은 모든 노드의 Join을 호출하고
+팔로워도 주소를 기억한다. 그래서 팔로워는 주소를 기억한 후에 리더가 아니라는 에러를 리턴한다.
+*/
+func (l *DistributedLog) Join(id, addr, rpcAddr string) error {
+	l.mu.Lock()
+	l.rpcAddrs[raft.ServerID(id)] = rpcAddr
+	l.mu.Unlock()
+
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+	serverID := raft.ServerID(id)
+	serverAddr := raft.ServerAddress(addr)
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == serverID || srv.Address == serverAddr {
+			if srv.ID == serverID && srv.Address == serverAddr {
+				// 이미 클러스터에 있는 노드이다.
+				return nil
+			}
+			// ID나 주소 중 하나만 같다면 기존 노드를 제거한다.
+			removeFuture := l.raft.RemoveServer(srv.ID, 0, 0)
+			if err := removeFuture.Error(); err != nil {
+				return err
+			}
+		}
+	}
+	addFuture := l.raft.AddVoter(serverID, serverAddr, 0, 0)
+	if err := addFuture.Error(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Leave 메서드는 id의 노드를 클러스터에서 제거한다. 리더만 호출할 수 있다.
+func (l *DistributedLog) Leave(id string) error {
+	l.mu.Lock()
+	delete(l.rpcAddrs, raft.ServerID(id))
+	l.mu.Unlock()
+	removeFuture := l.raft.RemoveServer(raft.ServerID(id), 0, 0)
+	return removeFuture.Error()
+}
+
+/*
+GetServers 메서드는 Raft 설정에서 클러스터의 서버 목록을 읽어서 각 서버가 리더인지와 복제 진행 상황을 함께 리턴한다. server.GetServerer 인터페이스를 구현한다.
+클라이언트는 RPC 주소로 gRPC 연결을 맺으므로 Raft 주소가 아니라 Join으로 알게 된 gRPC 주소를 알린다. 아직 모르는 서버의 RPC 주소는 비어있다.
+
+자신의 진행 상황은 로컬 로그로 알 수 있다. 팔로워들의 진행 상황은 이 노드가 리더일 때만 progress로 계산한다.
+*/
+func (l *DistributedLog) GetServers() ([]*api.Server, error) {
+	future := l.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	_, leaderID := l.raft.LeaderWithID()
+	localID := l.config.Raft.LocalID
+	isLeader := leaderID == localID
+	localNext := l.log.nextOffset()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var servers []*api.Server
+	for _, server := range future.Configuration().Servers {
+		srv := &api.Server{
+			Id:       string(server.ID),
+			RpcAddr:  l.rpcAddrs[server.ID],
+			IsLeader: server.ID == leaderID,
+		}
+		next, known := localNext, server.ID == localID
+		if !known && isLeader {
+			next, known = l.progress.nextOffset(server.ID)
+		}
+		if known {
+			srv.ProgressKnown = true
+			if next > 0 {
+				srv.HighestOffset = next - 1
+			}
+			if isLeader && next < localNext {
+				srv.Lag = localNext - next
+			}
+		}
+		servers = append(servers, srv)
+	}
+	return servers, nil
+}
+
+// WaitForLeader 메서드는 클러스터가 리더를 선출할 때까지 timeout만큼 기다린다.
+func (l *DistributedLog) WaitForLeader(timeout time.Duration) error {
+	timeoutc := time.After(timeout)
+	ticker := time.NewTicker(time.Second / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timeoutc:
+			return fmt.Errorf("timed out")
+		case <-ticker.C:
+			if l := l.raft.Leader(); l != "" {
+				return nil
+			}
+		}
+	}
+}
+
+// Close 메서드는 Raft 인스턴스를 멈추고 로컬 로그와 Raft의 로그 저장소, 안정 저장소를 닫는다.
+func (l *DistributedLog) Close() error {
+	f := l.raft.Shutdown()
+	if err := f.Error(); err != nil {
+		return err
+	}
+	if err := l.stable.Close(); err != nil {
+		return err
+	}
+	if err := l.raftLog.Close(); err != nil {
+		return err
+	}
+	return l.log.Close()
+}
+
+// RequestType은 Raft 명령의 종류이다. 명령의 첫 바이트에 저장한다.
+type RequestType uint8
+
+const (
+	AppendRequestType      RequestType = 0
+	AppendBatchRequestType RequestType = 1
+)
+
+var _ raft.FSM = (*fsm)(nil)
+
+/*
+fsm은 커밋된 명령을 로컬 로그에 적용한다. progress가 있다면 명령을 적용한 후의 다음 오프셋을 기록한다.
+
+Raft는 FSM이 어디까지 적용했는지 모르므로, 노드를 다시 시작하면 마지막 스냅숏 이후의 커밋된 로그를 모두 다시 적용한다.
+로컬 로그는 디스크에 남아있으므로 그대로 다시 추가하면 레코드가 중복된다. 그래서 레코드마다 명령의 Raft 인덱스를 헤더(raftIndexHeader)로
+함께 저장하고, 시작할 때 마지막 레코드의 인덱스(applied) 이하의 명령은 건너뛴다. 인덱스를 레코드와 같이 쓰므로 둘이 어긋나지 않는다.
+헤더는 DistributedLog의 읽기가 지우므로 소비자에게는 보이지 않는다.
+*/
+type fsm struct {
+	log      *Log
+	progress *progress
+	// applied는 로컬 로그에 적용한 마지막 명령의 Raft 인덱스이다.
+	applied uint64
+}
+
+// raftIndexHeader는 레코드를 추가한 명령의 Raft 인덱스를 저장하는 헤더이다.
+const raftIndexHeader = "raft-index"
+
+func (f *fsm) Apply(record *raft.Log) interface{} {
+	if f.progress != nil {
+		defer func() {
+			f.progress.apply(record.Index, f.log.nextOffset())
+		}()
+	}
+	if record.Index <= f.applied {
+		// 다시 시작한 후에 이미 적용한 명령을 다시 받았다.
+		return nil
+	}
+	f.applied = record.Index
+	buf := record.Data
+	reqType := RequestType(buf[0])
+	switch reqType {
+	case AppendRequestType:
+		return f.applyAppend(record.Index, buf[1:])
+	case AppendBatchRequestType:
+		return f.applyAppendBatch(record.Index, buf[1:])
+	}
+	return fmt.Errorf("unknown request type: %d", reqType)
+}
+
+// setRaftIndex 함수는 레코드에 레코드를 추가한 명령의 Raft 인덱스를 헤더로 붙인다.
+func setRaftIndex(record *api.Record, index uint64) {
+	if record.Headers == nil {
+		record.Headers = map[string][]byte{}
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, index)
+	record.Headers[raftIndexHeader] = b
+}
+
+/*
+lastAppliedIndex 함수는 로컬 로그의 마지막 레코드에 저장한 Raft 인덱스를 리턴한다. 레코드가 없거나 헤더가 없다면 0이다.
+압축이나 보존 정책이 레코드를 지웠을 수 있으므로 가장 최근 세그먼트부터 레코드가 남아있는 세그먼트를 찾는다.
+*/
+func lastAppliedIndex(l *Log) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.segments) - 1; i >= 0; i-- {
+		s := l.segments[i]
+		var last *api.Record
+		if err := s.scan(s.baseOffset, func(record *api.Record) (bool, error) {
+			last = record
+			return true, nil
+		}); err != nil {
+			return 0, err
+		}
+		if last == nil {
+			continue
+		}
+		if b := last.Headers[raftIndexHeader]; len(b) == 8 {
+			return binary.BigEndian.Uint64(b), nil
+		}
+		return 0, nil
+	}
+	return 0, nil
+}
+
+func (f *fsm) applyAppend(index uint64, b []byte) interface{} {
+	var req api.ProduceRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	setRaftIndex(req.Record, index)
+	offset, err := f.log.Append(req.Record)
+	if err != nil {
+		return err
+	}
+	return &api.ProduceResponse{Offset: offset}
+}
+
+func (f *fsm) applyAppendBatch(index uint64, b []byte) interface{} {
+	var req api.ProduceBatchRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	for _, record := range req.Records {
+		setRaftIndex(record, index)
+	}
+	first, err := f.log.AppendBatch(req.Records)
+	if err != nil {
+		return err
+	}
+	return &api.ProduceBatchResponse{
+		FirstOffset: first,
+		LastOffset:  first + uint64(len(req.Records)) - 1,
+	}
+}
+
+// Snapshot 메서드는 로그의 모든 스토어 파일을 차례로 읽는 io.Reader로 스냅숏을 만든다.
+// Raft는 Snapshot을 호출하는 동안 Apply를 하지 않고, Reader는 호출한 시점까지의 데이터만 읽으므로 스냅숏에는 그 시점의 상태만 담긴다.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	r := f.log.Reader()
+	return &snapshot{reader: r}, nil
+}
+
+var _ raft.FSMSnapshot = (*snapshot)(nil)
+
+type snapshot struct {
+	reader io.Reader
+}
+
+// Persist 메서드는 Raft가 스냅숏을 저장할 때 호출한다. 스냅숏 저장소가 준 sink에 스토어 파일들을 그대로 쓴다.
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := io.Copy(sink, s.reader); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
+
+/*
+Restore 메서드는 스냅숏으로 상태를 복원한다. 팔로워가 리더의 로그를 따라잡지 못했거나 노드를 다시 시작할 때 호출한다.
+로컬 로그를 비운 후 스냅숏의 레코드들을 원래의 오프셋 그대로 다시 쓴다.
+*/
+func (f *fsm) Restore(r io.ReadCloser) error {
+	defer r.Close()
+	if f.progress != nil {
+		f.progress.reset()
+	}
+	first := true
+	f.applied = 0
+	err := readSnapshot(r, func(record *api.Record) error {
+		if b := record.Headers[raftIndexHeader]; len(b) == 8 {
+			f.applied = binary.BigEndian.Uint64(b)
+		}
+		if first {
+			first = false
+			f.log.Config.Segment.InitialOffset = record.Offset
+			if err := f.log.Reset(); err != nil {
+				return err
+			}
+		}
+		return f.log.appendAt(record)
+	})
+	if err != nil || !first {
+		return err
+	}
+	// 빈 스냅숏이라면 로그를 비우기만 한다.
+	f.log.Config.Segment.InitialOffset = 0
+	return f.log.Reset()
+}
+
+/*
+readSnapshot 함수는 Log.Reader()로 만든 스냅숏에서 레코드들을 읽는다. 스냅숏은 세그먼트의 스토어 파일들을 이어 붙인 것이다.
+버전 1의 스토어 파일은 헤더로 시작하고 레코드는 [길이][체크섬][레코드] 형식이며, 헤더가 없는 기존 파일은 [길이][레코드] 형식이다.
+레코드의 길이는 매직의 첫 바이트(0xff)로 시작할 만큼 클 수 없으므로, 레코드가 시작할 자리에 매직이 있다면 다음 스토어 파일의 헤더이다.
+*/
+func readSnapshot(r io.Reader, fn func(*api.Record) error) error {
+	fw := uint64(lenWidth) // 헤더가 나오기 전까지는 기존 포맷이다.
+	b := make([]byte, lenWidth)
+	for {
+		_, err := io.ReadFull(r, b[:lenWidth])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 헤더와 레코드의 길이는 크기가 같으므로(8바이트) 읽은 8바이트가 헤더 전체이다.
+		if bytes.Equal(b[:len(storeMagic)], storeMagic) {
+			if version := enc.Uint16(b[len(storeMagic):]); version != storeVersion1 {
+				return fmt.Errorf("unsupported store version in snapshot: %d", version)
+			}
+			fw = lenWidth + crcWidth
+			continue
+		}
+		size := enc.Uint64(b[:lenWidth])
+		var crc []byte
+		if fw > lenWidth {
+			crc = make([]byte, crcWidth)
+			if _, err = io.ReadFull(r, crc); err != nil {
+				return err
+			}
+		}
+		p := make([]byte, size)
+		if _, err = io.ReadFull(r, p); err != nil {
+			return err
+		}
+		if crc != nil && enc.Uint32(crc) != checksum(b[:lenWidth], p) {
+			return errCorruptRecord
+		}
+		record := &api.Record{}
+		if err = proto.Unmarshal(p, record); err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+appendAt 메서드는 레코드를 레코드의 오프셋 그대로 추가한다. 스냅숏에는 압축으로 오프셋 사이에 빈 곳이 있을 수 있기 때문에
+스냅숏을 복원할 때 Append 대신 사용한다. 오프셋은 로그의 다음 오프셋 이상이어야 한다.
+Append처럼 멱등 프로듀서의 중복 제거 테이블과 트랜잭션의 상태에도 반영하므로, 복원한 로그도 복원 전에 추가한 레코드의 재전송을 걸러내고
+열려있던 트랜잭션과 중단한 트랜잭션을 안다.
+*/
+func (l *Log) appendAt(record *api.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if record.Offset < l.activeSegment.nextOffset {
+		return fmt.Errorf("offset %d is behind the log's next offset %d", record.Offset, l.activeSegment.nextOffset)
+	}
+	if l.activeSegment.IsMaxed() {
+		if err := l.sealed(l.activeSegment); err != nil {
+			return err
+		}
+		if err := l.newSegment(record.Offset); err != nil {
+			return err
+		}
+	}
+	if err := l.activeSegment.write(record); err != nil {
+		return err
+	}
+	l.producers.add(record)
+	l.txns.add(record)
+	l.notifyAppended()
+	return nil
+}
+
+/*
+truncateFrom 메서드는 off 이후의 레코드를 모두 지운다. Raft의 팔로워는 리더와 충돌하는 로그의 뒷부분을 지우고 리더의 로그로 다시 채운다.
+off를 포함한 세그먼트는 off 앞까지 잘라내고, 그 뒤의 세그먼트는 지운다.
+*/
+func (l *Log) truncateFrom(off uint64) error {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keep := len(l.segments)
+	for keep > 1 && l.segments[keep-1].baseOffset >= off {
+		keep--
+	}
+	for _, s := range l.segments[keep:] {
+		if err := s.Remove(); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[:keep]
+	l.activeSegment = l.segments[keep-1]
+
+	s := l.activeSegment
+	if s.nextOffset > off {
+		var rel uint32
+		if off > s.baseOffset {
+			rel = uint32(off - s.baseOffset)
+		}
+		n, err := s.index.find(rel)
+		if err != nil {
+			return err
+		}
+		_, pos, err := s.index.Read(int64(n))
+		if err != nil {
+			return err
+		}
+		next := off
+		if next < s.baseOffset {
+			next = s.baseOffset
+		}
+		if err = s.rollback(savepoint{
+			storeSize:  pos,
+			indexSize:  n * entWidth,
+			nextOffset: next,
+		}); err != nil {
+			return err
+		}
+		s.loadMaxTimestamp()
+	}
+
+	l.syncer.mu.Lock()
+	if l.syncer.synced > s.nextOffset {
+		l.syncer.synced = s.nextOffset
+	}
+	l.syncer.mu.Unlock()
+	return nil
+}
+
+var _ raft.LogStore = (*logStore)(nil)
+
+/*
+logStore는 Log를 Raft의 로그 저장소로 사용한다. Raft 로그의 인덱스가 레코드의 오프셋이 된다.
+Raft 로그의 임기(term)와 종류(type)는 레코드의 헤더에, 리더가 로그를 추가한 시각(AppendedAt)은 타임스탬프에 저장한다.
+*/
+type logStore struct {
+	*Log
+}
+
+const (
+	raftTermHeader = "raft-term"
+	raftTypeHeader = "raft-type"
+)
+
+// newLogStore 함수는 Raft의 로그 저장소를 만든다. 타임스탬프는 리더가 로그를 추가한 시각(AppendedAt)이므로 로그가 정하지 않고 그대로 저장한다.
+func newLogStore(dir string, c Config) (*logStore, error) {
+	c.Timestamp.ProducerSupplied = true
+	log, err := NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+	return &logStore{log}, nil
+}
+
+// FirstIndex와 LastIndex 메서드는 Raft 로그의 처음과 마지막 인덱스를 리턴한다. Raft 로그가 비어있다면 둘 다 0이다.
+func (l *logStore) FirstIndex() (uint64, error) {
+	if l.empty() {
+		return 0, nil
+	}
+	return l.LowestOffset()
+}
+
+func (l *logStore) LastIndex() (uint64, error) {
+	if l.empty() {
+		return 0, nil
+	}
+	return l.HighestOffset()
+}
+
+// empty 메서드는 Raft 로그가 비어있는지를 리턴한다. 비어있는 로그의 다음 오프셋은 처음 세그먼트의 베이스 오프셋이다.
+func (l *logStore) empty() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.activeSegment.nextOffset == l.segments[0].baseOffset
+}
+
+// GetLog 메서드는 index의 Raft 로그를 out에 채운다.
+func (l *logStore) GetLog(index uint64, out *raft.Log) error {
+	in, err := l.Read(index)
+	// 지운 로그라면 Raft는 ErrLogNotFound를 받아야 팔로워에게 로그 대신 스냅숏을 보낸다.
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		return raft.ErrLogNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// Log.Read는 빈 오프셋이면 다음 레코드를 리턴하지만 Raft 로그에는 빈 인덱스가 없다.
+	if in.Offset != index {
+		return raft.ErrLogNotFound
+	}
+	out.Index = in.Offset
+	out.Data = in.Value
+	out.Term = binary.BigEndian.Uint64(in.Headers[raftTermHeader])
+	out.Type = raft.LogType(in.Headers[raftTypeHeader][0])
+	if in.Timestamp != nil {
+		out.AppendedAt = in.Timestamp.AsTime()
+	}
+	return nil
+}
+
+func (l *logStore) StoreLog(record *raft.Log) error {
+	return l.StoreLogs([]*raft.Log{record})
+}
+
+// StoreLogs 메서드는 Raft 로그들을 한 번에 추가한다. Raft 로그의 인덱스와 추가될 오프셋이 같아야 한다.
+func (l *logStore) StoreLogs(records []*raft.Log) error {
+	batch := make([]*api.Record, len(records))
+	for i, record := range records {
+		term := make([]byte, 8)
+		binary.BigEndian.PutUint64(term, record.Term)
+		batch[i] = &api.Record{
+			Value: record.Data,
+			Headers: map[string][]byte{
+				raftTermHeader: term,
+				raftTypeHeader: {byte(record.Type)},
+			},
+		}
+		if !record.AppendedAt.IsZero() {
+			batch[i].Timestamp = timestamppb.New(record.AppendedAt)
+		}
+	}
+	next, err := l.nextIndex()
+	if err != nil {
+		return err
+	}
+	switch index := records[0].Index; {
+	case index < next:
+		// 덮어쓰는 로그가 있다면 먼저 지운다. 보통은 Raft가 DeleteRange로 먼저 지운다.
+		if err = l.truncateFrom(index); err != nil {
+			return err
+		}
+	case index > next:
+		// 스냅숏을 받은 후에는 로그가 스냅숏 다음 인덱스부터 이어진다. 빈 곳을 두고 원래의 인덱스에 쓴다.
+		for i, record := range batch {
+			record.Offset = records[i].Index
+			if err = l.appendAt(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	first, err := l.AppendBatch(batch)
+	if err != nil {
+		return err
+	}
+	if first != records[0].Index {
+		return fmt.Errorf("raft log index %d stored at offset %d", records[0].Index, first)
+	}
+	return nil
+}
+
+// nextIndex 메서드는 다음에 추가할 Raft 로그의 인덱스(로그의 다음 오프셋)를 리턴한다.
+func (l *logStore) nextIndex() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.activeSegment.nextOffset, nil
+}
+
+/*
+DeleteRange 메서드는 min부터 max까지의 Raft 로그를 지운다. Raft는 두 가지 경우에 호출한다.
+  - 스냅숏을 찍은 후에 오래된 로그를 지울 때 : 앞부분을 지우므로 max 이하의 레코드만 있는 세그먼트를 지운다.
+  - 팔로워의 로그가 리더와 충돌할 때 : min부터 마지막까지 뒷부분을 지운다.
+
+처음부터 마지막까지 모두 지운다면 세그먼트를 남길 수 없으므로 로그를 비우고 min부터 다시 시작한다. 그래야 FirstIndex와 LastIndex가
+모두 0이 되고, 이어서 저장하는 로그는 min(충돌) 또는 그 뒤의 인덱스(스냅숏 설치)에 쓸 수 있다.
+*/
+func (l *logStore) DeleteRange(min, max uint64) error {
+	first, err := l.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := l.LastIndex()
+	if err != nil {
+		return err
+	}
+	switch {
+	case last == 0 || min > last || max < first:
+		return nil
+	case min <= first && max >= last:
+		l.Config.Segment.InitialOffset = min
+		return l.Reset()
+	case max >= last:
+		return l.truncateFrom(min)
+	}
+	return l.Truncate(max)
+}
+
+// StreamLayer는 Raft 노드들을 연결하는 저수준의 스트림 계층이다. raft.StreamLayer 인터페이스를 구현한다.
+var _ raft.StreamLayer = (*StreamLayer)(nil)
+
+type StreamLayer struct {
+	ln              net.Listener
+	serverTLSConfig *tls.Config
+	peerTLSConfig   *tls.Config
+}
+
+func NewStreamLayer(
+	ln net.Listener,
+	serverTLSConfig,
+	peerTLSConfig *tls.Config,
+) *StreamLayer {
+	return &StreamLayer{
+		ln:              ln,
+		serverTLSConfig: serverTLSConfig,
+		peerTLSConfig:   peerTLSConfig,
+	}
+}
+
+// RaftRPC는 연결의 첫 바이트로, Raft 연결임을 확인한다. Raft는 gRPC와 다른 리스너를 쓰므로 클라이언트에게는 gRPC 주소(Config.Raft.RPCAddr)를 알린다.
+const RaftRPC = 1
+
+// Dial 메서드는 다른 Raft 노드에 연결한다. 첫 바이트로 Raft 연결임을 알린 후, 설정이 있다면 TLS로 감싼다.
+func (s *StreamLayer) Dial(
+	addr raft.ServerAddress,
+	timeout time.Duration,
+) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", string(addr))
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write([]byte{byte(RaftRPC)})
+	if err != nil {
+		return nil, err
+	}
+	if s.peerTLSConfig != nil {
+		conn = tls.Client(conn, s.peerTLSConfig)
+	}
+	return conn, err
+}
+
+// Accept 메서드는 들어온 연결의 첫 바이트가 RaftRPC인지 확인하고, 설정이 있다면 TLS 서버 연결로 감싼다.
+func (s *StreamLayer) Accept() (net.Conn, error) {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 1)
+	_, err = conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal([]byte{byte(RaftRPC)}, b) {
+		return nil, errors.New("not a raft rpc")
+	}
+	if s.serverTLSConfig != nil {
+		return tls.Server(conn, s.serverTLSConfig), nil
+	}
+	return conn, nil
+}
+
+func (s *StreamLayer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *StreamLayer) Addr() net.Addr {
+	return s.ln.Addr()
+}
@@ -0,0 +1,607 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// setupCluster 함수는 루프백 주소에 노드 count개의 클러스터를 만든다. 첫 번째 노드가 클러스터를 시작하고 나머지는 참여한다.
+func setupCluster(t *testing.T, count int) ([]*DistributedLog, []string) {
+	t.Helper()
+	var logs []*DistributedLog
+	var dirs []string
+	for i := 0; i < count; i++ {
+		l, dir := newNode(t, i, nil)
+		dirs = append(dirs, dir)
+		if i != 0 {
+			err := logs[0].Join(fmt.Sprintf("%d", i), l.config.Raft.StreamLayer.Addr().String(), l.config.Raft.RPCAddr)
+			require.NoError(t, err)
+		} else {
+			err := l.WaitForLeader(3 * time.Second)
+			require.NoError(t, err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, dirs
+}
+
+// newNode 함수는 루프백 주소에서 Raft 연결을 받는 노드를 만든다. 0번 노드가 클러스터를 시작한다.
+func newNode(t *testing.T, i int, fn func(*Config)) (*DistributedLog, string) {
+	t.Helper()
+	dataDir, err := os.MkdirTemp("", "distributed-log-test")
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	config := Config{}
+	config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+	config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+	// 테스트는 gRPC 서버를 띄우지 않는다. Raft 주소와 다른 주소이기만 하면 된다.
+	config.Raft.RPCAddr = fmt.Sprintf("node-%d:8400", i)
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.Raft.CommitTimeout = 5 * time.Millisecond
+	config.Raft.Logger = hclog.New(&hclog.LoggerOptions{
+		Level:  hclog.Error,
+		Output: os.Stderr,
+	})
+	if i == 0 {
+		config.Raft.Bootstrap = true
+	}
+	if fn != nil {
+		fn(&config)
+	}
+
+	l, err := NewDistributedLog(dataDir, config)
+	require.NoError(t, err)
+	return l, dataDir
+}
+
+// restartNode 함수는 노드를 닫고 같은 데이터 디렉터리와 같은 Raft 주소로 다시 연다.
+func restartNode(t *testing.T, l *DistributedLog, dataDir string) *DistributedLog {
+	t.Helper()
+	addr := l.config.Raft.StreamLayer.Addr().String()
+	require.NoError(t, l.Close())
+
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	config := l.config
+	config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l, err = NewDistributedLog(dataDir, config)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reopening the data directory did not return")
+	}
+	require.NoError(t, err)
+	require.NoError(t, l.WaitForLeader(3*time.Second))
+	return l
+}
+
+// requireReplicated 함수는 모든 노드가 records를 복제할 때까지 기다린다.
+func requireReplicated(t *testing.T, logs []*DistributedLog, records []*api.Record) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		for _, l := range logs {
+			for _, want := range records {
+				got, err := l.Read(want.Offset)
+				if err != nil {
+					return false
+				}
+				if !bytes.Equal(want.Value, got.Value) || want.Offset != got.Offset ||
+					!got.Timestamp.AsTime().Equal(want.Timestamp.AsTime()) {
+					return false
+				}
+			}
+		}
+		return true
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+// 닫은 노드의 데이터 디렉터리를 같은 프로세스에서 다시 열 수 있고, 다시 연 노드는 레코드를 중복해서 추가하지 않는다.
+func TestRestartNode(t *testing.T) {
+	l, dir := newNode(t, 0, nil)
+	defer os.RemoveAll(dir)
+	require.NoError(t, l.WaitForLeader(3*time.Second))
+
+	records := []*api.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+		{Value: []byte("third")},
+	}
+	for i, record := range records {
+		off, err := l.Append(record)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), off)
+	}
+
+	// Raft는 스냅숏이 없으면 커밋된 로그를 처음부터 다시 적용한다. 이미 적용한 로그는 다시 추가하지 않는다.
+	l = restartNode(t, l, dir)
+	defer l.Close()
+	highest, err := l.log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), highest)
+	for i, want := range records {
+		got, err := l.Read(uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, want.Value, got.Value)
+		// Raft 인덱스 헤더는 소비자에게 보이지 않는다.
+		require.Empty(t, got.Headers)
+	}
+	off, err := l.Append(&api.Record{Value: []byte("fourth")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func TestMultipleNodes(t *testing.T) {
+	logs, dirs := setupCluster(t, 3)
+	defer func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	records := []*api.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+	}
+	for i, record := range records {
+		off, err := logs[0].Append(record)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), off)
+		record.Offset = off
+	}
+	batch := []*api.Record{
+		{Value: []byte("third")},
+		{Value: []byte("fourth")},
+	}
+	first, err := logs[0].AppendBatch(batch)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), first)
+	for i, record := range batch {
+		record.Offset = first + uint64(i)
+	}
+	records = append(records, batch...)
+	requireReplicated(t, logs, records)
+
+	// 모든 노드가 같은 서버 목록을 알고, 0번 노드가 리더이다.
+	servers, err := logs[0].GetServers()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(servers))
+	for i, server := range servers {
+		require.Equal(t, fmt.Sprintf("%d", i), server.Id)
+		// Raft 주소가 아니라 gRPC 주소를 알린다.
+		require.Equal(t, logs[i].config.Raft.RPCAddr, server.RpcAddr)
+		require.Equal(t, i == 0, server.IsLeader)
+	}
+
+	// 노드가 클러스터를 떠나면 더 이상 복제하지 않는다.
+	require.NoError(t, logs[0].Leave("1"))
+	time.Sleep(50 * time.Millisecond)
+
+	off, err := logs[0].Append(&api.Record{Value: []byte("fifth")})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	record, err := logs[1].Read(off)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+	require.Nil(t, record)
+
+	record, err = logs[2].Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("fifth"), record.Value)
+	require.Equal(t, off, record.Offset)
+
+	servers, err = logs[0].GetServers()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(servers))
+
+	for _, l := range logs {
+		require.NoError(t, l.Close())
+	}
+}
+
+// 리더는 팔로워들이 복제한 가장 큰 오프셋과 뒤처진 레코드 수를 알려준다.
+func TestReplicationLag(t *testing.T) {
+	logs, dirs := setupCluster(t, 3)
+	defer func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	_, err := logs[0].AppendBatch([]*api.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+	})
+	require.NoError(t, err)
+	requireProgress(t, logs[0], map[string][2]uint64{
+		"0": {1, 0},
+		"1": {1, 0},
+		"2": {1, 0},
+	})
+
+	// 리더가 아닌 노드는 자신의 진행 상황만 안다.
+	servers, err := logs[1].GetServers()
+	require.NoError(t, err)
+	for _, server := range servers {
+		require.Equal(t, server.Id == "1", server.ProgressKnown, server.Id)
+	}
+
+	// 팔로워가 멈추면 그 후에 추가한 레코드만큼 뒤처진다.
+	require.NoError(t, logs[2].Close())
+	for i := 0; i < 3; i++ {
+		_, err := logs[0].Append(&api.Record{Value: []byte(fmt.Sprintf("record %d", i))})
+		require.NoError(t, err)
+	}
+	requireProgress(t, logs[0], map[string][2]uint64{
+		"0": {4, 0},
+		"1": {4, 0},
+		"2": {1, 3},
+	})
+
+	for _, l := range logs[:2] {
+		require.NoError(t, l.Close())
+	}
+}
+
+// requireProgress 함수는 리더가 알려준 서버들의 가장 큰 오프셋과 지연이 want와 같아질 때까지 기다린다.
+func requireProgress(t *testing.T, leader *DistributedLog, want map[string][2]uint64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		servers, err := leader.GetServers()
+		if err != nil {
+			return false
+		}
+		got := map[string][2]uint64{}
+		for _, server := range servers {
+			if !server.ProgressKnown {
+				return false
+			}
+			got[server.Id] = [2]uint64{server.HighestOffset, server.Lag}
+		}
+		return reflect.DeepEqual(want, got)
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestLeaderLoss(t *testing.T) {
+	logs, dirs := setupCluster(t, 3)
+	defer func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	var records []*api.Record
+	for i := 0; i < 5; i++ {
+		record := &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+		off, err := logs[0].Append(record)
+		require.NoError(t, err)
+		record.Offset = off
+		records = append(records, record)
+	}
+
+	// 리더가 죽어도 커밋된 레코드는 남은 노드들에 있고, 새 리더가 이어서 추가한다.
+	require.NoError(t, logs[0].Close())
+	rest := logs[1:]
+	var leader *DistributedLog
+	require.Eventually(t, func() bool {
+		for _, l := range rest {
+			if l.raft.State() == raft.Leader {
+				leader = l
+				return true
+			}
+		}
+		return false
+	}, 3*time.Second, 50*time.Millisecond)
+	requireReplicated(t, rest, records)
+
+	record := &api.Record{Value: []byte("after leader loss")}
+	off, err := leader.Append(record)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(records)), off)
+	record.Offset = off
+	records = append(records, record)
+	requireReplicated(t, rest, records)
+
+	for _, l := range rest {
+		require.NoError(t, l.Close())
+	}
+}
+
+func TestSnapshotCatchUp(t *testing.T) {
+	// 리더가 스냅숏을 찍고 로그를 지웠다면 새로 참여한 노드는 스냅숏으로 따라잡는다.
+	leader, leaderDir := newNode(t, 0, func(c *Config) {
+		c.Raft.TrailingLogs = 1
+	})
+	defer os.RemoveAll(leaderDir)
+	require.NoError(t, leader.WaitForLeader(3*time.Second))
+
+	var records []*api.Record
+	for i := 0; i < 10; i++ {
+		record := &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+		off, err := leader.Append(record)
+		require.NoError(t, err)
+		record.Offset = off
+		records = append(records, record)
+	}
+	require.NoError(t, leader.raft.Snapshot().Error())
+
+	follower, followerDir := newNode(t, 1, nil)
+	defer os.RemoveAll(followerDir)
+	require.NoError(t, leader.Join("1", follower.config.Raft.StreamLayer.Addr().String(), follower.config.Raft.RPCAddr))
+	requireReplicated(t, []*DistributedLog{follower}, records)
+
+	// 스냅숏 이후의 로그는 다시 Raft 로그로 복제된다.
+	record := &api.Record{Value: []byte("after snapshot")}
+	off, err := leader.Append(record)
+	require.NoError(t, err)
+	record.Offset = off
+	requireReplicated(t, []*DistributedLog{follower}, append(records, record))
+
+	require.NoError(t, follower.Close())
+	require.NoError(t, leader.Close())
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "snapshot-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 64
+	c.Timestamp.ProducerSupplied = true
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dst"), 0755))
+	src, err := NewLog(filepath.Join(dir, "src"), c)
+	require.NoError(t, err)
+	defer src.Close()
+	for i := 0; i < 5; i++ {
+		_, err := src.Append(&api.Record{Value: []byte(fmt.Sprintf("record %d", i))})
+		require.NoError(t, err)
+	}
+
+	snap, err := (&fsm{log: src}).Snapshot()
+	require.NoError(t, err)
+	// 스냅숏을 찍은 후에 추가한 레코드는 스냅숏에 포함되지 않는다.
+	_, err = src.Append(&api.Record{Value: []byte("after snapshot")})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, snap.(*snapshot).Persist(&bufferSink{Buffer: &buf}))
+
+	dst, err := NewLog(filepath.Join(dir, "dst"), c)
+	require.NoError(t, err)
+	defer dst.Close()
+	_, err = dst.Append(&api.Record{Value: []byte("stale")})
+	require.NoError(t, err)
+
+	require.NoError(t, (&fsm{log: dst}).Restore(nopCloser{&buf}))
+	for i := uint64(0); i < 5; i++ {
+		want, err := src.Read(i)
+		require.NoError(t, err)
+		got, err := dst.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, want.Value, got.Value)
+		require.Equal(t, want.Offset, got.Offset)
+		require.True(t, want.Timestamp.AsTime().Equal(got.Timestamp.AsTime()))
+	}
+	_, err = dst.Read(5)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+}
+
+// 복원한 로그도 멱등 프로듀서의 중복 제거 테이블을 가지고 있어서, 복원 전에 추가한 레코드를 다시 보내면 원래 오프셋을 리턴한다.
+func TestSnapshotRestoreProducers(t *testing.T) {
+	src, dst := setupRestore(t)
+	for seq := uint64(1); seq <= 2; seq++ {
+		_, err := src.Append(&api.Record{Value: []byte("hello"), ProducerId: 7, Sequence: seq})
+		require.NoError(t, err)
+	}
+	restoreSnapshot(t, src, dst)
+
+	off, err := dst.Append(&api.Record{Value: []byte("hello"), ProducerId: 7, Sequence: 2})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+	_, err = dst.Read(2)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+
+	_, err = dst.Append(&api.Record{Value: []byte("hello"), ProducerId: 7, Sequence: 4})
+	require.IsType(t, api.ErrOutOfOrderSequence{}, err)
+	off, err = dst.Append(&api.Record{Value: []byte("hello"), ProducerId: 7, Sequence: 3})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+}
+
+// 복원한 로그도 열려있는 트랜잭션과 중단한 트랜잭션을 알고 있다.
+func TestSnapshotRestoreTxns(t *testing.T) {
+	src, dst := setupRestore(t)
+	for _, record := range []*api.Record{
+		{TxnId: 3, Control: api.ControlType_CONTROL_BEGIN},
+		{TxnId: 3, Value: []byte("open")},
+		{TxnId: 9, Control: api.ControlType_CONTROL_BEGIN},
+		{TxnId: 9, Value: []byte("aborted")},
+		{TxnId: 9, Control: api.ControlType_CONTROL_ABORT},
+	} {
+		_, err := src.Append(record)
+		require.NoError(t, err)
+	}
+	require.Equal(t, uint64(0), src.LastStableOffset())
+	require.True(t, src.Aborted(9))
+	restoreSnapshot(t, src, dst)
+
+	require.Equal(t, uint64(0), dst.LastStableOffset())
+	require.True(t, dst.Aborted(9))
+	require.False(t, dst.Aborted(3))
+
+	// 열려있던 트랜잭션은 이어서 커밋할 수 있고, 중단한 트랜잭션은 다시 쓸 수 없다.
+	_, err := dst.Append(&api.Record{TxnId: 9, Value: []byte("late")})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+	_, err = dst.Append(&api.Record{TxnId: 3, Control: api.ControlType_CONTROL_COMMIT})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), dst.LastStableOffset())
+}
+
+// 스냅숏을 설치해도 로그를 닫는 것은 아니므로, 기다리던 소비자는 ErrClosed를 받지 않고 복원한 레코드나 새 레코드를 기다린다.
+func TestSnapshotRestoreKeepsWaiters(t *testing.T) {
+	src, dst := setupRestore(t)
+	for i := 0; i < 3; i++ {
+		_, err := src.Append(&api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+	restored := make(chan error, 1)
+	go func() {
+		restored <- dst.Wait(context.Background(), 2)
+	}()
+	later := make(chan error, 1)
+	go func() {
+		later <- dst.Wait(context.Background(), 3)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	restoreSnapshot(t, src, dst)
+
+	select {
+	case err := <-restored:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the snapshot was restored")
+	}
+	select {
+	case err := <-later:
+		t.Fatalf("Wait returned %v before the record was appended", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err := dst.Append(&api.Record{Value: []byte("next")})
+	require.NoError(t, err)
+	require.NoError(t, <-later)
+}
+
+// setupRestore 함수는 스냅숏을 찍을 로그와 복원할 로그를 만든다.
+func setupRestore(t *testing.T) (src, dst *Log) {
+	t.Helper()
+	dir := t.TempDir()
+	c := Config{}
+	c.Segment.MaxStoreBytes = 64
+	c.Timestamp.ProducerSupplied = true
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dst"), 0755))
+	var err error
+	src, err = NewLog(filepath.Join(dir, "src"), c)
+	require.NoError(t, err)
+	t.Cleanup(func() { src.Close() })
+	dst, err = NewLog(filepath.Join(dir, "dst"), c)
+	require.NoError(t, err)
+	t.Cleanup(func() { dst.Close() })
+	return src, dst
+}
+
+// restoreSnapshot 함수는 src의 스냅숏을 찍어서 dst에 복원한다.
+func restoreSnapshot(t *testing.T, src, dst *Log) {
+	t.Helper()
+	snap, err := (&fsm{log: src}).Snapshot()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, snap.(*snapshot).Persist(&bufferSink{Buffer: &buf}))
+	require.NoError(t, (&fsm{log: dst}).Restore(nopCloser{&buf}))
+}
+
+func TestLogStoreDeleteRange(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logstore-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 64
+	c.Segment.InitialOffset = 1
+	store, err := newLogStore(dir, c)
+	require.NoError(t, err)
+	defer store.Close()
+
+	appendedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 6; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: []byte("hello world"), AppendedAt: appendedAt})
+	}
+	require.NoError(t, store.StoreLogs(logs))
+
+	out := &raft.Log{}
+	require.NoError(t, store.GetLog(3, out))
+	require.Equal(t, uint64(3), out.Index)
+	require.Equal(t, uint64(1), out.Term)
+	require.Equal(t, raft.LogCommand, out.Type)
+	// 로그를 추가한 시각은 로그 저장소가 바꾸지 않는다.
+	require.True(t, appendedAt.Equal(out.AppendedAt), out.AppendedAt)
+
+	// 충돌한 뒷부분을 지우고 다른 임기의 로그로 다시 채운다.
+	require.NoError(t, store.DeleteRange(4, 6))
+	last, err := store.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), last)
+	require.NoError(t, store.StoreLog(&raft.Log{Index: 4, Term: 2, Type: raft.LogCommand, Data: []byte("new term")}))
+	require.NoError(t, store.GetLog(4, out))
+	require.Equal(t, uint64(2), out.Term)
+	require.Equal(t, []byte("new term"), out.Data)
+
+	// 스냅숏을 찍은 후에는 앞부분을 지운다.
+	require.NoError(t, store.DeleteRange(1, 3))
+	first, err := store.FirstIndex()
+	require.NoError(t, err)
+	require.Greater(t, first, uint64(1))
+	require.NoError(t, store.GetLog(4, out))
+
+	// 모두 지우면 비어있는 로그가 된다. FirstIndex가 LastIndex보다 크면 안 된다.
+	first, err = store.FirstIndex()
+	require.NoError(t, err)
+	last, err = store.LastIndex()
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteRange(first, last))
+	first, err = store.FirstIndex()
+	require.NoError(t, err)
+	last, err = store.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+	require.Equal(t, uint64(0), last)
+	require.Equal(t, raft.ErrLogNotFound, store.GetLog(4, out))
+
+	// 스냅숏을 설치한 후에는 스냅숏 다음 인덱스부터 이어서 저장한다.
+	require.NoError(t, store.StoreLog(&raft.Log{Index: 10, Term: 3, Type: raft.LogCommand, Data: []byte("after snapshot")}))
+	first, err = store.FirstIndex()
+	require.NoError(t, err)
+	last, err = store.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), last)
+	require.LessOrEqual(t, first, last)
+	require.NoError(t, store.GetLog(10, out))
+	require.Equal(t, []byte("after snapshot"), out.Data)
+}
+
+type bufferSink struct {
+	*bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
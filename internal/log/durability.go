@@ -0,0 +1,122 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+레코드는 store의 bufio.Writer를 거쳐서 파일에 쓰이므로, 버퍼를 비우고(Flush) fsync(File.Sync)를 해야 디스크에 남는다.
+인덱스는 Log를 시작할 때 스토어로부터 복구할 수 있으므로(recovery.go) 스토어만 fsync하면 된다.
+
+syncer는 group commit을 구현한다. fsync가 필요한 Append 호출은 syncTo로 자신의 레코드가 디스크에 기록되기를 기다린다.
+진행 중인 fsync가 없다면 호출한 고루틴이 직접 fsync를 하고, 진행 중이라면 그 fsync가 끝나기를 기다린 후 다시 확인한다.
+fsync를 시작하기 직전까지 쓰인 모든 레코드가 한 번의 fsync로 기록되므로, 동시에 Append한 호출들은 fsync를 공유한다.
+*/
+type syncer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	syncing bool
+	synced  uint64 // 이 오프셋 전까지의 레코드는 디스크에 기록되었다.
+	pending uint64 // 마지막 fsync 이후에 추가된 레코드 수(DurabilityEveryRecords)
+}
+
+func newSyncer(synced uint64) *syncer {
+	s := &syncer{synced: synced}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// needSync 메서드는 방금 추가한 n개의 레코드가 리턴하기 전에 fsync를 기다려야 하는지를 리턴한다. l.mu를 잡은 상태에서 호출한다.
+func (l *Log) needSync(n uint64) bool {
+	switch l.Config.Durability.Mode {
+	case DurabilityAlways:
+		return true
+	case DurabilityEveryRecords:
+		l.syncer.mu.Lock()
+		defer l.syncer.mu.Unlock()
+		l.syncer.pending += n
+		if l.syncer.pending >= l.Config.Durability.Records {
+			l.syncer.pending = 0
+			return true
+		}
+	}
+	return false
+}
+
+// syncTo 메서드는 off 전까지의 레코드가 디스크에 기록될 때까지 기다린다. l.mu를 잡지 않은 상태에서 호출한다.
+func (l *Log) syncTo(off uint64) error {
+	s := l.syncer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.synced < off {
+		if s.syncing {
+			s.cond.Wait()
+			continue
+		}
+		s.syncing = true
+		s.mu.Unlock()
+		target, err := l.syncActive()
+		s.mu.Lock()
+		s.syncing = false
+		if err == nil && target > s.synced {
+			s.synced = target
+		}
+		s.cond.Broadcast()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncActive 메서드는 활성 세그먼트의 스토어를 fsync하고, 기록이 보장된 다음 오프셋을 리턴한다.
+func (l *Log) syncActive() (uint64, error) {
+	l.mu.Lock()
+	s := l.activeSegment
+	target := s.nextOffset
+	l.mu.Unlock()
+	return target, s.store.Sync()
+}
+
+// sealed 메서드는 세그먼트를 새로 만들기 전에 이전 활성 세그먼트를 fsync한다. l.mu를 잡은 상태에서 호출한다.
+func (l *Log) sealed(s *segment) error {
+	if l.Config.Durability.Mode == DurabilityNone {
+		return nil
+	}
+	if err := s.store.Sync(); err != nil {
+		return err
+	}
+	l.syncer.mu.Lock()
+	defer l.syncer.mu.Unlock()
+	if s.nextOffset > l.syncer.synced {
+		l.syncer.synced = s.nextOffset
+	}
+	return nil
+}
+
+// startSyncer 메서드는 DurabilityInterval 모드에서 주기적으로 fsync하는 고루틴을 시작한다.
+func (l *Log) startSyncer() {
+	l.syncer = newSyncer(l.activeSegment.nextOffset)
+	if l.Config.Durability.Mode != DurabilityInterval {
+		return
+	}
+	l.wg.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.Config.Durability.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 에러는 다음 fsync(또는 Close)에서 다시 드러나므로 여기서는 무시한다.
+				l.mu.Lock()
+				off := l.activeSegment.nextOffset
+				l.mu.Unlock()
+				_ = l.syncTo(off)
+			}
+		}
+	}(l.done)
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurability(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, c Config, dir string,
+	){
+		"always syncs before append returns": testDurabilityAlways,
+		"every records syncs every N":        testDurabilityEveryRecords,
+		"interval syncs in the background":   testDurabilityInterval,
+		"concurrent appends share fsyncs":    testDurabilityGroupCommit,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "durability_test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024
+			fn(t, c, dir)
+		})
+	}
+}
+
+func synced(l *Log) uint64 {
+	l.syncer.mu.Lock()
+	defer l.syncer.mu.Unlock()
+	return l.syncer.synced
+}
+
+func testDurabilityAlways(t *testing.T, c Config, dir string) {
+	c.Durability.Mode = DurabilityAlways
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	for i := uint64(0); i < 3; i++ {
+		off, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		require.Equal(t, off+1, synced(log))
+		// 버퍼가 비워졌으므로 파일에 레코드가 남아 있어야 한다.
+		fi, err := os.Stat(log.activeSegment.store.Name())
+		require.NoError(t, err)
+		require.Equal(t, log.activeSegment.store.size, uint64(fi.Size()))
+	}
+}
+
+func testDurabilityEveryRecords(t *testing.T, c Config, dir string) {
+	c.Durability.Mode = DurabilityEveryRecords
+	c.Durability.Records = 2
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	for i, want := range []uint64{0, 2, 2, 4, 4} {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		require.Equal(t, want, synced(log), "append %d", i)
+	}
+}
+
+func testDurabilityInterval(t *testing.T, c Config, dir string) {
+	c.Durability.Mode = DurabilityInterval
+	c.Durability.Interval = 10 * time.Millisecond
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return synced(log) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testDurabilityGroupCommit(t *testing.T, c Config, dir string) {
+	c.Durability.Mode = DurabilityAlways
+	c.Segment.MaxStoreBytes = 1 << 20
+	c.Segment.MaxIndexBytes = 1 << 20
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			off, err := log.Append(&api.Record{Value: []byte("hello world")})
+			require.NoError(t, err)
+			require.Greater(t, synced(log), off)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, uint64(50), synced(log))
+}
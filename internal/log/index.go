@@ -3,6 +3,7 @@ package log
 import (
 	"io"
 	"os"
+	"sort"
 
 	"github.com/tysonmote/gommap"
 )
@@ -105,3 +106,60 @@ func (i *index) Write(off uint32, pos uint64) error {
 func (i *index) Name() string {
 	return i.file.Name()
 }
+
+// entry 메서드는 n번째 항목을 크기 확인 없이 메모리 맵에서 바로 읽는다. 복구할 때 사용한다.
+func (i *index) entry(n uint64) (off uint32, pos uint64) {
+	p := n * entWidth
+	return enc.Uint32(i.mmap[p : p+offWidth]), enc.Uint64(i.mmap[p+offWidth : p+entWidth])
+}
+
+// entries 메서드는 메모리 맵에 담을 수 있는 항목의 최대 개수와 현재 크기 중 작은 값을 리턴한다.
+func (i *index) entries() uint64 {
+	size := i.size
+	if size > uint64(len(i.mmap)) {
+		size = uint64(len(i.mmap))
+	}
+	return size / entWidth
+}
+
+// truncate 메서드는 n번째 항목부터 지우고 인덱스의 크기를 n개로 줄인다.
+func (i *index) truncate(n uint64) {
+	for b := n * entWidth; b < uint64(len(i.mmap)) && b < i.size; b++ {
+		i.mmap[b] = 0
+	}
+	i.size = n * entWidth
+}
+
+/*
+find 메서드는 상대 오프셋이 rel 이상인 첫 번째 항목의 순서를 리턴한다. 그런 항목이 없다면 io.EOF를 리턴한다.
+로그를 압축(compaction)하면 세그먼트의 오프셋 사이에 빈 곳이 생기기 때문에 항목의 순서와 상대 오프셋이 같지 않을 수 있다.
+대부분의 세그먼트는 빈 곳이 없으므로 먼저 rel번째 항목을 확인하고, 아니라면 이진 탐색한다.
+*/
+func (i *index) find(rel uint32) (uint64, error) {
+	entries := i.size / entWidth
+	if uint64(rel) < entries {
+		if off, _ := i.entry(uint64(rel)); off == rel {
+			return uint64(rel), nil
+		}
+	}
+	n := uint64(sort.Search(int(entries), func(k int) bool {
+		off, _ := i.entry(uint64(k))
+		return off >= rel
+	}))
+	if n == entries {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// unclean 메서드는 인덱스 파일이 정상적으로 닫히지 않았는지(0으로 채워진 뒷부분이 남아있는지)를 리턴한다.
+func (i *index) unclean() bool {
+	if i.size%entWidth != 0 || i.size > uint64(len(i.mmap)) {
+		return true
+	}
+	if i.size <= entWidth {
+		return false
+	}
+	off, pos := i.entry(i.size/entWidth - 1)
+	return off == 0 && pos == 0
+}
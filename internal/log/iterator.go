@@ -0,0 +1,143 @@
+package log
+
+import (
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+Read 메서드로 레코드를 하나씩 읽으면 레코드마다 로그의 뮤텍스를 잡고 인덱스에서 위치를 찾아야 한다.
+여러 레코드를 이어서 읽을 때는 ReadRange 메서드나 Iterator를 사용한다.
+둘 다 세그먼트마다 한 번만 인덱스에서 시작 위치를 찾고, 그 다음부터는 인덱스 항목을 순서대로 읽어 나간다.
+*/
+
+// Iterator가 한 번에 읽어오는 레코드의 최대 개수와 최대 크기
+const (
+	iteratorBatchRecords = 256
+	iteratorBatchBytes   = 1 << 20
+)
+
+/*
+ReadRange 메서드는 from부터(압축으로 from이 비어있다면 from 다음의 첫 번째 레코드부터) 이어지는 레코드들을 읽어서 리턴한다.
+maxRecords 개수나 maxBytes 크기(레코드를 직렬화한 크기의 합)에 도달하면 멈춘다. 0이면 제한하지 않는다.
+maxBytes보다 큰 레코드가 있더라도 소비자가 멈춰버리지 않도록 첫 번째 레코드는 항상 리턴한다.
+from 이후에 레코드가 없다면 Read 메서드와 같이 api.ErrOffsetOutOfRange를 리턴한다.
+*/
+func (l *Log) ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readRange(from, maxRecords, maxBytes)
+}
+
+// readRange 메서드는 l.mu를 잡은 상태에서 호출한다.
+func (l *Log) readRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	if len(l.segments) == 0 || from < l.segments[0].baseOffset {
+		return nil, api.ErrOffsetOutOfRange{Offset: from}
+	}
+	var records []*api.Record
+	var bytes uint64
+	full := false
+	for _, s := range l.segments {
+		if full {
+			break
+		}
+		if s.nextOffset <= from {
+			continue
+		}
+		err := s.scan(from, func(record *api.Record) (bool, error) {
+			size := uint64(proto.Size(record))
+			if maxBytes > 0 && len(records) > 0 && bytes+size > maxBytes {
+				full = true
+				return false, nil
+			}
+			records = append(records, record)
+			bytes += size
+			if maxRecords > 0 && len(records) >= maxRecords {
+				full = true
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(records) == 0 {
+		return nil, api.ErrOffsetOutOfRange{Offset: from}
+	}
+	return records, nil
+}
+
+/*
+Iterator는 로그의 레코드를 오프셋 순서대로 읽는다. 세그먼트의 경계를 넘어서 계속 읽을 수 있다.
+
+	it := log.Iterator(0)
+	for it.Next() {
+		record := it.Record()
+		// ...
+	}
+	if err := it.Err(); err != nil {
+		// ...
+	}
+
+레코드를 묶음(iteratorBatchRecords, iteratorBatchBytes)으로 읽어와서 하나씩 돌려주기 때문에
+로그의 뮤텍스는 묶음마다 한 번만 잡는다. 로그의 끝에 도달하면 Next는 false를 리턴하고 Err는 nil이다.
+그 후에 레코드가 추가되면 Next를 다시 호출해서 이어서 읽을 수 있다.
+읽을 위치의 세그먼트가 보존 정책으로 지워졌다면 Err는 api.ErrOffsetOutOfRange를 리턴한다.
+Iterator는 여러 고루틴에서 함께 쓸 수 없다.
+*/
+type Iterator struct {
+	log    *Log
+	next   uint64 // 다음 묶음을 읽기 시작할 오프셋
+	buf    []*api.Record
+	record *api.Record
+	err    error
+}
+
+// Iterator 메서드는 from 오프셋부터 읽는 Iterator를 리턴한다.
+func (l *Log) Iterator(from uint64) *Iterator {
+	return &Iterator{log: l, next: from}
+}
+
+// Next 메서드는 다음 레코드로 이동한다. 더 읽을 레코드가 없거나 에러가 났다면 false를 리턴한다.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.buf) == 0 && !it.fill() {
+		it.record = nil
+		return false
+	}
+	it.record, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// fill 메서드는 다음 묶음을 읽어온다.
+func (it *Iterator) fill() bool {
+	l := it.log
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, err := l.readRange(it.next, iteratorBatchRecords, iteratorBatchBytes)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok &&
+		len(l.segments) > 0 && it.next >= l.segments[0].baseOffset {
+		// 로그의 끝에 도달했다.
+		return false
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.buf = records
+	it.next = records[len(records)-1].Offset + 1
+	return true
+}
+
+// Record 메서드는 Next로 이동한 현재 레코드를 리턴한다.
+func (it *Iterator) Record() *api.Record {
+	return it.record
+}
+
+// Err 메서드는 읽다가 발생한 에러를 리턴한다. 로그의 끝에 도달한 것은 에러가 아니다.
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestIterator(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"read range across segments":         testReadRange,
+		"read range stops at limits":         testReadRangeLimits,
+		"read range past the end fails":      testReadRangeOutOfRange,
+		"iterator walks across segments":     testIteratorSegments,
+		"iterator resumes after new records": testIteratorResume,
+		"iterator reports truncated offsets": testIteratorTruncated,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "iterator_test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			// 세그먼트마다 레코드가 하나씩 들어간다.
+			c.Segment.MaxStoreBytes = 32
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+func requireOffsets(t *testing.T, records []*api.Record, from, to uint64) {
+	t.Helper()
+	require.Equal(t, int(to-from), len(records))
+	for i, record := range records {
+		require.Equal(t, from+uint64(i), record.Offset)
+		require.Equal(t, []byte("hello world"), record.Value)
+	}
+}
+
+func testReadRange(t *testing.T, log *Log) {
+	appendRecords(t, log, 5)
+	require.Equal(t, 5, len(log.segments))
+
+	records, err := log.ReadRange(1, 0, 0)
+	require.NoError(t, err)
+	requireOffsets(t, records, 1, 5)
+}
+
+func testReadRangeLimits(t *testing.T, log *Log) {
+	appendRecords(t, log, 5)
+
+	records, err := log.ReadRange(0, 3, 0)
+	require.NoError(t, err)
+	requireOffsets(t, records, 0, 3)
+
+	// 레코드 두 개 크기만큼만 읽는다.
+	size := uint64(proto.Size(records[1]))
+	records, err = log.ReadRange(1, 0, 2*size)
+	require.NoError(t, err)
+	requireOffsets(t, records, 1, 3)
+
+	// maxBytes보다 큰 레코드라도 첫 번째 레코드는 리턴한다.
+	records, err = log.ReadRange(1, 0, 1)
+	require.NoError(t, err)
+	requireOffsets(t, records, 1, 2)
+}
+
+func testReadRangeOutOfRange(t *testing.T, log *Log) {
+	appendRecords(t, log, 2)
+
+	_, err := log.ReadRange(2, 0, 0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 2}, err)
+}
+
+func testIteratorSegments(t *testing.T, log *Log) {
+	appendRecords(t, log, 5)
+
+	it := log.Iterator(0)
+	var records []*api.Record
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	require.NoError(t, it.Err())
+	requireOffsets(t, records, 0, 5)
+	require.Nil(t, it.Record())
+}
+
+func testIteratorResume(t *testing.T, log *Log) {
+	appendRecords(t, log, 2)
+
+	it := log.Iterator(1)
+	require.True(t, it.Next())
+	require.Equal(t, uint64(1), it.Record().Offset)
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	// 로그의 끝에 도달한 후에 추가된 레코드도 이어서 읽는다.
+	appendRecords(t, log, 2)
+	var records []*api.Record
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	require.NoError(t, it.Err())
+	requireOffsets(t, records, 2, 4)
+}
+
+func testIteratorTruncated(t *testing.T, log *Log) {
+	appendRecords(t, log, 5)
+
+	it := log.Iterator(0)
+	require.NoError(t, log.Truncate(2))
+	require.False(t, it.Next())
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0}, it.Err())
+}
@@ -1,24 +1,47 @@
 package log
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Log struct {
-	mu     sync.Mutex
+	mu sync.Mutex
+	// cleanMu는 세그먼트를 지우거나 다시 쓰는 작업(보존 정책, 압축, Truncate)이 겹치지 않게 한다. mu보다 먼저 잡는다.
+	cleanMu sync.Mutex
+
 	Dir    string
 	Config Config
 
 	activeSegment *segment
 	segments      []*segment
+	recovery      RecoveryReport
+	syncer        *syncer
+	// appended는 레코드가 추가될 때마다 닫히고 새 채널로 바뀐다. Wait 메서드가 사용한다.
+	appended chan struct{}
+	// producers는 멱등 프로듀서의 중복 제거 테이블이다(producer.go).
+	producers producers
+	// txns는 트랜잭션의 상태이다(txn.go).
+	txns *transactions
+
+	// 백그라운드 고루틴(fsync, 보존 정책)을 멈추기 위한 채널
+	done chan struct{}
+	wg   sync.WaitGroup
+	// closed는 Close하면 닫힌다. Wait 메서드가 사용한다. Reset은 백그라운드 고루틴만 다시 시작하므로 닫지 않는다.
+	closed chan struct{}
 }
 
 // NewLog 함수는 로그 파일을(세그먼트, 인덱스) 새로 만든다는 의미가 아니라
@@ -30,40 +53,92 @@ func NewLog(dir string, c Config) (*Log, error) {
 	if c.Segment.MaxIndexBytes == 0 {
 		c.Segment.MaxIndexBytes = 1024
 	}
+	if c.Segment.TimeIndexIntervalBytes == 0 {
+		c.Segment.TimeIndexIntervalBytes = 4096
+	}
+	if c.Durability.Records == 0 {
+		c.Durability.Records = 1
+	}
+	if c.Durability.Interval == 0 {
+		c.Durability.Interval = time.Second
+	}
+	if c.Retention.CheckInterval == 0 {
+		c.Retention.CheckInterval = time.Minute
+	}
+	if c.Compaction.TombstoneRetention == 0 {
+		c.Compaction.TombstoneRetention = 24 * time.Hour
+	}
+	if c.Compaction.Interval == 0 {
+		c.Compaction.Interval = time.Minute
+	}
+	if c.Transaction.CheckInterval == 0 {
+		c.Transaction.CheckInterval = time.Second
+	}
 	l := &Log{
 		Dir:    dir,
 		Config: c,
+		closed: make(chan struct{}),
 	}
-
-	return l, l.setup()
+	if err := l.setup(); err != nil {
+		return nil, err
+	}
+	l.start()
+	return l, nil
 }
 
 func (l *Log) setup() error {
+	// Reset으로 다시 호출할 때는 이전 세그먼트들을 버린다.
+	l.segments = nil
+	l.activeSegment = nil
+	l.recovery = RecoveryReport{}
+	// 압축하다가 멈췄다면 임시 디렉터리가 남아있다.
+	if err := os.RemoveAll(filepath.Join(l.Dir, compactDir)); err != nil {
+		return err
+	}
 	files, err := os.ReadDir(l.Dir)
 	if err != nil {
 		return err
 	}
-	var baseOffsets []uint64
+	// 베이스 오프셋마다 index(.offset) 파일이 있는지를 기록한다.
+	// 인덱스 파일이 없는 세그먼트는 스토어 파일로부터 인덱스를 다시 만든다.
+	hasIndex := make(map[uint64]bool)
 	for _, file := range files {
+		ext := path.Ext(file.Name())
+		if ext != ".store" && ext != ".offset" {
+			continue
+		}
 		offStr := strings.TrimSuffix( // 파일 이름에서 확장자 제거
-			file.Name(),           // 파일이름
-			path.Ext(file.Name()), // 제거하고자 하는 Suffix -> 확장자
+			file.Name(), // 파일이름
+			ext,         // 제거하고자 하는 Suffix -> 확장자
 		)
 		// 문자열을 10진수(base 10)로 해석하여 부호 없는 정수 uin64로 변환한다.
-		off, _ := strconv.ParseUint(offStr, 10, 0)
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		if err != nil {
+			continue
+		}
+		hasIndex[off] = hasIndex[off] || ext == ".offset"
+	}
+	var baseOffsets []uint64
+	for off := range hasIndex {
 		baseOffsets = append(baseOffsets, off)
 	}
 	sort.Slice(baseOffsets, func(i, j int) bool {
 		return baseOffsets[i] < baseOffsets[j]
 	})
 
-	for i := 0; i < len(baseOffsets); i++ {
-		if err = l.newSegment(baseOffsets[i]); err != nil {
+	l.recovery = RecoveryReport{}
+	for i, off := range baseOffsets {
+		if err = l.newSegment(off); err != nil {
 			return err
 		}
-		// 베이스 오프셋은 index와 store 두 파일을 중복해서 담고 있기에
-		// 같은 값이 하나 더 있다. 그래서 한 번 건너뛴다.
-		i++
+		// 마지막(활성) 세그먼트, 인덱스 파일이 없던 세그먼트, 인덱스 파일이 정상적으로 닫히지 않은 세그먼트는 검사하고 복구한다.
+		if i == len(baseOffsets)-1 || !hasIndex[off] || l.activeSegment.index.unclean() {
+			r, err := l.activeSegment.recover(!hasIndex[off])
+			if err != nil {
+				return err
+			}
+			l.recovery.Segments = append(l.recovery.Segments, r)
+		}
 	}
 	if l.segments == nil {
 		if err = l.newSegment(
@@ -72,44 +147,285 @@ func (l *Log) setup() error {
 			return err
 		}
 	}
+	l.appended = make(chan struct{})
+	if err = l.loadState(); err != nil {
+		return err
+	}
+	l.recovery.OpenTransactions = len(l.txns.open)
 	return nil
 }
 
-func (l *Log) Append(record *api.Record) (uint64, error) {
+/*
+loadState 메서드는 세그먼트들의 레코드로부터 멱등 프로듀서의 중복 제거 테이블(producer.go)과 트랜잭션의 상태(txn.go)를 다시 만든다.
+setup에서 호출한다. 손상된 레코드는 건너뛴다. 손상은 그 레코드를 읽을 때 알리면 되고, 로그를 열지 못하게 할 이유는 없다.
+*/
+func (l *Log) loadState() error {
+	l.producers = make(producers)
+	l.txns = newTransactions()
+	for _, s := range l.segments {
+		for n := uint64(0); n < s.index.size/entWidth; n++ {
+			record, err := s.readEntry(n)
+			if _, ok := err.(api.ErrCorruptRecord); ok {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			l.producers.add(record)
+			l.txns.add(record)
+		}
+	}
+	return nil
+}
+
+// Recovery 메서드는 Log를 시작할 때 세그먼트를 검사하고 복구한 결과를 리턴한다. 운영자가 로그로 남길 때 사용한다.
+func (l *Log) Recovery() RecoveryReport {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.recovery
+}
 
+/*
+Append 메서드는 레코드를 활성 세그먼트에 추가한다. Config.Durability에 따라 fsync가 필요하다면
+l.mu를 놓은 후 fsync가 끝나기를 기다렸다가 리턴한다. 그래서 gRPC의 ProduceResponse도 내구성 수준을 만족한 후에 회신된다.
+멱등 프로듀서가 다시 보낸 레코드는 추가하지 않고 처음 추가한 오프셋을 리턴한다.
+트랜잭션의 레코드와 제어 마커는 트랜잭션의 상태로 확인한 후에 추가한다.
+*/
+func (l *Log) Append(record *api.Record) (uint64, error) {
+	l.mu.Lock()
+	if err := l.txns.check(record); err != nil {
+		l.mu.Unlock()
+		return 0, err
+	}
+	if record.ProducerId != 0 {
+		off, dup, err := l.producers.check(record, nil)
+		if err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+		if dup {
+			l.mu.Unlock()
+			return off, l.syncDuplicate(off)
+		}
+	}
 	if l.activeSegment.IsMaxed() {
+		if err := l.sealed(l.activeSegment); err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
 		off := l.activeSegment.nextOffset
 		if err := l.newSegment(off); err != nil {
+			l.mu.Unlock()
 			return 0, err
 		}
 	}
-	return l.activeSegment.Append(record)
+	off, err := l.activeSegment.Append(record)
+	if err != nil {
+		l.mu.Unlock()
+		return 0, err
+	}
+	l.producers.add(record)
+	l.txns.add(record)
+	needSync := l.needSync(1)
+	l.notifyAppended()
+	l.mu.Unlock()
+
+	if needSync {
+		if err = l.syncTo(off + 1); err != nil {
+			return 0, err
+		}
+	}
+	return off, nil
+}
+
+// ErrEmptyBatch는 레코드가 없는 배치를 추가하려 할 때의 에러이다.
+var ErrEmptyBatch = errors.New("empty batch")
+
+/*
+AppendBatch 메서드는 여러 레코드를 연속한 오프셋으로 추가하고 첫 번째 레코드의 오프셋을 리턴한다.
+레코드를 모두 직렬화한 후에 세그먼트마다 한 번씩 스토어에 쓴다. 배치 중간에 세그먼트가 가득 차면(IsMaxed)
+새 세그먼트를 만들어서 나머지를 쓴다. 쓰다가 에러가 나면 배치 전체를 되돌리므로 일부만 추가되는 일은 없다.
+멱등 프로듀서의 배치는 첫 번째 레코드가 중복이라면 배치 전체를 다시 보낸 것으로 보고 처음 추가한 오프셋을 리턴한다.
+트랜잭션의 제어 마커는 배치에 담을 수 없다. 배치의 레코드들은 트랜잭션의 상태를 바꾸지 않으므로 하나씩 확인하면 된다.
+*/
+func (l *Log) AppendBatch(records []*api.Record) (uint64, error) {
+	if len(records) == 0 {
+		return 0, ErrEmptyBatch
+	}
+	l.mu.Lock()
+	for _, record := range records {
+		err := l.txns.check(record)
+		if err == nil && record.Control != api.ControlType_CONTROL_NONE {
+			err = api.ErrInvalidTxn{TxnID: record.TxnId, Reason: "control marker in batch"}
+		}
+		if err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+	}
+	next := make(map[uint64]uint64)
+	for i, record := range records {
+		if record.ProducerId == 0 {
+			continue
+		}
+		off, dup, err := l.producers.check(record, next)
+		if err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+		if dup {
+			if i > 0 {
+				l.mu.Unlock()
+				return 0, api.ErrOutOfOrderSequence{
+					ProducerID: record.ProducerId,
+					Sequence:   record.Sequence,
+					Expected:   next[record.ProducerId],
+				}
+			}
+			l.mu.Unlock()
+			return off, l.syncDuplicate(off)
+		}
+		next[record.ProducerId] = record.Sequence + 1
+	}
+	first := l.activeSegment.nextOffset
+	now := timestamppb.Now()
+	payloads := make([][]byte, len(records))
+	for i, record := range records {
+		record.Offset = first + uint64(i)
+		if record.Timestamp == nil || !l.Config.Timestamp.ProducerSupplied {
+			record.Timestamp = now
+		}
+		p, err := proto.Marshal(record)
+		if err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+		payloads[i] = p
+	}
+
+	type written struct {
+		segment *segment
+		sp      savepoint
+	}
+	var touched []written
+	segments := len(l.segments)
+	rollback := func(err error) (uint64, error) {
+		for i := len(touched) - 1; i >= 0; i-- {
+			if rerr := touched[i].segment.rollback(touched[i].sp); rerr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+			}
+		}
+		// 배치를 쓰면서 만든 세그먼트는 지운다.
+		for _, s := range l.segments[segments:] {
+			if rerr := s.Remove(); rerr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+			}
+		}
+		l.segments = l.segments[:segments]
+		l.activeSegment = l.segments[segments-1]
+		l.mu.Unlock()
+		return 0, err
+	}
+	for i := 0; i < len(records); {
+		if l.activeSegment.IsMaxed() {
+			if err := l.sealed(l.activeSegment); err != nil {
+				return rollback(err)
+			}
+			if err := l.newSegment(records[i].Offset); err != nil {
+				return rollback(err)
+			}
+		}
+		s := l.activeSegment
+		n := i + s.fit(payloads[i:])
+		touched = append(touched, written{segment: s, sp: s.savepoint()})
+		if err := s.writeBatch(records[i:n], payloads[i:n]); err != nil {
+			return rollback(err)
+		}
+		i = n
+	}
+	for _, record := range records {
+		l.producers.add(record)
+		l.txns.add(record)
+	}
+	needSync := l.needSync(uint64(len(records)))
+	l.notifyAppended()
+	l.mu.Unlock()
+
+	if needSync {
+		if err := l.syncTo(first + uint64(len(records))); err != nil {
+			return 0, err
+		}
+	}
+	return first, nil
+}
+
+// syncDuplicate 메서드는 중복 레코드의 원래 레코드가 DurabilityAlways 모드의 내구성을 만족할 때까지 기다린다.
+// 원래 요청이 fsync를 기다리는 중에 연결이 끊겼을 수 있기 때문이다. l.mu를 잡지 않은 상태에서 호출한다.
+func (l *Log) syncDuplicate(off uint64) error {
+	if l.Config.Durability.Mode != DurabilityAlways {
+		return nil
+	}
+	return l.syncTo(off + 1)
 }
 
 func (l *Log) Read(off uint64) (*api.Record, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	var s *segment
-	for _, segment := range l.segments {
-		if segment.baseOffset <= off && off < segment.nextOffset {
-			s = segment
-			break
+	if len(l.segments) == 0 || off < l.segments[0].baseOffset {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	// 압축한 세그먼트에는 오프셋 사이에 빈 곳이 있다. off가 빈 곳이라면 off 다음의 첫 번째 레코드를 리턴한다.
+	for _, s := range l.segments {
+		if s.nextOffset <= off {
+			continue
+		}
+		record, err := s.Read(off)
+		if err == io.EOF {
+			continue
 		}
+		return record, err
 	}
-	if s == nil || s.nextOffset <= off {
-		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	return nil, api.ErrOffsetOutOfRange{Offset: off}
+}
+
+/*
+OffsetForTime 메서드는 t 이후에 추가된(타임스탬프가 t 이상인) 첫 번째 레코드의 오프셋을 리턴한다.
+세그먼트의 가장 큰 타임스탬프로 세그먼트를 이진 탐색하고, 세그먼트 안에서는 시간 인덱스로 찾는다.
+그런 레코드가 없다면 다음에 추가될 레코드의 오프셋을 리턴한다. 그래서 리턴한 오프셋부터 소비하면 t 이후의 레코드를 모두 받는다.
+*/
+func (l *Log) OffsetForTime(t time.Time) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ts := t.UnixNano()
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].maxTimestamp >= ts
+	})
+	for ; i < len(l.segments); i++ {
+		off, ok, err := l.segments[i].offsetForTime(ts)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return off, nil
+		}
 	}
-	return s.Read(off)
+	return l.activeSegment.nextOffset, nil
 }
 
-// 로그의 모든 세그먼트를 닫는다.
+// 로그의 모든 세그먼트를 닫는다. fsync 정책이 있다면 닫기 전에 마지막으로 fsync한다.
 func (l *Log) Close() error {
+	if err := l.stop(); err != nil {
+		return err
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
 	for _, segment := range l.segments {
 		if err := segment.Close(); err != nil {
 			return err
@@ -126,12 +442,41 @@ func (l *Log) Remove() error {
 	return os.RemoveAll(l.Dir)
 }
 
-// 로그를 제거하고 이를 대체할 새로운 로그를 생성한다.
+// 로그를 제거하고 이를 대체할 새로운 로그를 생성한다. 로그를 닫는 것은 아니므로 기다리던 Wait은 새 로그에서 계속 기다린다.
 func (l *Log) Reset() error {
-	if err := l.Remove(); err != nil {
+	if err := l.stop(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	err := l.reset()
+	l.mu.Unlock()
+	if err != nil {
 		return err
 	}
-	return l.setup()
+	l.start()
+	return nil
+}
+
+// reset 메서드는 세그먼트들을 닫고 디렉터리를 지운 후 빈 로그를 만든다. l.mu를 잡은 상태에서 호출한다.
+func (l *Log) reset() error {
+	for _, segment := range l.segments {
+		if err := segment.Close(); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(l.Dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+	appended := l.appended
+	if err := l.setup(); err != nil {
+		return err
+	}
+	// 기다리던 고루틴들이 새 로그로 다시 확인하도록 깨운다.
+	close(appended)
+	return nil
 }
 
 // 아래 두개의 메서드는 로그에 저장된 오프셋의 범위를 알려준다. 복제 기능 지원이나 클러스터 조율을 할 때 이러한 정보가 필요하다.
@@ -151,9 +496,18 @@ func (l *Log) HighestOffset() (uint64, error) {
 	return off - 1, nil
 }
 
+// nextOffset 메서드는 다음에 추가할 레코드의 오프셋을 리턴한다. 비어있는 로그라면 처음 오프셋이다.
+func (l *Log) nextOffset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.activeSegment.nextOffset
+}
+
 // Truncate 메서드는 가장 큰 오프셋이 가장 작은 오프셋(매개변수 값)보다 작은 세그먼트를 찾아 제거한다.
 // 즉, 특정 시점보다 오래된 세그먼트를 지우는 메서드이다.
 func (l *Log) Truncate(lowest uint64) error {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	var segments []*segment
@@ -167,6 +521,9 @@ func (l *Log) Truncate(lowest uint64) error {
 		segments = append(segments, s)
 	}
 	l.segments = segments
+	if len(segments) > 0 {
+		l.txns.forget(segments[0].baseOffset)
+	}
 	return nil
 }
 
@@ -179,7 +536,8 @@ func (l *Log) Reader() io.Reader {
 	defer l.mu.Unlock()
 	readers := make([]io.Reader, len(l.segments))
 	for i, segment := range l.segments {
-		readers[i] = &originReader{segment.store, 0}
+		// 호출한 시점의 크기까지만 읽는다. 그 이후에 추가되는 레코드는 포함하지 않는다.
+		readers[i] = io.LimitReader(&originReader{segment.store, 0}, int64(segment.store.size))
 	}
 	return io.MultiReader(readers...)
 }
@@ -195,6 +553,33 @@ func (o *originReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// start 메서드는 백그라운드 고루틴들을 시작한다.
+func (l *Log) start() {
+	l.mu.Lock()
+	l.done = make(chan struct{})
+	l.mu.Unlock()
+	l.startSyncer()
+	l.startJanitor()
+	l.startCompactor()
+	l.startTxnJanitor()
+}
+
+// stop 메서드는 백그라운드 고루틴들을 멈추고, fsync 정책이 있다면 마지막으로 fsync한다.
+func (l *Log) stop() error {
+	select {
+	case <-l.done:
+		return nil
+	default:
+		close(l.done)
+	}
+	l.wg.Wait()
+	if l.Config.Durability.Mode == DurabilityNone {
+		return nil
+	}
+	_, err := l.syncActive()
+	return err
+}
+
 func (l *Log) newSegment(off uint64) error {
 	s, err := newSegment(l.Dir, off, l.Config)
 	if err != nil {
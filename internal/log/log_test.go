@@ -3,11 +3,14 @@ package log
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	api "github.com/sodami-hub/proglog/api/v1"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestLog(t *testing.T) {
@@ -19,6 +22,9 @@ func TestLog(t *testing.T) {
 		"init with existing segments":       testInitExisting,
 		"reader":                            testReader,
 		"truncate":                          testTruncate,
+		"offset for time":                   testOffsetForTime,
+		"append batch":                      testAppendBatch,
+		"append batch is all or nothing":    testAppendBatchAtomic,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			dir, err := os.MkdirTemp("", "store_test")
@@ -98,7 +104,7 @@ func testReader(t *testing.T, log *Log) {
 	require.NoError(t, err)
 
 	read := &api.Record{}
-	err = proto.Unmarshal(b[lenWidth:], read)
+	err = proto.Unmarshal(b[headerWidth+lenWidth+crcWidth:], read)
 	require.NoError(t, err)
 	require.Equal(t, append.Value, read.Value)
 }
@@ -121,3 +127,107 @@ func testTruncate(t *testing.T, log *Log) {
 	_, err = log.Read(0)
 	require.Error(t, err)
 }
+
+func testOffsetForTime(t *testing.T, o *Log) {
+	require.NoError(t, o.Close())
+	c := o.Config
+	c.Timestamp.ProducerSupplied = true
+	log, err := NewLog(o.Dir, c)
+	require.NoError(t, err)
+
+	base := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	// 세그먼트 하나에 레코드가 하나씩 들어가므로 여러 세그먼트에 걸쳐서 찾는다.
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&api.Record{
+			Value:     []byte("hello world"),
+			Timestamp: timestamppb.New(base.Add(time.Duration(i) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		at   time.Time
+		want uint64
+	}{
+		{base.Add(-time.Hour), 0},
+		{base, 0},
+		{base.Add(90 * time.Second), 2},
+		{base.Add(4 * time.Minute), 4},
+		{base.Add(time.Hour), 5},
+	} {
+		off, err := log.OffsetForTime(tc.at)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, off, tc.at)
+	}
+
+	// 다시 열어도 시간 인덱스로부터 같은 결과를 얻는다.
+	require.NoError(t, log.Close())
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	off, err := n.OffsetForTime(base.Add(150 * time.Second))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func testAppendBatch(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	// MaxStoreBytes가 32바이트이므로 배치가 여러 세그먼트에 나뉘어 쓰인다.
+	var batch []*api.Record
+	for i := 0; i < 5; i++ {
+		batch = append(batch, &api.Record{Value: []byte("hello world")})
+	}
+	first, err := log.AppendBatch(batch)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	require.Greater(t, len(log.segments), 2)
+
+	for i := uint64(0); i < 6; i++ {
+		read, err := log.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, i, read.Offset)
+		require.Equal(t, []byte("hello world"), read.Value)
+	}
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+
+	_, err = log.AppendBatch(nil)
+	require.Equal(t, ErrEmptyBatch, err)
+}
+
+func testAppendBatchAtomic(t *testing.T, log *Log) {
+	before := log.activeSegment.size()
+
+	// 세그먼트마다 레코드가 하나씩 들어가므로 배치는 0, 1 세그먼트에 쓰인 후 세 번째 세그먼트를 만들 때 실패한다.
+	// 세그먼트가 쓸 스토어 파일 자리에 디렉터리를 만들어서 실패하도록 한다.
+	require.NoError(t, os.Mkdir(filepath.Join(log.Dir, "2.store"), 0755))
+
+	_, err := log.AppendBatch([]*api.Record{
+		{Value: []byte("hello world")},
+		{Value: []byte("hello world")},
+		{Value: []byte("hello world")},
+	})
+	require.Error(t, err)
+
+	require.Equal(t, 1, len(log.segments))
+	require.Equal(t, before, log.activeSegment.size())
+	require.Equal(t, uint64(0), log.activeSegment.nextOffset)
+	_, err = os.Stat(filepath.Join(log.Dir, "1.store"))
+	require.True(t, os.IsNotExist(err))
+	_, err = log.Read(0)
+	require.Error(t, err)
+
+	// 실패한 배치 뒤에도 이어서 추가할 수 있다.
+	require.NoError(t, os.Remove(filepath.Join(log.Dir, "2.store")))
+	first, err := log.AppendBatch([]*api.Record{
+		{Value: []byte("hello world")},
+		{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+	read, err := log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), read.Offset)
+}
@@ -0,0 +1,62 @@
+package log
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+소비자가 로그의 끝까지 읽었다면 새 레코드가 추가될 때까지 기다려야 한다.
+레코드를 추가할 때마다 appended 채널을 닫고 새 채널로 바꾸는 방식으로 기다리는 모든 고루틴을 한 번에 깨운다.
+채널을 닫는 것은 여러 고루틴에 알리는 브로드캐스트로 쓸 수 있고, select로 콘텍스트의 취소와 함께 기다릴 수 있다.
+*/
+
+// ErrClosed는 로그가 닫혀서 더 이상 기다릴 수 없을 때의 에러이다.
+var ErrClosed = errors.New("log closed")
+
+// notifyAppended 메서드는 기다리는 고루틴들에게 레코드가 추가되었음을 알린다. l.mu를 잡은 상태에서 호출한다.
+func (l *Log) notifyAppended() {
+	if l.appended != nil {
+		close(l.appended)
+	}
+	l.appended = make(chan struct{})
+}
+
+/*
+Wait 메서드는 off 오프셋을 읽을 수 있을 때까지(로그의 다음 오프셋이 off보다 커질 때까지) 기다린다.
+이미 읽을 수 있다면 바로 리턴한다. ctx가 끝나면 ctx.Err()를, 로그가 닫히면 ErrClosed를 리턴한다.
+*/
+func (l *Log) Wait(ctx context.Context, off uint64) error {
+	return l.waitFor(ctx, func() bool {
+		return l.activeSegment.nextOffset > off
+	})
+}
+
+// WaitStable 메서드는 read_committed 소비자가 off 오프셋을 읽을 수 있을 때까지(LSO가 off보다 커질 때까지) 기다린다.
+// 트랜잭션을 끝내는 것도 마커를 추가하는 것이므로 Wait과 같이 추가될 때마다 다시 확인한다.
+func (l *Log) WaitStable(ctx context.Context, off uint64) error {
+	return l.waitFor(ctx, func() bool {
+		return l.txns.lastStableOffset(l.activeSegment.nextOffset) > off
+	})
+}
+
+// waitFor 메서드는 ready가 true가 될 때까지 레코드가 추가될 때마다 확인한다. ready는 l.mu를 잡은 상태에서 호출한다.
+func (l *Log) waitFor(ctx context.Context, ready func() bool) error {
+	for {
+		l.mu.Lock()
+		if ready() {
+			l.mu.Unlock()
+			return nil
+		}
+		appended := l.appended
+		l.mu.Unlock()
+
+		select {
+		case <-appended:
+		case <-l.closed:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
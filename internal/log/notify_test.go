@@ -0,0 +1,110 @@
+package log
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWait(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"returns when the offset is readable": testWaitReadable,
+		"wakes up on append":                  testWaitAppend,
+		"wakes up on batch append":            testWaitAppendBatch,
+		"honors context cancellation":         testWaitCancel,
+		"returns when the log is closed":      testWaitClosed,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "notify_test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, Config{})
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+// waitAsync 함수는 고루틴에서 Wait을 호출하고 결과를 채널로 돌려준다.
+func waitAsync(ctx context.Context, log *Log, off uint64) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- log.Wait(ctx, off)
+	}()
+	return errc
+}
+
+func requireBlocked(t *testing.T, errc <-chan error) {
+	t.Helper()
+	select {
+	case err := <-errc:
+		t.Fatalf("wait returned early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func requireWoken(t *testing.T, errc <-chan error, want error) {
+	t.Helper()
+	select {
+	case err := <-errc:
+		require.Equal(t, want, err)
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return")
+	}
+}
+
+func testWaitReadable(t *testing.T, log *Log) {
+	appendRecords(t, log, 2)
+	require.NoError(t, log.Wait(context.Background(), 1))
+}
+
+func testWaitAppend(t *testing.T, log *Log) {
+	errc := waitAsync(context.Background(), log, 1)
+	requireBlocked(t, errc)
+
+	// 오프셋 0이 추가되어도 1을 기다리는 고루틴은 계속 기다린다.
+	appendRecords(t, log, 1)
+	requireBlocked(t, errc)
+
+	appendRecords(t, log, 1)
+	requireWoken(t, errc, nil)
+}
+
+func testWaitAppendBatch(t *testing.T, log *Log) {
+	errc := waitAsync(context.Background(), log, 2)
+	requireBlocked(t, errc)
+
+	_, err := log.AppendBatch([]*api.Record{
+		{Value: []byte("hello world")},
+		{Value: []byte("hello world")},
+		{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	requireWoken(t, errc, nil)
+}
+
+func testWaitCancel(t *testing.T, log *Log) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := waitAsync(ctx, log, 0)
+	requireBlocked(t, errc)
+
+	cancel()
+	requireWoken(t, errc, context.Canceled)
+}
+
+func testWaitClosed(t *testing.T, log *Log) {
+	errc := waitAsync(context.Background(), log, 0)
+	requireBlocked(t, errc)
+
+	require.NoError(t, log.Close())
+	requireWoken(t, errc, ErrClosed)
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+OffsetStore는 컨슈머 그룹들이 커밋한 오프셋을 저장한다. 그룹은 토픽의 파티션마다 다음에 읽을 오프셋을 커밋하고,
+다시 연결했을 때 커밋한 위치부터 이어서 소비한다. 소비자가 자신의 오프셋을 따로 저장하지 않아도 된다.
+
+커밋은 내부 로그(Dir)에 레코드로 추가한다. 레코드의 키는 (그룹, 토픽, 파티션)이고 값은 커밋 요청을 직렬화한 것이다.
+같은 키의 이전 커밋은 필요 없으므로 이 로그는 항상 압축(Compaction)하고, 커밋이 리턴하면 디스크에 있도록 매번 fsync한다.
+마지막 커밋들은 메모리에도 두고, 시작할 때 로그를 처음부터 읽어서 다시 만든다.
+*/
+type OffsetStore struct {
+	Dir string
+
+	log     *Log
+	mu      sync.Mutex
+	offsets map[groupPartition]uint64
+}
+
+// groupPartition은 커밋한 오프셋의 키이다.
+type groupPartition struct {
+	group     string
+	topic     string
+	partition uint32
+}
+
+// key 메서드는 내부 로그 레코드의 키를 리턴한다. 압축은 키가 같은 레코드 중 마지막 것만 남긴다.
+func (k groupPartition) key() []byte {
+	return []byte(fmt.Sprintf("%s\x00%s\x00%d", k.group, k.topic, k.partition))
+}
+
+// NewOffsetStore 함수는 dir의 내부 로그를 열고 커밋된 오프셋들을 읽는다. c의 압축과 fsync 설정은 덮어쓴다.
+func NewOffsetStore(dir string, c Config) (*OffsetStore, error) {
+	c.Compaction.Enabled = true
+	c.Durability.Mode = DurabilityAlways
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l, err := NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+	s := &OffsetStore{
+		Dir:     dir,
+		log:     l,
+		offsets: make(map[groupPartition]uint64),
+	}
+	if err = s.load(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 메서드는 내부 로그의 커밋들을 순서대로 적용한다. 나중의 커밋이 이전 커밋을 덮어쓴다.
+func (s *OffsetStore) load() error {
+	lowest, err := s.log.LowestOffset()
+	if err != nil {
+		return err
+	}
+	it := s.log.Iterator(lowest)
+	for it.Next() {
+		var commit api.CommitOffsetRequest
+		if err := proto.Unmarshal(it.Record().Value, &commit); err != nil {
+			return err
+		}
+		s.offsets[groupPartition{commit.Group, commit.Topic, commit.Partition}] = commit.Offset
+	}
+	return it.Err()
+}
+
+// CommitOffset 메서드는 그룹이 토픽의 파티션에서 다음에 읽을 오프셋을 저장한다.
+func (s *OffsetStore) CommitOffset(group, topic string, partition uint32, offset uint64) error {
+	commit := &api.CommitOffsetRequest{
+		Group:     group,
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+	}
+	value, err := proto.Marshal(commit)
+	if err != nil {
+		return err
+	}
+	k := groupPartition{group, topic, partition}
+	// 로그에 추가하는 순서와 메모리에 적용하는 순서가 같아야 하므로 추가하는 동안 s.mu를 잡는다.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.log.Append(&api.Record{Key: k.key(), Value: value}); err != nil {
+		return err
+	}
+	s.offsets[k] = offset
+	return nil
+}
+
+// FetchCommittedOffset 메서드는 그룹이 커밋한 오프셋을 리턴한다. 커밋한 적이 없다면 api.ErrNoCommittedOffset를 리턴한다.
+func (s *OffsetStore) FetchCommittedOffset(group, topic string, partition uint32) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset, ok := s.offsets[groupPartition{group, topic, partition}]
+	if !ok {
+		return 0, api.ErrNoCommittedOffset{Group: group, Topic: topic, Partition: partition}
+	}
+	return offset, nil
+}
+
+// Close 메서드는 내부 로그를 닫는다.
+func (s *OffsetStore) Close() error {
+	return s.log.Close()
+}
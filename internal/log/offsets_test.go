@@ -0,0 +1,80 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "offsets-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewOffsetStore(dir, Config{})
+	require.NoError(t, err)
+
+	_, err = s.FetchCommittedOffset("g", "orders", 0)
+	require.Equal(t, api.ErrNoCommittedOffset{Group: "g", Topic: "orders", Partition: 0}, err)
+
+	require.NoError(t, s.CommitOffset("g", "orders", 0, 3))
+	require.NoError(t, s.CommitOffset("g", "orders", 1, 7))
+	require.NoError(t, s.CommitOffset("h", "orders", 0, 1))
+	require.NoError(t, s.CommitOffset("g", "", 0, 2))
+	require.NoError(t, s.CommitOffset("g", "orders", 0, 5))
+	require.NoError(t, s.Close())
+
+	// 다시 열면 내부 로그에서 그룹, 토픽, 파티션마다 마지막 커밋을 읽는다.
+	s, err = NewOffsetStore(dir, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+	for k, want := range map[groupPartition]uint64{
+		{"g", "orders", 0}: 5,
+		{"g", "orders", 1}: 7,
+		{"h", "orders", 0}: 1,
+		{"g", "", 0}:       2,
+	} {
+		got, err := s.FetchCommittedOffset(k.group, k.topic, k.partition)
+		require.NoError(t, err)
+		require.Equal(t, want, got, "%v", k)
+	}
+	_, err = s.FetchCommittedOffset("h", "orders", 1)
+	require.IsType(t, api.ErrNoCommittedOffset{}, err)
+}
+
+func TestOffsetStoreCompaction(t *testing.T) {
+	dir, err := os.MkdirTemp("", "offsets-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 256
+	s, err := NewOffsetStore(dir, c)
+	require.NoError(t, err)
+	for i := uint64(0); i < 100; i++ {
+		require.NoError(t, s.CommitOffset("g", "orders", uint32(i%2), i))
+	}
+	// 압축하면 키마다 마지막 커밋만 남는다. 활성 세그먼트의 레코드는 압축하지 않는다.
+	require.NoError(t, s.log.Compact())
+	lowest, err := s.log.LowestOffset()
+	require.NoError(t, err)
+	var records int
+	it := s.log.Iterator(lowest)
+	for it.Next() {
+		records++
+	}
+	require.NoError(t, it.Err())
+	require.Less(t, records, 100)
+	require.NoError(t, s.Close())
+
+	s, err = NewOffsetStore(dir, c)
+	require.NoError(t, err)
+	defer s.Close()
+	for p, want := range map[uint32]uint64{0: 98, 1: 99} {
+		got, err := s.FetchCommittedOffset("g", "orders", p)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+}
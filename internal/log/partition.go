@@ -0,0 +1,263 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+/*
+하나의 Log는 l.mu 뮤텍스 하나로 추가를 직렬화하므로 한 로그에 쓰는 속도에는 한계가 있다.
+PartitionedLog는 스트림을 N개의 파티션으로 나누고 파티션마다 독립된 Log를 둔다. 파티션들은 서로 다른 뮤텍스와 파일을 쓰므로 동시에 추가할 수 있다.
+
+	Dir/0/, Dir/1/, ... : 파티션의 Log 디렉터리
+
+레코드를 추가할 파티션은 레코드의 키로 정한다(키의 해시를 파티션 수로 나눈 나머지). 같은 키의 레코드는 항상 같은 파티션에 순서대로 추가된다.
+키가 없는 레코드는 파티션들에 돌아가면서 추가한다. 오프셋은 파티션마다 0부터 시작하므로 레코드의 위치는 (파티션, 오프셋)이다.
+
+파티션을 모르는 호출자를 위해 CommitLog의 메서드들도 구현한다. 추가는 위와 같이 파티션을 고르고, 읽기는 0번 파티션을 읽는다.
+
+토픽을 지울 때(TopicManager.DeleteTopic) 다른 요청이 아직 이 로그를 사용하고 있을 수 있다. 그래서 메서드들은 mu의 읽기 락을 잡고 파티션을 사용하고,
+Close와 Remove는 쓰기 락을 잡아서 처리 중인 호출이 끝나기를 기다린 후에 닫는다. 닫은 후의 호출은 파일을 건드리지 않고 닫은 이유의 에러를 리턴한다.
+새 레코드를 기다리는 Wait은 락을 잡지 않고 기다리다가, 로그가 닫히면 같은 에러를 리턴한다.
+*/
+type PartitionedLog struct {
+	Dir    string
+	Config Config
+
+	partitions []*Log
+	mu         sync.RWMutex
+	// closed는 닫은 후의 호출이 리턴할 에러이다. nil이면 열려있다. 지운 토픽이라면 api.ErrTopicNotFound이다.
+	closed error
+	// next는 키가 없는 레코드를 추가할 다음 파티션이다(round-robin).
+	next uint32
+}
+
+// NewPartitionedLog 함수는 dir 아래에 n개의 파티션 Log를 연다. 파티션 수는 호출자가 저장하고 같은 값으로 다시 열어야 한다.
+func NewPartitionedLog(dir string, c Config, n uint32) (*PartitionedLog, error) {
+	if n == 0 {
+		n = 1
+	}
+	l := &PartitionedLog{
+		Dir:    dir,
+		Config: c,
+	}
+	for p := uint32(0); p < n; p++ {
+		pdir := filepath.Join(dir, fmt.Sprintf("%d", p))
+		if err := os.MkdirAll(pdir, 0755); err != nil {
+			l.Close()
+			return nil, err
+		}
+		partition, err := NewLog(pdir, c)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.partitions = append(l.partitions, partition)
+	}
+	return l, nil
+}
+
+// Partitions 메서드는 파티션의 수를 리턴한다.
+func (l *PartitionedLog) Partitions() uint32 {
+	return uint32(len(l.partitions))
+}
+
+// Partition 메서드는 p번 파티션의 Log를 리턴한다.
+func (l *PartitionedLog) Partition(p uint32) (*Log, error) {
+	if p >= uint32(len(l.partitions)) {
+		return nil, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.partitions[p], nil
+}
+
+/*
+Route 메서드는 레코드를 추가할 파티션을 고른다. 키가 있다면 키의 FNV-1a 해시로, 없다면 돌아가면서 고른다.
+멱등 프로듀서의 키가 없는 레코드는 프로듀서 ID로 고른다. 시퀀스는 파티션마다 매기므로 한 프로듀서의 레코드들이 한 파티션에 차례로 가야 한다.
+*/
+func (l *PartitionedLog) Route(record *api.Record) uint32 {
+	n := uint32(len(l.partitions))
+	if len(record.Key) > 0 {
+		h := fnv.New32a()
+		h.Write(record.Key)
+		return h.Sum32() % n
+	}
+	if record.ProducerId != 0 {
+		return uint32(record.ProducerId % uint64(n))
+	}
+	return (atomic.AddUint32(&l.next, 1) - 1) % n
+}
+
+// use 메서드는 p번 파티션으로 fn을 호출한다. 로그가 닫혔다면 fn을 호출하지 않고 닫은 이유의 에러를 리턴한다.
+func (l *PartitionedLog) use(p uint32, fn func(*Log) error) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed != nil {
+		return l.closed
+	}
+	partition, err := l.Partition(p)
+	if err != nil {
+		return err
+	}
+	return fn(partition)
+}
+
+// wait 메서드는 p번 파티션에서 락을 잡지 않고 기다린다. 기다리는 동안 로그가 닫혔다면 닫은 이유의 에러를 리턴한다.
+func (l *PartitionedLog) wait(p uint32, fn func(*Log) error) error {
+	var partition *Log
+	if err := l.use(p, func(pl *Log) error {
+		partition = pl
+		return nil
+	}); err != nil {
+		return err
+	}
+	err := fn(partition)
+	if err != ErrClosed {
+		return err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed != nil {
+		return l.closed
+	}
+	return err
+}
+
+func (l *PartitionedLog) AppendPartition(p uint32, record *api.Record) (off uint64, err error) {
+	err = l.use(p, func(partition *Log) error {
+		off, err = partition.Append(record)
+		return err
+	})
+	return off, err
+}
+
+func (l *PartitionedLog) AppendBatchPartition(p uint32, records []*api.Record) (off uint64, err error) {
+	err = l.use(p, func(partition *Log) error {
+		off, err = partition.AppendBatch(records)
+		return err
+	})
+	return off, err
+}
+
+func (l *PartitionedLog) ReadPartition(p uint32, offset uint64) (record *api.Record, err error) {
+	err = l.use(p, func(partition *Log) error {
+		record, err = partition.Read(offset)
+		return err
+	})
+	return record, err
+}
+
+func (l *PartitionedLog) ReadRangePartition(p uint32, from uint64, maxRecords int, maxBytes uint64) (records []*api.Record, err error) {
+	err = l.use(p, func(partition *Log) error {
+		records, err = partition.ReadRange(from, maxRecords, maxBytes)
+		return err
+	})
+	return records, err
+}
+
+func (l *PartitionedLog) OffsetForTimePartition(p uint32, t time.Time) (off uint64, err error) {
+	err = l.use(p, func(partition *Log) error {
+		off, err = partition.OffsetForTime(t)
+		return err
+	})
+	return off, err
+}
+
+func (l *PartitionedLog) WaitPartition(ctx context.Context, p uint32, off uint64) error {
+	return l.wait(p, func(partition *Log) error {
+		return partition.Wait(ctx, off)
+	})
+}
+
+func (l *PartitionedLog) LastStableOffsetPartition(p uint32) (lso uint64, err error) {
+	err = l.use(p, func(partition *Log) error {
+		lso = partition.LastStableOffset()
+		return nil
+	})
+	return lso, err
+}
+
+func (l *PartitionedLog) AbortedPartition(p uint32, txnID uint64) (aborted bool, err error) {
+	err = l.use(p, func(partition *Log) error {
+		aborted = partition.Aborted(txnID)
+		return nil
+	})
+	return aborted, err
+}
+
+func (l *PartitionedLog) WaitStablePartition(ctx context.Context, p uint32, off uint64) error {
+	return l.wait(p, func(partition *Log) error {
+		return partition.WaitStable(ctx, off)
+	})
+}
+
+// Append 메서드는 레코드의 키로 고른 파티션에 레코드를 추가하고 그 파티션의 오프셋을 리턴한다.
+func (l *PartitionedLog) Append(record *api.Record) (uint64, error) {
+	return l.AppendPartition(l.Route(record), record)
+}
+
+// AppendBatch 메서드는 배치 전체를 첫 번째 레코드로 고른 한 파티션에 추가한다. 배치는 한 파티션 안에서만 연속한 오프셋을 가질 수 있다.
+func (l *PartitionedLog) AppendBatch(records []*api.Record) (uint64, error) {
+	if len(records) == 0 {
+		return 0, ErrEmptyBatch
+	}
+	return l.AppendBatchPartition(l.Route(records[0]), records)
+}
+
+func (l *PartitionedLog) Read(offset uint64) (*api.Record, error) {
+	return l.ReadPartition(0, offset)
+}
+
+func (l *PartitionedLog) ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	return l.ReadRangePartition(0, from, maxRecords, maxBytes)
+}
+
+func (l *PartitionedLog) OffsetForTime(t time.Time) (uint64, error) {
+	return l.OffsetForTimePartition(0, t)
+}
+
+func (l *PartitionedLog) Wait(ctx context.Context, off uint64) error {
+	return l.WaitPartition(ctx, 0, off)
+}
+
+// Close 메서드는 처리 중인 호출이 끝나기를 기다린 후 모든 파티션을 닫는다. 닫은 후의 호출은 ErrClosed를 리턴한다.
+func (l *PartitionedLog) Close() error {
+	return l.close(ErrClosed)
+}
+
+// close 메서드는 처리 중인 호출이 끝나기를 기다린 후 모든 파티션을 닫는다. 닫은 후의 호출은 reason을 리턴한다.
+func (l *PartitionedLog) close(reason error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed != nil {
+		return nil
+	}
+	l.closed = reason
+	var err error
+	for _, partition := range l.partitions {
+		if cerr := partition.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Remove 메서드는 모든 파티션을 닫고 디렉터리를 지운다.
+func (l *PartitionedLog) Remove() error {
+	return l.remove(ErrClosed)
+}
+
+// remove 메서드는 모든 파티션을 닫고 디렉터리를 지운다. 닫은 후의 호출은 reason을 리턴한다.
+func (l *PartitionedLog) remove(reason error) error {
+	if err := l.close(reason); err != nil {
+		return err
+	}
+	return os.RemoveAll(l.Dir)
+}
@@ -0,0 +1,130 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionedLog(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, dir string){
+		"records with the same key go to the same partition": testPartitionByKey,
+		"records without a key are spread round-robin":       testPartitionRoundRobin,
+		"partitions persist across restarts":                 testPartitionsPersist,
+		"unknown partition fails":                            testPartitionNotFound,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "partition-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			fn(t, dir)
+		})
+	}
+}
+
+func testPartitionByKey(t *testing.T, dir string) {
+	l, err := NewPartitionedLog(dir, Config{}, 4)
+	require.NoError(t, err)
+	defer l.Close()
+	require.Equal(t, uint32(4), l.Partitions())
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	for i := 0; i < 3; i++ {
+		for _, key := range keys {
+			p := l.Route(&api.Record{Key: key})
+			off, err := l.Append(&api.Record{Key: key, Value: []byte{byte(i)}})
+			require.NoError(t, err)
+			record, err := l.ReadPartition(p, off)
+			require.NoError(t, err)
+			require.Equal(t, key, record.Key)
+			require.Equal(t, []byte{byte(i)}, record.Value)
+		}
+	}
+
+	// 오프셋은 파티션마다 0부터 이어진다.
+	var total int
+	for p := uint32(0); p < l.Partitions(); p++ {
+		records, err := l.ReadRangePartition(p, 0, 100, 1<<20)
+		if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+			continue
+		}
+		require.NoError(t, err)
+		for i, record := range records {
+			require.Equal(t, uint64(i), record.Offset)
+			require.Equal(t, p, l.Route(record))
+		}
+		total += len(records)
+	}
+	require.Equal(t, 3*len(keys), total)
+}
+
+func testPartitionRoundRobin(t *testing.T, dir string) {
+	l, err := NewPartitionedLog(dir, Config{}, 3)
+	require.NoError(t, err)
+	defer l.Close()
+
+	for i := 0; i < 6; i++ {
+		require.Equal(t, uint32(i%3), l.Route(&api.Record{}))
+	}
+	// 멱등 프로듀서의 키가 없는 레코드는 항상 같은 파티션으로 간다.
+	for i := 0; i < 3; i++ {
+		require.Equal(t, uint32(7%3), l.Route(&api.Record{ProducerId: 7}))
+	}
+	for i := 0; i < 6; i++ {
+		_, err = l.Append(&api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+	}
+	for p := uint32(0); p < 3; p++ {
+		records, err := l.ReadRangePartition(p, 0, 100, 1<<20)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(records))
+	}
+
+	// 배치는 한 파티션에 연속한 오프셋으로 추가된다.
+	first, err := l.AppendBatchPartition(1, []*api.Record{
+		{Value: []byte("b0")},
+		{Value: []byte("b1")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), first)
+	_, err = l.AppendBatch(nil)
+	require.Equal(t, ErrEmptyBatch, err)
+}
+
+func testPartitionsPersist(t *testing.T, dir string) {
+	l, err := NewPartitionedLog(dir, Config{}, 2)
+	require.NoError(t, err)
+	_, err = l.AppendPartition(1, &api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	for _, p := range []string{"0", "1"} {
+		_, err = os.Stat(filepath.Join(dir, p))
+		require.NoError(t, err)
+	}
+
+	l, err = NewPartitionedLog(dir, Config{}, 2)
+	require.NoError(t, err)
+	defer l.Close()
+	record, err := l.ReadPartition(1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+	_, err = l.Read(0)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+}
+
+func testPartitionNotFound(t *testing.T, dir string) {
+	// 파티션 수가 0이면 파티션 하나로 연다.
+	l, err := NewPartitionedLog(dir, Config{}, 0)
+	require.NoError(t, err)
+	defer l.Close()
+	require.Equal(t, uint32(1), l.Partitions())
+
+	_, err = l.AppendPartition(1, &api.Record{Value: []byte("hello")})
+	require.Equal(t, api.ErrPartitionNotFound{Partition: 1}, err)
+	_, err = l.ReadPartition(1, 0)
+	require.Equal(t, api.ErrPartitionNotFound{Partition: 1}, err)
+}
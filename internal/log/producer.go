@@ -0,0 +1,97 @@
+package log
+
+import (
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+/*
+멱등 프로듀서(idempotent producer)는 레코드마다 프로듀서 ID와 시퀀스 번호를 붙인다. 시퀀스는 프로듀서마다 1씩 증가한다.
+생산 요청의 응답을 받지 못한 프로듀서가 같은 레코드를 다시 보내면, 로그는 레코드를 다시 추가하지 않고 처음 추가한 오프셋을 리턴한다.
+
+producers는 로그(파티션)마다 프로듀서의 최근 시퀀스들과 그 오프셋을 기억하는 중복 제거 테이블이다. 시퀀스는 로그마다 따로 매기므로
+파티션으로 나눈 토픽에서는 (프로듀서, 파티션)마다 시퀀스를 센다.
+  - 처음 보는 프로듀서의 레코드는 어느 시퀀스로든 시작할 수 있다. 보존 정책으로 이전 레코드들이 지워졌을 수 있기 때문이다.
+  - 마지막 시퀀스 + 1인 레코드는 추가한다.
+  - 최근 producerWindow개의 구간 안의 시퀀스는 중복이므로 추가하지 않고 원래 오프셋을 리턴한다.
+  - 그 밖의 시퀀스(건너뛰었거나 너무 오래된 것)는 api.ErrOutOfOrderSequence이다.
+
+테이블은 시퀀스 하나마다가 아니라 연속한 오프셋에 추가한 연속한 시퀀스의 구간(sequenceRun)마다 첫 오프셋을 기억한다.
+배치는 한 구간이 되므로, 응답을 받지 못해서 다시 보낸 배치는 크기와 상관없이 중복으로 알아보고 원래의 첫 오프셋을 리턴한다.
+구간 안의 시퀀스의 오프셋은 첫 오프셋에서 시퀀스의 차이만큼 떨어져 있다.
+
+테이블은 레코드에 저장된 프로듀서 ID와 시퀀스로부터 만들 수 있으므로 따로 저장하지 않고, Log를 시작할 때 세그먼트들을 읽어서 다시 만든다.
+*/
+type producers map[uint64]*producerState
+
+// producerWindow는 프로듀서마다 기억하는 최근 구간의 수이다. 프로듀서가 응답을 기다리지 않고 보낼 수 있는 요청의 수보다 커야 한다.
+const producerWindow = 8
+
+type producerState struct {
+	// recent는 최근에 추가한 레코드들의 구간이다. 마지막 항목이 가장 최근이다.
+	recent []sequenceRun
+}
+
+// sequenceRun은 first부터 last까지의 시퀀스를 offset부터 연속한 오프셋에 추가한 구간이다.
+type sequenceRun struct {
+	first  uint64
+	last   uint64
+	offset uint64
+}
+
+/*
+check 메서드는 레코드를 추가해도 되는지 확인한다. 중복이라면 dup이 true이고 원래 오프셋을 리턴한다.
+next는 같은 배치에서 먼저 확인한 레코드들의 다음 시퀀스이며, 배치가 아니라면 nil이다.
+*/
+func (p producers) check(record *api.Record, next map[uint64]uint64) (offset uint64, dup bool, err error) {
+	if want, ok := next[record.ProducerId]; ok {
+		if record.Sequence != want {
+			return 0, false, api.ErrOutOfOrderSequence{
+				ProducerID: record.ProducerId,
+				Sequence:   record.Sequence,
+				Expected:   want,
+			}
+		}
+		return 0, false, nil
+	}
+	st, ok := p[record.ProducerId]
+	if !ok {
+		return 0, false, nil
+	}
+	last := st.recent[len(st.recent)-1].last
+	if record.Sequence == last+1 {
+		return 0, false, nil
+	}
+	for _, run := range st.recent {
+		if run.first <= record.Sequence && record.Sequence <= run.last {
+			return run.offset + (record.Sequence - run.first), true, nil
+		}
+	}
+	return 0, false, api.ErrOutOfOrderSequence{
+		ProducerID: record.ProducerId,
+		Sequence:   record.Sequence,
+		Expected:   last + 1,
+	}
+}
+
+// add 메서드는 추가한 레코드의 시퀀스와 오프셋을 기록한다. 마지막 구간에 이어지는 레코드라면 구간을 늘린다.
+func (p producers) add(record *api.Record) {
+	if record.ProducerId == 0 {
+		return
+	}
+	st, ok := p[record.ProducerId]
+	if !ok {
+		st = &producerState{}
+		p[record.ProducerId] = st
+	}
+	if n := len(st.recent); n > 0 {
+		run := &st.recent[n-1]
+		if record.Sequence == run.last+1 && record.Offset == run.offset+(record.Sequence-run.first) {
+			run.last = record.Sequence
+			return
+		}
+	}
+	st.recent = append(st.recent, sequenceRun{record.Sequence, record.Sequence, record.Offset})
+	if len(st.recent) > producerWindow {
+		st.recent = append(st.recent[:0], st.recent[len(st.recent)-producerWindow:]...)
+	}
+}
@@ -0,0 +1,169 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentProducer(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, log *Log){
+		"duplicate returns the original offset": testProducerDuplicate,
+		"out of order sequence fails":           testProducerOutOfOrder,
+		"dedup table is rebuilt on restart":     testProducerRestart,
+		"batches are deduplicated":              testProducerBatch,
+		"batches larger than the window":        testProducerLargeBatch,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "producer-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			c := Config{}
+			c.Segment.MaxStoreBytes = 128
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+			fn(t, log)
+		})
+	}
+}
+
+// produce 함수는 프로듀서 1의 레코드를 추가한다.
+func produce(t *testing.T, log *Log, seq uint64) (uint64, error) {
+	t.Helper()
+	return log.Append(&api.Record{Value: []byte("hello"), ProducerId: 1, Sequence: seq})
+}
+
+func testProducerDuplicate(t *testing.T, log *Log) {
+	for seq := uint64(5); seq < 8; seq++ {
+		off, err := produce(t, log, seq)
+		require.NoError(t, err)
+		require.Equal(t, seq-5, off)
+	}
+	// 다른 프로듀서와 멱등이 아닌 레코드는 시퀀스와 상관없다.
+	_, err := log.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	_, err = log.Append(&api.Record{Value: []byte("hello"), ProducerId: 2, Sequence: 6})
+	require.NoError(t, err)
+
+	for seq, want := range map[uint64]uint64{5: 0, 6: 1, 7: 2} {
+		off, err := produce(t, log, seq)
+		require.NoError(t, err)
+		require.Equal(t, want, off)
+	}
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), off)
+}
+
+func testProducerOutOfOrder(t *testing.T, log *Log) {
+	_, err := produce(t, log, 0)
+	require.NoError(t, err)
+	_, err = produce(t, log, 2)
+	require.Equal(t, api.ErrOutOfOrderSequence{ProducerID: 1, Sequence: 2, Expected: 1}, err)
+
+	// 기억하는 범위보다 오래된 시퀀스는 중복인지 알 수 없다. 다른 프로듀서의 레코드가 사이에 있으면 구간이 이어지지 않는다.
+	for seq := uint64(1); seq <= producerWindow+1; seq++ {
+		_, err = produce(t, log, seq)
+		require.NoError(t, err)
+		_, err = log.Append(&api.Record{Value: []byte("hello"), ProducerId: 2, Sequence: seq})
+		require.NoError(t, err)
+	}
+	_, err = produce(t, log, 0)
+	require.IsType(t, api.ErrOutOfOrderSequence{}, err)
+	_, err = produce(t, log, 2)
+	require.NoError(t, err)
+}
+
+func testProducerRestart(t *testing.T, log *Log) {
+	// 여러 세그먼트에 걸쳐서 추가한다.
+	for seq := uint64(0); seq < 10; seq++ {
+		_, err := produce(t, log, seq)
+		require.NoError(t, err)
+	}
+	require.Greater(t, len(log.segments), 1)
+	require.NoError(t, log.Close())
+
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer n.Close()
+	off, err := produce(t, n, 9)
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), off)
+	off, err = produce(t, n, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), off)
+}
+
+func testProducerBatch(t *testing.T, log *Log) {
+	batch := func(first uint64) []*api.Record {
+		var records []*api.Record
+		for i := uint64(0); i < 3; i++ {
+			records = append(records, &api.Record{Value: []byte("hello"), ProducerId: 1, Sequence: first + i})
+		}
+		return records
+	}
+	first, err := log.AppendBatch(batch(0))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+
+	first, err = log.AppendBatch(batch(0))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), first)
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+
+	// 배치 안의 시퀀스가 이어지지 않거나, 중간부터 중복인 배치는 추가하지 않는다.
+	records := batch(3)
+	records[2].Sequence = 9
+	_, err = log.AppendBatch(records)
+	require.IsType(t, api.ErrOutOfOrderSequence{}, err)
+	_, err = log.AppendBatch(append([]*api.Record{{ProducerId: 1, Sequence: 3}}, batch(2)...))
+	require.IsType(t, api.ErrOutOfOrderSequence{}, err)
+
+	first, err = log.AppendBatch(batch(3))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), first)
+}
+
+// 응답을 받지 못해서 다시 보낸 배치는 producerWindow보다 크더라도 원래의 첫 오프셋을 리턴한다.
+func testProducerLargeBatch(t *testing.T, log *Log) {
+	batch := func() []*api.Record {
+		var records []*api.Record
+		for seq := uint64(0); seq < 20; seq++ {
+			records = append(records, &api.Record{Value: []byte("hello"), ProducerId: 5, Sequence: seq})
+		}
+		return records
+	}
+	_, err := log.Append(&api.Record{Value: []byte("before")})
+	require.NoError(t, err)
+	first, err := log.AppendBatch(batch())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+
+	first, err = log.AppendBatch(batch())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	// 배치 안의 레코드 하나만 다시 보내도 그 레코드의 오프셋을 리턴한다.
+	off, err := log.Append(&api.Record{Value: []byte("hello"), ProducerId: 5, Sequence: 7})
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), off)
+	off, err = log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), off)
+
+	// 다시 시작해서 세그먼트로부터 테이블을 만들어도 마찬가지이다.
+	require.NoError(t, log.Close())
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer n.Close()
+	first, err = n.AppendBatch(batch())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+	off, err = n.Append(&api.Record{Value: []byte("hello"), ProducerId: 5, Sequence: 20})
+	require.NoError(t, err)
+	require.Equal(t, uint64(21), off)
+}
@@ -0,0 +1,107 @@
+package log
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+/*
+리더는 팔로워들이 얼마나 복제했는지(복제 지연)를 알려줘야 한다. 하지만 Raft 라이브러리는 팔로워가 복제한 Raft 인덱스를 공개하지 않고,
+Raft 인덱스와 로그의 오프셋은 다르다(설정 변경 같은 명령이 아닌 엔트리도 있고, 배치 명령은 여러 레코드를 추가한다).
+
+progress는 두 가지를 기록해서 팔로워의 다음 오프셋을 계산한다.
+  - matched : 팔로워가 AppendEntries(하트비트 포함)에 응답한 마지막 Raft 인덱스. progressTransport가 기록한다.
+  - applied : FSM이 명령을 적용한 Raft 인덱스와 적용한 후 로그의 다음 오프셋. 인덱스 순서로 최근 maxAppliedEntries개만 남긴다.
+
+팔로워가 가진 마지막 인덱스 이하로 가장 최근에 적용한 명령을 찾으면 그 명령을 적용한 후의 다음 오프셋이 팔로워의 다음 오프셋이다.
+팔로워가 applied에 남아있는 것보다 오래된 인덱스에 있다면 알 수 없다.
+*/
+type progress struct {
+	mu      sync.Mutex
+	matched map[raft.ServerID]uint64
+	applied []appliedEntry
+}
+
+type appliedEntry struct {
+	index uint64
+	next  uint64
+}
+
+// maxAppliedEntries는 progress가 기억하는 최근 명령의 수이다. 팔로워가 이보다 많이 뒤처지면 지연을 알 수 없다.
+const maxAppliedEntries = 1 << 16
+
+func newProgress() *progress {
+	return &progress{
+		matched: make(map[raft.ServerID]uint64),
+	}
+}
+
+// apply 메서드는 FSM이 index의 명령을 적용한 후 로그의 다음 오프셋이 next임을 기록한다.
+func (p *progress) apply(index, next uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.applied) == maxAppliedEntries {
+		// 앞을 잘라내도 append가 새 배열을 할당할 때 잘라낸 부분은 버려진다.
+		p.applied = p.applied[1:]
+	}
+	p.applied = append(p.applied, appliedEntry{index: index, next: next})
+}
+
+// reset 메서드는 스냅숏으로 상태를 복원했을 때 이전에 적용한 명령들의 기록을 지운다.
+func (p *progress) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.applied = nil
+}
+
+// match 메서드는 id의 팔로워가 index까지의 Raft 로그를 가지고 있음을 기록한다.
+func (p *progress) match(id raft.ServerID, index uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.matched[id] = index
+}
+
+// nextOffset 메서드는 id의 팔로워가 복제한 로그의 다음 오프셋을 계산한다. 알 수 없다면 false를 리턴한다.
+func (p *progress) nextOffset(id raft.ServerID) (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	index, ok := p.matched[id]
+	if !ok {
+		return 0, false
+	}
+	// index보다 큰 첫 번째 명령의 바로 앞이 팔로워가 마지막으로 적용할 수 있는 명령이다.
+	i := sort.Search(len(p.applied), func(i int) bool {
+		return p.applied[i].index > index
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return p.applied[i-1].next, true
+}
+
+var _ raft.Transport = (*progressTransport)(nil)
+
+/*
+progressTransport는 NetworkTransport를 감싸서 팔로워들이 AppendEntries에 응답한 마지막 인덱스를 progress에 기록한다.
+리더는 팔로워마다 하트비트를 AppendEntries로 보내므로 파이프라인으로 복제하는 동안에도 하트비트 간격으로 기록된다.
+NetworkTransport를 임베딩하므로 Close 같은 다른 메서드들은 그대로 사용한다.
+*/
+type progressTransport struct {
+	*raft.NetworkTransport
+	progress *progress
+}
+
+func (t *progressTransport) AppendEntries(
+	id raft.ServerID,
+	target raft.ServerAddress,
+	args *raft.AppendEntriesRequest,
+	resp *raft.AppendEntriesResponse,
+) error {
+	if err := t.NetworkTransport.AppendEntries(id, target, args, resp); err != nil {
+		return err
+	}
+	t.progress.match(id, resp.LastLog)
+	return nil
+}
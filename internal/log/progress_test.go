@@ -0,0 +1,60 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	p := newProgress()
+
+	// 응답한 적이 없는 팔로워는 알 수 없다.
+	_, ok := p.nextOffset("1")
+	require.False(t, ok)
+
+	// 인덱스 3은 설정 변경처럼 FSM이 적용하지 않는 엔트리이다.
+	p.apply(2, 1)
+	p.apply(4, 3)
+	p.apply(5, 4)
+
+	for index, want := range map[uint64]uint64{
+		2: 1,
+		3: 1,
+		4: 3,
+		9: 4,
+	} {
+		p.match("1", index)
+		next, ok := p.nextOffset("1")
+		require.True(t, ok)
+		require.Equal(t, want, next, "index %d", index)
+	}
+
+	// 기록보다 오래된 인덱스는 알 수 없다.
+	p.match("2", 1)
+	_, ok = p.nextOffset("2")
+	require.False(t, ok)
+
+	// 스냅숏으로 복원하면 이전 기록은 쓸 수 없다.
+	p.reset()
+	_, ok = p.nextOffset(raft.ServerID("1"))
+	require.False(t, ok)
+}
+
+func TestProgressTrim(t *testing.T) {
+	p := newProgress()
+	for i := uint64(1); i <= maxAppliedEntries+10; i++ {
+		p.apply(i, i)
+	}
+	require.Equal(t, maxAppliedEntries, len(p.applied))
+	require.Equal(t, uint64(11), p.applied[0].index)
+
+	p.match("1", 10)
+	_, ok := p.nextOffset("1")
+	require.False(t, ok)
+	p.match("1", 11)
+	next, ok := p.nextOffset("1")
+	require.True(t, ok)
+	require.Equal(t, uint64(11), next)
+}
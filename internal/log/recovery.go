@@ -0,0 +1,158 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+서비스가 비정상적으로 종료되면(크래시, 전원 차단 등) 활성 세그먼트의 끝부분이 깨져 있을 수 있다.
+  - store.Append와 index.Write 사이에서 멈췄다면 스토어에는 인덱스가 없는 레코드가 남는다.
+  - index.Close가 호출되지 않았다면 인덱스 파일은 MaxIndexBytes 크기 그대로이고 뒷부분은 0으로 채워져 있다.
+  - 레코드를 쓰다가 멈췄다면 스토어의 마지막 레코드가 잘려 있다.
+
+Log.setup은 마지막 세그먼트(와 인덱스 파일이 없는 세그먼트)를 스토어 기준으로 검사하고 복구한다.
+스토어의 온전한 레코드가 기준이며, 인덱스는 스토어에 맞게 잘라내거나 다시 만든다.
+복구한 내용은 RecoveryReport로 남겨서 운영자가 로그로 남길 수 있게 한다.
+*/
+
+// SegmentRecovery는 세그먼트 하나를 복구한 결과이다.
+type SegmentRecovery struct {
+	BaseOffset          uint64
+	IndexRebuilt        bool   // .offset 파일이 없어서 스토어로부터 다시 만들었다.
+	IndexUnclean        bool   // 인덱스 파일이 정상적으로 닫히지 않았다.(0으로 채워진 뒷부분이 남아있었다.)
+	IndexEntriesDropped int    // 스토어에 없는 레코드를 가리키던 인덱스 항목의 개수
+	IndexEntriesAdded   int    // 인덱스에 없던 스토어의 레코드를 인덱스에 추가한 개수
+	StoreBytesTruncated uint64 // 잘려나간 스토어의 바이트 수(쓰다가 멈춘 레코드)
+	CorruptRecords      int    // 체크섬이 맞지 않지만 남겨둔 중간의 레코드 개수
+}
+
+// Repaired 메서드는 세그먼트를 고쳤는지를 리턴한다.
+func (r SegmentRecovery) Repaired() bool {
+	return r.IndexRebuilt || r.IndexUnclean || r.IndexEntriesDropped > 0 ||
+		r.IndexEntriesAdded > 0 || r.StoreBytesTruncated > 0
+}
+
+func (r SegmentRecovery) String() string {
+	return fmt.Sprintf(
+		"segment %d: index_rebuilt=%t index_unclean=%t index_entries_dropped=%d index_entries_added=%d store_bytes_truncated=%d corrupt_records=%d",
+		r.BaseOffset,
+		r.IndexRebuilt,
+		r.IndexUnclean,
+		r.IndexEntriesDropped,
+		r.IndexEntriesAdded,
+		r.StoreBytesTruncated,
+		r.CorruptRecords,
+	)
+}
+
+// RecoveryReport는 Log를 시작할 때 검사한 세그먼트들의 복구 결과이다.
+type RecoveryReport struct {
+	Segments []SegmentRecovery
+	// OpenTransactions는 시작할 때 끝나지 않은 채로 남아있던 트랜잭션의 수이다. 클라이언트가 이어서 끝내거나 타임아웃으로 중단된다.
+	OpenTransactions int
+}
+
+// Repaired 메서드는 고친 세그먼트가 하나라도 있는지를 리턴한다.
+func (r RecoveryReport) Repaired() bool {
+	for _, s := range r.Segments {
+		if s.Repaired() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r RecoveryReport) String() string {
+	lines := make([]string, len(r.Segments))
+	for i, s := range r.Segments {
+		lines[i] = s.String()
+	}
+	if r.OpenTransactions > 0 {
+		lines = append(lines, fmt.Sprintf("open_transactions=%d", r.OpenTransactions))
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+recover 메서드는 스토어를 처음부터 읽어서 온전한 레코드의 위치를 구하고, 인덱스의 항목들과 비교한다.
+앞에서부터 스토어와 일치하는 인덱스 항목만 남기고 나머지는 지운 뒤, 인덱스에 없는 스토어의 레코드를 인덱스에 추가한다.
+추가하는 항목의 오프셋은 레코드에 담긴 오프셋을 사용하므로 압축한 세그먼트도 복구할 수 있다.
+인덱스가 가득 차서 추가할 수 없는 레코드와 잘린 레코드는 스토어에서 잘라낸다.
+마지막으로 nextOffset과 가장 큰 타임스탬프를 다시 계산한다.
+*/
+func (s *segment) recover(indexMissing bool) (SegmentRecovery, error) {
+	r := SegmentRecovery{
+		BaseOffset:   s.baseOffset,
+		IndexRebuilt: indexMissing,
+	}
+	positions, end, corrupt, err := s.store.scan()
+	if err != nil {
+		return r, err
+	}
+	r.CorruptRecords = corrupt
+
+	// 인덱스 파일이 정상적으로 닫혔다면 크기는 항목 크기의 배수이고, 0으로 채워진 항목이 뒤에 남아있지 않다.
+	entries := s.index.entries()
+	r.IndexUnclean = s.index.size%entWidth != 0 || s.index.size > uint64(len(s.index.mmap))
+
+	// 압축한 세그먼트는 오프셋 사이에 빈 곳이 있으므로, 항목의 상대 오프셋은 증가하기만 하면 된다.
+	var n uint64
+	var next uint32 // 다음 항목이 가질 수 있는 가장 작은 상대 오프셋
+	for ; n < entries && n < uint64(len(positions)); n++ {
+		off, pos := s.index.entry(n)
+		if pos != positions[n] || off < next {
+			break
+		}
+		next = off + 1
+	}
+	for k := n; k < entries; k++ {
+		if off, pos := s.index.entry(k); off != 0 || pos != 0 {
+			r.IndexEntriesDropped++
+		} else {
+			r.IndexUnclean = true
+		}
+	}
+	s.index.truncate(n)
+
+	// 인덱스에 없는 레코드는 레코드에 담긴 오프셋으로 인덱스 항목을 만든다.
+	for ; n < uint64(len(positions)); n++ {
+		off := next
+		if p, err := s.store.Read(positions[n]); err == nil {
+			record := &api.Record{}
+			if proto.Unmarshal(p, record) == nil && record.Offset >= s.baseOffset+uint64(next) {
+				off = uint32(record.Offset - s.baseOffset)
+			}
+		}
+		err = s.index.Write(off, positions[n])
+		if err == io.EOF {
+			// 인덱스에 더 이상 공간이 없다면 나머지 레코드는 버린다.
+			end = positions[n]
+			break
+		}
+		if err != nil {
+			return r, err
+		}
+		r.IndexEntriesAdded++
+		next = off + 1
+	}
+
+	if end < s.store.size {
+		r.StoreBytesTruncated = s.store.size - end
+		if err = s.store.truncate(end); err != nil {
+			return r, err
+		}
+	}
+	s.nextOffset = s.baseOffset + uint64(next)
+
+	// 시간 인덱스에서 남아있지 않은 레코드를 가리키는 항목을 지우고, 가장 큰 타임스탬프를 다시 구한다.
+	if err = s.timeIndex.truncate(next); err != nil {
+		return r, err
+	}
+	s.loadMaxTimestamp()
+	return r, nil
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/tysonmote/gommap"
+)
+
+func TestRecovery(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, log *Log,
+	){
+		"clean shutdown needs no repair":        testRecoveryClean,
+		"unclosed index is trimmed":             testRecoveryUnclosedIndex,
+		"store record without index entry":      testRecoveryMissingIndexEntry,
+		"partial store record is truncated":     testRecoveryPartialRecord,
+		"missing offset file is rebuilt":        testRecoveryMissingIndexFile,
+		"index entry past store end is dropped": testRecoveryDanglingIndexEntry,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "recovery_test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				_, err := log.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+			fn(t, log)
+		})
+	}
+}
+
+// crash 함수는 Close를 호출하지 않고 종료된 상황을 흉내낸다. 버퍼와 메모리 맵의 내용은 파일에 남는다.
+func crash(t *testing.T, log *Log) {
+	t.Helper()
+	for _, s := range log.segments {
+		require.NoError(t, s.store.buf.Flush())
+		require.NoError(t, s.index.mmap.Sync(gommap.MS_SYNC))
+	}
+}
+
+func reopen(t *testing.T, log *Log) *Log {
+	t.Helper()
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	return n
+}
+
+func requireRecords(t *testing.T, log *Log, count uint64) {
+	t.Helper()
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, count-1, off)
+	for i := uint64(0); i < count; i++ {
+		record, err := log.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello world"), record.Value)
+	}
+	off, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, count, off)
+}
+
+func testRecoveryClean(t *testing.T, log *Log) {
+	require.NoError(t, log.Close())
+	n := reopen(t, log)
+	require.False(t, n.Recovery().Repaired())
+	requireRecords(t, n, 3)
+}
+
+func testRecoveryUnclosedIndex(t *testing.T, log *Log) {
+	crash(t, log)
+	n := reopen(t, log)
+	r := n.Recovery()
+	require.True(t, r.Repaired())
+	require.True(t, r.Segments[0].IndexUnclean)
+	require.Equal(t, 0, r.Segments[0].IndexEntriesDropped)
+	requireRecords(t, n, 3)
+}
+
+func testRecoveryMissingIndexEntry(t *testing.T, log *Log) {
+	// store.Append 다음, index.Write 전에 멈춘 상황
+	s := log.activeSegment
+	p := []byte("not indexed")
+	_, _, err := s.store.Append(p)
+	require.NoError(t, err)
+	crash(t, log)
+
+	n := reopen(t, log)
+	r := n.Recovery()
+	require.Equal(t, 1, r.Segments[0].IndexEntriesAdded)
+	off, err := n.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func testRecoveryPartialRecord(t *testing.T, log *Log) {
+	require.NoError(t, log.Close())
+	f, err := os.OpenFile(log.segments[0].store.Name(), os.O_RDWR|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 100, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	n := reopen(t, log)
+	require.Equal(t, uint64(11), n.Recovery().Segments[0].StoreBytesTruncated)
+	requireRecords(t, n, 3)
+}
+
+func testRecoveryMissingIndexFile(t *testing.T, log *Log) {
+	require.NoError(t, log.Close())
+	require.NoError(t, os.Remove(path.Join(log.Dir, "0.offset")))
+
+	n := reopen(t, log)
+	r := n.Recovery()
+	require.True(t, r.Segments[0].IndexRebuilt)
+	require.Equal(t, 3, r.Segments[0].IndexEntriesAdded)
+	requireRecords(t, n, 3)
+}
+
+func testRecoveryDanglingIndexEntry(t *testing.T, log *Log) {
+	// 스토어에는 없는 레코드를 가리키는 인덱스 항목
+	s := log.activeSegment
+	require.NoError(t, s.index.Write(3, s.store.size+100))
+	crash(t, log)
+
+	n := reopen(t, log)
+	require.Equal(t, 1, n.Recovery().Segments[0].IndexEntriesDropped)
+	requireRecords(t, n, 3)
+}
@@ -0,0 +1,194 @@
+package log
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/grpc"
+)
+
+/*
+Replicator는 다른 서버의 로그를 가져와서(pull) 로컬 로그에 추가하는 비동기 복제를 한다.
+서버가 클러스터에 들어오면(Join) 그 서버의 ConsumeStream을 오프셋 0부터 열고, 받은 레코드를 로컬 로그에 추가한다.
+서버가 떠나거나(Leave) Replicator를 닫으면(Close) 복제를 멈춘다. discovery.Handler 인터페이스를 구현한다.
+
+두 서버가 서로를 복제하면 서로 복제한 레코드를 다시 복제하는 루프가 생긴다. 이를 막기 위해 복제한 레코드에는
+원래 레코드를 받은 서버의 이름을 originHeader 헤더로 남기고, 다른 서버에서 복제해 온 레코드(헤더가 있는 레코드)는 복제하지 않는다.
+즉, 각 서버는 피어가 직접 받은 레코드만 가져온다. 따라서 모든 서버가 서로를 피어로 가져야(full mesh) 모든 레코드가 모든 서버에 복제된다.
+*/
+type Replicator struct {
+	DialOptions []grpc.DialOption
+	// LocalServer는 복제한 레코드를 추가할 로컬 로그이다.
+	LocalServer Appender
+	// RetryInterval은 피어와의 연결이 끊겼을 때 다시 연결하기까지 기다리는 시간이다. 0이면 1초이다.
+	RetryInterval time.Duration
+
+	logger *log.Logger
+
+	mu      sync.Mutex
+	servers map[string]chan struct{}
+	closed  bool
+	close   chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Appender는 레코드를 추가할 수 있는 로그이다. Log와 DistributedLog가 구현한다.
+type Appender interface {
+	Append(*api.Record) (uint64, error)
+}
+
+// originHeader는 복제한 레코드를 원래 받은 서버의 이름을 담는 헤더이다.
+const originHeader = "proglog-origin"
+
+// Join 메서드는 name 서버를 복제할 서버 목록에 추가하고, 복제하는 고루틴을 시작한다. 이미 복제하는 서버라면 아무것도 하지 않는다.
+func (r *Replicator) Join(name, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+
+	if r.closed {
+		return nil
+	}
+	if _, ok := r.servers[name]; ok {
+		// 이미 복제하고 있으므로 건너뛴다.
+		return nil
+	}
+	r.servers[name] = make(chan struct{})
+
+	r.wg.Add(1)
+	go r.replicate(name, addr, r.servers[name])
+	return nil
+}
+
+/*
+replicate 메서드는 피어의 ConsumeStream을 열어서 받은 레코드들을 로컬 로그에 추가한다.
+연결이 끊기면 RetryInterval 후에 마지막으로 받은 레코드의 다음 오프셋부터 다시 연다.
+*/
+func (r *Replicator) replicate(name, addr string, leave chan struct{}) {
+	defer r.wg.Done()
+	offset := uint64(0)
+	for {
+		err := r.consume(name, addr, &offset, leave)
+		if err != nil {
+			r.logError(err, "failed to replicate", name, addr)
+		}
+		select {
+		case <-r.close:
+			return
+		case <-leave:
+			return
+		case <-time.After(r.RetryInterval):
+		}
+	}
+}
+
+// consume 메서드는 피어의 ConsumeStream을 offset부터 읽는다. 레코드를 추가할 때마다 offset을 다음 오프셋으로 옮긴다.
+func (r *Replicator) consume(name, addr string, offset *uint64, leave chan struct{}) error {
+	cc, err := grpc.NewClient(addr, r.DialOptions...)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	client := api.NewLogClient(cc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.close:
+		case <-leave:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	// 커밋된 트랜잭션의 레코드만 복제한다. 피어의 트랜잭션은 피어의 로그에서 끝나므로 로컬 로그에는 보통의 레코드로 추가한다.
+	stream, err := client.ConsumeStream(ctx,
+		&api.ConsumeRequest{
+			Offset:         *offset,
+			IsolationLevel: api.IsolationLevel_READ_COMMITTED,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		recv, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				// Leave나 Close로 멈췄다.
+				return nil
+			}
+			return err
+		}
+		record := recv.Record
+		*offset = record.Offset + 1
+		// 피어가 다른 서버에서 복제해 온 레코드는 가져오지 않는다.
+		if _, ok := record.Headers[originHeader]; ok {
+			continue
+		}
+		if record.Headers == nil {
+			record.Headers = map[string][]byte{}
+		}
+		record.Headers[originHeader] = []byte(name)
+		// 프로듀서의 시퀀스는 피어의 로그에서 센 것이므로, 로컬 로그에서 중복 제거 대상이 되지 않게 지운다.
+		record.ProducerId, record.Sequence = 0, 0
+		record.TxnId = 0
+		if _, err = r.LocalServer.Append(record); err != nil {
+			return err
+		}
+	}
+}
+
+// Leave 메서드는 name 서버의 복제를 멈춘다.
+func (r *Replicator) Leave(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+	if _, ok := r.servers[name]; !ok {
+		return nil
+	}
+	close(r.servers[name])
+	delete(r.servers, name)
+	return nil
+}
+
+// init 메서드는 Replicator의 필드들을 지연 초기화한다. 제로 값의 Replicator를 바로 사용할 수 있다.
+func (r *Replicator) init() {
+	if r.logger == nil {
+		r.logger = log.New(os.Stderr, "replicator: ", log.LstdFlags)
+	}
+	if r.servers == nil {
+		r.servers = make(map[string]chan struct{})
+	}
+	if r.close == nil {
+		r.close = make(chan struct{})
+	}
+	if r.RetryInterval == 0 {
+		r.RetryInterval = time.Second
+	}
+}
+
+// Close 메서드는 모든 서버의 복제를 멈추고, 복제하는 고루틴들이 끝날 때까지 기다린다.
+func (r *Replicator) Close() error {
+	r.mu.Lock()
+	r.init()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.close)
+	r.mu.Unlock()
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Replicator) logError(err error, msg, name, addr string) {
+	r.logger.Printf("%s: %v (name=%s, rpc_addr=%s)", msg, err, name, addr)
+}
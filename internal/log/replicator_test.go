@@ -0,0 +1,164 @@
+package log
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/config"
+	"github.com/sodami-hub/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// replicaNode는 Replicator 테스트에서 mTLS gRPC 서버로 로그를 제공하는 노드이다.
+type replicaNode struct {
+	name       string
+	addr       string
+	log        *Log
+	replicator *Replicator
+}
+
+// setupReplica 함수는 addr에 mTLS gRPC 서버를 띄우고, 루트 클라이언트 인증서로 피어에 연결하는 Replicator를 만든다.
+func setupReplica(t *testing.T, name, addr string) *replicaNode {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "replicator-test")
+	require.NoError(t, err)
+	clog, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: ln.Addr().String(),
+		Server:        true,
+	})
+	require.NoError(t, err)
+	shutdown := make(chan struct{})
+	gsrv, err := server.NewGRPCServer(&server.Config{
+		CommitLog:  clog,
+		Authorizer: auth.New(config.ACLModelFile, config.ACLPolicyFile),
+		Shutdown:   shutdown,
+	}, grpc.Creds(credentials.NewTLS(serverTLSConfig)))
+	require.NoError(t, err)
+	go gsrv.Serve(ln)
+
+	peerTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.RootClientCertFile,
+		KeyFile:  config.RootClientKeyFile,
+		CAFile:   config.CAFile,
+		Server:   false,
+	})
+	require.NoError(t, err)
+	r := &Replicator{
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(peerTLSConfig)),
+		},
+		LocalServer:   clog,
+		RetryInterval: 50 * time.Millisecond,
+	}
+
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+		close(shutdown)
+		gsrv.Stop()
+		require.NoError(t, clog.Remove())
+	})
+	return &replicaNode{
+		name:       name,
+		addr:       ln.Addr().String(),
+		log:        clog,
+		replicator: r,
+	}
+}
+
+// values 함수는 로그의 모든 레코드 값을 오프셋 순서대로 리턴한다.
+func values(t *testing.T, l *Log) []string {
+	t.Helper()
+	var got []string
+	it := l.Iterator(0)
+	for it.Next() {
+		got = append(got, string(it.Record().Value))
+	}
+	require.NoError(t, it.Err())
+	return got
+}
+
+func TestReplicator(t *testing.T) {
+	a := setupReplica(t, "a", "127.0.0.1:0")
+	b := setupReplica(t, "b", "127.0.0.1:0")
+
+	_, err := a.log.Append(&api.Record{Value: []byte("a0")})
+	require.NoError(t, err)
+	_, err = a.log.Append(&api.Record{Value: []byte("a1")})
+	require.NoError(t, err)
+	_, err = b.log.Append(&api.Record{Value: []byte("b0")})
+	require.NoError(t, err)
+
+	// 두 노드가 서로를 복제한다. 같은 서버에 다시 Join해도 한 번만 복제한다.
+	require.NoError(t, a.replicator.Join(b.name, b.addr))
+	require.NoError(t, b.replicator.Join(a.name, a.addr))
+	require.NoError(t, b.replicator.Join(a.name, a.addr))
+
+	require.Eventually(t, func() bool {
+		return len(values(t, a.log)) == 3 && len(values(t, b.log)) == 3
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// 복제를 시작한 후에 추가한 레코드도 복제한다.
+	_, err = a.log.Append(&api.Record{Value: []byte("a2")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(values(t, b.log)) == 4
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// 서로 복제한 레코드를 다시 복제하지 않는다.
+	time.Sleep(200 * time.Millisecond)
+	require.ElementsMatch(t, []string{"a0", "a1", "b0", "a2"}, values(t, a.log))
+	require.ElementsMatch(t, []string{"a0", "a1", "b0", "a2"}, values(t, b.log))
+
+	// 복제한 레코드에는 원래 레코드를 받은 서버의 이름이 남는다.
+	record, err := b.log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, "b0", string(record.Value))
+	require.Nil(t, record.Headers[originHeader])
+	record, err = b.log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), record.Headers[originHeader])
+
+	// 피어가 떠나면 더 이상 복제하지 않는다.
+	require.NoError(t, b.replicator.Leave(a.name))
+	time.Sleep(100 * time.Millisecond)
+	_, err = a.log.Append(&api.Record{Value: []byte("a3")})
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	require.Len(t, values(t, b.log), 4)
+}
+
+// 피어가 아직 떠있지 않더라도 다시 연결해서 복제한다.
+func TestReplicatorRetry(t *testing.T) {
+	a := setupReplica(t, "a", "127.0.0.1:0")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	require.NoError(t, a.replicator.Join("b", addr))
+
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, values(t, a.log))
+
+	b := setupReplica(t, "b", addr)
+	_, err = b.log.Append(&api.Record{Value: []byte("b0")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(values(t, a.log)) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+}
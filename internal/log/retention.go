@@ -0,0 +1,84 @@
+package log
+
+import (
+	"time"
+)
+
+/*
+보존 정책(Config.Retention)을 적용하는 부분이다. 백그라운드 고루틴(janitor)이 Retention.CheckInterval 마다
+EnforceRetention을 호출해서, 정책을 넘어선 오래된 세그먼트를 가장 오래된 것부터 통째로 지운다.
+
+세그먼트 목록은 l.mu를 잡은 상태에서 바꾸기 때문에 LowestOffset이 한 번에 바뀌고,
+동시에 Read를 호출한 쪽은 지워진 파일을 읽는 에러 대신 api.ErrOffsetOutOfRange를 받는다.
+파일은 목록에서 빠진 후에 지우므로 파일을 지우는 동안 Append와 Read를 막지 않는다.
+*/
+
+// EnforceRetention 메서드는 보존 정책을 넘어선 세그먼트를 지운다. 활성 세그먼트는 지우지 않는다.
+func (l *Log) EnforceRetention() error {
+	return l.enforceRetention(time.Now())
+}
+
+func (l *Log) enforceRetention(now time.Time) error {
+	l.cleanMu.Lock()
+	defer l.cleanMu.Unlock()
+	l.mu.Lock()
+	r := l.Config.Retention
+	var total uint64
+	for _, s := range l.segments {
+		total += s.size()
+	}
+	var removed []*segment
+	i := 0
+	// 마지막 세그먼트는 활성 세그먼트이므로 제외한다.
+	for ; i < len(l.segments)-1; i++ {
+		s := l.segments[i]
+		expired := (r.MaxBytes > 0 && total > r.MaxBytes) ||
+			(r.MaxSegmentAge > 0 && now.Sub(s.created) > r.MaxSegmentAge) ||
+			(r.MaxRecordAge > 0 && now.Sub(s.modified) > r.MaxRecordAge)
+		if !expired {
+			break
+		}
+		total -= s.size()
+		removed = append(removed, s)
+	}
+	l.segments = l.segments[i:]
+	// 지운 세그먼트에 ABORT 마커가 있던 트랜잭션은 레코드도 모두 지워졌으므로 잊는다.
+	l.txns.forget(l.segments[0].baseOffset)
+	l.mu.Unlock()
+
+	var err error
+	for _, s := range removed {
+		if rerr := s.Remove(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// hasRetention 메서드는 보존 정책이 하나라도 설정되었는지를 리턴한다.
+func (l *Log) hasRetention() bool {
+	r := l.Config.Retention
+	return r.MaxBytes > 0 || r.MaxSegmentAge > 0 || r.MaxRecordAge > 0
+}
+
+// startJanitor 메서드는 보존 정책을 주기적으로 적용하는 고루틴을 시작한다.
+func (l *Log) startJanitor() {
+	if !l.hasRetention() {
+		return
+	}
+	l.wg.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.Config.Retention.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 지우지 못한 세그먼트는 목록에서 빠졌으므로 다시 시도하지 않는다. 파일은 다음에 시작할 때 다시 열린다.
+				_ = l.EnforceRetention()
+			}
+		}
+	}(l.done)
+}
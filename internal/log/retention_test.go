@@ -0,0 +1,125 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T, c Config, dir string,
+	){
+		"max bytes removes oldest segments":       testRetentionMaxBytes,
+		"max segment age removes old segments":    testRetentionSegmentAge,
+		"max record age removes stale segments":   testRetentionRecordAge,
+		"active segment is never removed":         testRetentionActiveSegment,
+		"janitor enforces retention periodically": testRetentionJanitor,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "retention_test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			// 세그먼트마다 레코드가 하나씩 들어간다.
+			c.Segment.MaxStoreBytes = 32
+			fn(t, c, dir)
+		})
+	}
+}
+
+func appendRecords(t *testing.T, log *Log, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+}
+
+func requireLowest(t *testing.T, log *Log, want uint64) {
+	t.Helper()
+	off, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, want, off)
+	if want > 0 {
+		_, err = log.Read(want - 1)
+		require.Equal(t, api.ErrOffsetOutOfRange{Offset: want - 1}, err)
+	}
+	_, err = log.Read(want)
+	require.NoError(t, err)
+}
+
+func testRetentionMaxBytes(t *testing.T, c Config, dir string) {
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 5)
+
+	log.Config.Retention.MaxBytes = log.activeSegment.size() * 2
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 2, len(log.segments))
+	requireLowest(t, log, 3)
+}
+
+func testRetentionSegmentAge(t *testing.T, c Config, dir string) {
+	c.Retention.MaxSegmentAge = time.Hour
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+
+	log.segments[0].created = time.Now().Add(-2 * time.Hour)
+	log.segments[1].created = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, log.EnforceRetention())
+	requireLowest(t, log, 2)
+
+	// 지운 세그먼트의 파일도 없어야 한다.
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(files))
+}
+
+func testRetentionRecordAge(t *testing.T, c Config, dir string) {
+	c.Retention.MaxRecordAge = time.Hour
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+
+	require.NoError(t, log.enforceRetention(time.Now().Add(30*time.Minute)))
+	requireLowest(t, log, 0)
+	require.NoError(t, log.enforceRetention(time.Now().Add(2*time.Hour)))
+	requireLowest(t, log, 2)
+}
+
+func testRetentionActiveSegment(t *testing.T, c Config, dir string) {
+	c.Retention.MaxBytes = 1
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 1, len(log.segments))
+	require.Equal(t, log.activeSegment, log.segments[0])
+	requireLowest(t, log, 2)
+	appendRecords(t, log, 1)
+}
+
+func testRetentionJanitor(t *testing.T, c Config, dir string) {
+	c.Retention.MaxBytes = 1
+	c.Retention.CheckInterval = 10 * time.Millisecond
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+
+	require.Eventually(t, func() bool {
+		off, err := log.LowestOffset()
+		return err == nil && off == 2
+	}, time.Second, 10*time.Millisecond)
+}
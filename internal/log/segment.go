@@ -2,19 +2,31 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"time"
 
 	api "github.com/sodami-hub/proglog/api/v1"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	// _ "google.golang.org/protobuf/proto"
 )
 
 type segment struct {
 	store                  *store
 	index                  *index
+	timeIndex              *timeIndex
 	baseOffset, nextOffset uint64
 	config                 Config
+
+	// 시간 인덱스(timeindex.go)에서 사용하는 값
+	maxTimestamp   int64  // 세그먼트에서 가장 큰 레코드의 타임스탬프(유닉스 나노초)
+	timeIndexBytes uint64 // 마지막 시간 인덱스 항목 이후에 스토어에 쓴 바이트 수
+
+	// 보존 정책(retention.go)에서 사용하는 시각
+	created  time.Time // 세그먼트를 만든 시각
+	modified time.Time // 마지막 레코드를 추가한 시각
 }
 
 func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
@@ -31,6 +43,16 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	if err != nil {
 		return nil, err
 	}
+	fi, err := storeFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// 이미 있던 세그먼트는 만든 시각을 알 수 없기 때문에 스토어 파일을 마지막으로 수정한 시각을 사용한다.
+	// 실제로 만든 시각보다 늦으므로 보존 기간보다 일찍 지워지는 일은 없다.
+	s.created, s.modified = fi.ModTime(), fi.ModTime()
+	if fi.Size() == 0 {
+		s.created = time.Now()
+	}
 	if s.store, err = newStore(storeFile); err != nil {
 		return nil, err
 	}
@@ -50,45 +72,238 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	} else {
 		s.nextOffset = baseOffset + uint64(off) + 1 // index의 마지막 위치가 off로 넘어옴 다음 오프셋을 구함.
 	}
+	timeIndexFile, err := os.OpenFile(
+		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".timeindex")),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if s.timeIndex, err = newTimeIndex(timeIndexFile); err != nil {
+		return nil, err
+	}
+	s.loadMaxTimestamp()
 	return s, nil
 }
 
+/*
+loadMaxTimestamp 메서드는 세그먼트에서 가장 큰 타임스탬프를 구한다. 시간 인덱스의 마지막 항목에서 시작해서
+그 이후의 레코드들을 읽어서 확인한다. 정상적으로 닫힌 세그먼트는 마지막 항목에 가장 큰 타임스탬프가 있기 때문에 읽을 레코드가 없다.
+읽다가 에러가 나면(복구가 필요한 세그먼트) 거기서 멈춘다. 복구한 후에 다시 호출한다.
+*/
+func (s *segment) loadMaxTimestamp() {
+	s.maxTimestamp = 0
+	from := s.baseOffset
+	if last, ok := s.timeIndex.Last(); ok {
+		s.maxTimestamp = last.timestamp
+		from = s.baseOffset + uint64(last.off) + 1
+	}
+	_ = s.scan(from, func(record *api.Record) (bool, error) {
+		if ts := timestampOf(record); ts > s.maxTimestamp {
+			s.maxTimestamp = ts
+		}
+		return true, nil
+	})
+}
+
+// timestampOf 함수는 레코드의 타임스탬프를 유닉스 나노초로 리턴한다. 타임스탬프가 없는 기존 레코드는 0이다.
+func timestampOf(record *api.Record) int64 {
+	if record.Timestamp == nil {
+		return 0
+	}
+	return record.Timestamp.AsTime().UnixNano()
+}
+
 func (s *segment) Append(record *api.Record) (offset uint64, err error) {
-	cur := s.nextOffset
-	record.Offset = cur
+	record.Offset = s.nextOffset
+	// 타임스탬프는 서버가 추가한 시각으로 정한다. 설정에 따라 생산자가 정한 값이 있다면 그대로 쓴다.
+	if record.Timestamp == nil || !s.config.Timestamp.ProducerSupplied {
+		record.Timestamp = timestamppb.Now()
+	}
+	if err = s.write(record); err != nil {
+		return 0, err
+	}
+	return record.Offset, nil
+}
+
+// write 메서드는 레코드를 레코드의 오프셋 그대로 쓴다. 압축한 세그먼트를 만들 때는 오프셋 사이에 빈 곳이 생길 수 있다.
+func (s *segment) write(record *api.Record) error {
 	p, err := proto.Marshal(record)
 	if err != nil {
-		return 0, err
+		return err
 	}
+	return s.writeBatch([]*api.Record{record}, [][]byte{p})
+}
 
-	_, pos, err := s.store.Append(p)
+/*
+writeBatch 메서드는 직렬화한 레코드들을 스토어에 한 번에 쓰고 인덱스와 시간 인덱스에 항목을 쓴다.
+payloads[i]는 records[i]를 직렬화한 것이다. 에러가 나면 일부만 쓰였을 수 있으므로 호출한 쪽에서 rollback으로 되돌린다.
+*/
+func (s *segment) writeBatch(records []*api.Record, payloads [][]byte) error {
+	widths, positions, err := s.store.AppendBatch(payloads)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if err = s.index.Write(
-		// 인덱스의 오프셋은 베이스 오프셋에서의 상댓값이다.
-		uint32(s.nextOffset-uint64(s.baseOffset)),
-		pos,
-	); err != nil {
-		return 0, err
+	for i, record := range records {
+		cur := record.Offset
+		if err = s.index.Write(
+			// 인덱스의 오프셋은 베이스 오프셋에서의 상댓값이다.
+			uint32(cur-uint64(s.baseOffset)),
+			positions[i],
+		); err != nil {
+			return err
+		}
+		s.nextOffset = cur + 1
+
+		// 세그먼트의 첫 레코드이거나 마지막 항목 이후로 TimeIndexIntervalBytes 이상 썼다면 시간 인덱스에 항목을 쓴다.
+		if ts := timestampOf(record); ts > s.maxTimestamp {
+			s.maxTimestamp = ts
+		}
+		s.timeIndexBytes += widths[i]
+		if len(s.timeIndex.entries) == 0 || s.timeIndexBytes >= s.config.Segment.TimeIndexIntervalBytes {
+			if err = s.timeIndex.Write(s.maxTimestamp, uint32(cur-s.baseOffset)); err != nil {
+				return err
+			}
+			s.timeIndexBytes = 0
+		}
 	}
-	s.nextOffset++
-	return cur, nil
+	s.modified = time.Now()
+	return nil
+}
+
+/*
+fit 메서드는 payloads 중에서 앞에서부터 몇 개의 레코드를 이 세그먼트에 쓸 수 있는지 리턴한다.
+레코드를 하나씩 Append할 때와 같은 기준(IsMaxed)으로, 레코드를 쓰기 전에 세그먼트가 가득 찼는지 확인한다.
+*/
+func (s *segment) fit(payloads [][]byte) int {
+	storeSize, indexSize := s.store.size, s.index.size
+	for i, p := range payloads {
+		if storeSize >= s.config.Segment.MaxStoreBytes || indexSize+entWidth >= s.config.Segment.MaxIndexBytes {
+			return i
+		}
+		storeSize += s.store.frameWidth() + uint64(len(p))
+		indexSize += entWidth
+	}
+	return len(payloads)
+}
+
+// savepoint는 배치를 쓰기 전의 세그먼트 상태이다. 배치를 쓰다가 실패하면 이 상태로 되돌린다.
+type savepoint struct {
+	storeSize, indexSize uint64
+	nextOffset           uint64
+	maxTimestamp         int64
+	timeIndexBytes       uint64
 }
 
-// 매개변수 off는 절대값으로 넘어옴 0~ .... // 반면에 각 인덱스 파일의 순서는 0부터 시작됨.
+func (s *segment) savepoint() savepoint {
+	return savepoint{
+		storeSize:      s.store.size,
+		indexSize:      s.index.size,
+		nextOffset:     s.nextOffset,
+		maxTimestamp:   s.maxTimestamp,
+		timeIndexBytes: s.timeIndexBytes,
+	}
+}
+
+// rollback 메서드는 세그먼트를 savepoint의 상태로 되돌린다. 그 뒤에 쓴 레코드와 인덱스 항목을 잘라낸다.
+func (s *segment) rollback(sp savepoint) error {
+	if err := s.store.truncate(sp.storeSize); err != nil {
+		return err
+	}
+	s.index.truncate(sp.indexSize / entWidth)
+	if err := s.timeIndex.truncate(uint32(sp.nextOffset - s.baseOffset)); err != nil {
+		return err
+	}
+	s.nextOffset = sp.nextOffset
+	s.maxTimestamp = sp.maxTimestamp
+	s.timeIndexBytes = sp.timeIndexBytes
+	return nil
+}
+
+/*
+offsetForTime 메서드는 타임스탬프가 ts 이상인 첫 번째 레코드의 오프셋을 찾는다. 시간 인덱스로 읽기 시작할 위치를 찾고,
+거기서부터 레코드를 차례로 읽는다. 그런 레코드가 없다면 ok는 false이다.
+*/
+func (s *segment) offsetForTime(ts int64) (off uint64, ok bool, err error) {
+	if s.maxTimestamp < ts {
+		return 0, false, nil
+	}
+	err = s.scan(s.baseOffset+uint64(s.timeIndex.Lookup(ts)), func(record *api.Record) (bool, error) {
+		if timestampOf(record) >= ts {
+			off, ok = record.Offset, true
+			return false, nil
+		}
+		return true, nil
+	})
+	return off, ok, err
+}
+
+/*
+매개변수 off는 절대값으로 넘어옴 0~ .... // 반면에 각 인덱스 파일의 순서는 0부터 시작됨.
+압축한 세그먼트에서 off 레코드가 지워졌다면 off 다음의 첫 번째 레코드를 리턴한다. 레코드의 Offset으로 실제 오프셋을 알 수 있다.
+세그먼트에 off 이상의 레코드가 없다면 io.EOF를 리턴한다.
+*/
 func (s *segment) Read(off uint64) (*api.Record, error) {
-	_, pos, err := s.index.Read(int64(off - s.baseOffset)) // 인덱스의 오프셋은 베이스오프셋에서의 상댓값이기 때문에...
+	var rel uint32
+	if off > s.baseOffset {
+		rel = uint32(off - s.baseOffset) // 인덱스의 오프셋은 베이스오프셋에서의 상댓값이기 때문에...
+	}
+	n, err := s.index.find(rel)
 	if err != nil {
 		return nil, err
 	}
+	return s.readEntry(n)
+}
+
+// readEntry 메서드는 인덱스의 n번째 항목이 가리키는 레코드를 읽는다.
+func (s *segment) readEntry(n uint64) (*api.Record, error) {
+	rel, pos, err := s.index.Read(int64(n))
+	if err != nil {
+		return nil, err
+	}
+	off := s.baseOffset + uint64(rel)
 	p, err := s.store.Read(pos)
+	if err == errCorruptRecord {
+		return nil, api.ErrCorruptRecord{Offset: off}
+	}
 	if err != nil {
 		return nil, err
 	}
 	record := &api.Record{}
-	err = proto.Unmarshal(p, record)
-	return record, err
+	// 체크섬이 없는 기존 포맷의 레코드는 역직렬화에 실패하는 것으로 손상을 알 수 있다.
+	if err = proto.Unmarshal(p, record); err != nil {
+		return nil, api.ErrCorruptRecord{Offset: off}
+	}
+	return record, nil
+}
+
+/*
+scan 메서드는 오프셋이 from 이상인 레코드를 차례로 fn에 넘긴다. fn이 false를 리턴하면 멈춘다.
+손상된 레코드를 만나면 에러를 리턴한다.
+*/
+func (s *segment) scan(from uint64, fn func(*api.Record) (bool, error)) error {
+	var rel uint32
+	if from > s.baseOffset {
+		rel = uint32(from - s.baseOffset)
+	}
+	n, err := s.index.find(rel)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for ; n < s.index.size/entWidth; n++ {
+		record, err := s.readEntry(n)
+		if err != nil {
+			return err
+		}
+		if ok, err := fn(record); err != nil || !ok {
+			return err
+		}
+	}
+	return nil
 }
 
 /*
@@ -100,6 +315,11 @@ func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes || s.index.size+entWidth >= s.config.Segment.MaxIndexBytes
 }
 
+// size 메서드는 세그먼트가 디스크에서 차지하는 크기(스토어+인덱스+시간 인덱스)를 리턴한다.
+func (s *segment) size() uint64 {
+	return s.store.size + s.index.size + uint64(len(s.timeIndex.entries))*tsEntWidth
+}
+
 func (s *segment) Remove() error {
 	if err := s.Close(); err != nil {
 		return err
@@ -110,10 +330,22 @@ func (s *segment) Remove() error {
 	if err := os.Remove(s.store.Name()); err != nil {
 		return err
 	}
+	if err := os.Remove(s.timeIndex.Name()); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (s *segment) Close() error {
+	// 가장 큰 타임스탬프가 시간 인덱스에 없다면 마지막 항목으로 쓴다. 다시 열 때 레코드를 읽지 않아도 된다.
+	if last, ok := s.timeIndex.Last(); s.nextOffset > s.baseOffset && (!ok || last.timestamp < s.maxTimestamp) {
+		if err := s.timeIndex.Write(s.maxTimestamp, uint32(s.nextOffset-1-s.baseOffset)); err != nil {
+			return err
+		}
+	}
+	if err := s.timeIndex.Close(); err != nil {
+		return err
+	}
 	if err := s.index.Close(); err != nil {
 		return err
 	}
@@ -56,3 +56,29 @@ func TestSegment(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, s.IsMaxed())
 }
+
+// 스토어의 레코드가 손상되었다면 세그먼트는 오프셋을 담은 api.ErrCorruptRecord를 리턴한다.
+func TestSegmentCorruptRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "segment-corrupt-test")
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = 1024
+	c.Segment.MaxStoreBytes = 1024
+
+	s, err := newSegment(dir, 16, c)
+	require.NoError(t, err)
+	off, err := s.Append(&api.Record{Value: []byte("Hello World!")})
+	require.NoError(t, err)
+	require.NoError(t, s.store.buf.Flush())
+
+	f, err := os.OpenFile(s.store.Name(), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0}, int64(s.store.size-1))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = s.Read(off)
+	require.Equal(t, api.ErrCorruptRecord{Offset: off}, err)
+	require.NoError(t, s.Close())
+}
@@ -2,7 +2,12 @@ package log
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"sync"
 )
@@ -13,11 +18,39 @@ var enc = binary.BigEndian
 // 레코드 길이를 저장하는 바이트 개수를 정의한 것 - uint64 -> 8byte
 const lenWidth = 8
 
+// 레코드 체크섬(CRC32C)을 저장하는 바이트 개수 - uint32 -> 4byte
+const crcWidth = 4
+
+/*
+스토어 파일의 포맷 버전. 버전 1부터는 파일의 맨 앞에 헤더(매직 4바이트 + 버전 2바이트 + 예약 2바이트)가 있고,
+각 레코드는 [길이 8바이트][CRC32C 4바이트][레코드] 형식으로 저장된다.
+헤더가 없는 기존 파일(storeVersionLegacy)은 [길이 8바이트][레코드] 형식 그대로 읽고 쓴다.
+
+매직의 첫 바이트가 0xff 이기 때문에 기존 파일의 첫 8바이트(레코드 길이)와 헷갈릴 일이 없다.
+*/
+const (
+	storeVersionLegacy uint16 = 0
+	storeVersion1      uint16 = 1
+	storeVersion              = storeVersion1
+)
+
+const headerWidth = 8
+
+var storeMagic = []byte{0xff, 'P', 'L', 'G'}
+
+// CRC32C(Castagnoli) 테이블. 하드웨어 가속을 받을 수 있다.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorruptRecord는 체크섬이 맞지 않거나 레코드가 잘려있을 때 스토어가 리턴한다.
+// 스토어는 오프셋을 모르기 때문에 세그먼트에서 api.ErrCorruptRecord로 바꿔서 리턴한다.
+var errCorruptRecord = errors.New("corrupt record")
+
 type store struct {
 	*os.File // *os.File 을 임베딩했다. os.File의 모든 메서드와 필드를 사용할 수 있다.
 	mu       sync.Mutex
 	buf      *bufio.Writer
 	size     uint64
+	version  uint16
 }
 
 func newStore(f *os.File) (*store, error) {
@@ -25,58 +58,157 @@ func newStore(f *os.File) (*store, error) {
 	if err != nil {
 		return nil, err
 	}
-	size := uint64(fi.Size())
-	return &store{
+	s := &store{
 		File: f, // 그런데 이 File 이라는 필드명은 어디서 온건지...
-		size: size,
+		size: uint64(fi.Size()),
 		buf:  bufio.NewWriter(f),
-	}, nil
+	}
+	if s.size == 0 {
+		// 새 파일에는 헤더를 먼저 쓴다.
+		if err = s.writeHeader(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if s.version, err = readStoreVersion(f, s.size); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *store) writeHeader() error {
+	header := make([]byte, headerWidth)
+	copy(header, storeMagic)
+	enc.PutUint16(header[len(storeMagic):], storeVersion)
+	if _, err := s.File.Write(header); err != nil {
+		return err
+	}
+	s.size = headerWidth
+	s.version = storeVersion
+	return nil
+}
+
+// readStoreVersion 함수는 파일의 헤더를 읽어서 포맷 버전을 리턴한다. 헤더가 없다면 기존 포맷이다.
+func readStoreVersion(f *os.File, size uint64) (uint16, error) {
+	if size < headerWidth {
+		return storeVersionLegacy, nil
+	}
+	header := make([]byte, headerWidth)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(header[:len(storeMagic)], storeMagic) {
+		return storeVersionLegacy, nil
+	}
+	version := enc.Uint16(header[len(storeMagic):])
+	if version != storeVersion1 {
+		return 0, fmt.Errorf("unsupported store version %d: %s", version, f.Name())
+	}
+	return version, nil
+}
+
+// dataStart 메서드는 첫 번째 레코드가 시작하는 위치를 리턴한다.
+func (s *store) dataStart() uint64 {
+	if s.version == storeVersionLegacy {
+		return 0
+	}
+	return headerWidth
+}
+
+// frameWidth 메서드는 레코드 앞에 붙는 길이(와 체크섬)의 크기를 리턴한다.
+func (s *store) frameWidth() uint64 {
+	if s.version == storeVersionLegacy {
+		return lenWidth
+	}
+	return lenWidth + crcWidth
 }
 
 /*
-Append 메서는 저장할 레코드를 받아서 store 구조체에 저장(레코드 크기+레코드)하고,
+Append 메서는 저장할 레코드를 받아서 store 구조체에 저장(레코드 크기+체크섬+레코드)하고,
 실제 저장한 데이터 크기(n byte), 저장하기전 store의 크기(pos byte)를 반환한다.
 */
 func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
+	widths, positions, err := s.AppendBatch([][]byte{p})
+	if err != nil {
+		return 0, 0, err
+	}
+	return widths[0], positions[0], nil
+}
+
+/*
+AppendBatch 메서드는 여러 레코드의 프레임(길이+체크섬+레코드)을 하나의 버퍼에 모아서 한 번에 쓴다.
+레코드의 길이를 저장 uint64 타입이므로 8바이트를 차지한다.(lenWidth)
+버전 1에서는 길이와 레코드로 계산한 체크섬 4바이트(crcWidth)를 이어서 저장한다.
+레코드마다 실제 저장한 데이터 크기와 저장한 위치를 리턴한다.
+*/
+func (s *store) AppendBatch(ps [][]byte) (widths []uint64, positions []uint64, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	pos = s.size
-	// 레코드의 길이를 저장 uint64 타입이므로 8바이트를 차지한다.(lenWidth)
-	if err := binary.Write(s.buf, enc, uint64(len(p))); err != nil {
-		return 0, 0, err
+	fw := s.frameWidth()
+	total := uint64(0)
+	for _, p := range ps {
+		total += fw + uint64(len(p))
 	}
-	w, err := s.buf.Write(p)
-	if err != nil {
-		return 0, 0, err
+	b := make([]byte, 0, total)
+	widths = make([]uint64, len(ps))
+	positions = make([]uint64, len(ps))
+	pos := s.size
+	for i, p := range ps {
+		frame := make([]byte, fw)
+		enc.PutUint64(frame, uint64(len(p)))
+		if s.version != storeVersionLegacy {
+			enc.PutUint32(frame[lenWidth:], checksum(frame[:lenWidth], p))
+		}
+		b = append(b, frame...)
+		b = append(b, p...)
+		widths[i] = fw + uint64(len(p))
+		positions[i] = pos
+		pos += widths[i]
 	}
-	w += lenWidth       // 실제 저장한 데이터의 크기(w byte)에 p의 길이를 저장한 uint64타입의 크기인 8을 더한다.
-	s.size += uint64(w) // 실제로 레코드를 저장하기 위해서 사용한 크기(w)를 현재 사이즈에 더해서 크기를 갱신한다.
-	return uint64(w), pos, nil
+	if _, err := s.buf.Write(b); err != nil {
+		return nil, nil, err
+	}
+	s.size = pos
+	return widths, positions, nil
 }
 
 /*
 Read 메서드는 pos를 받아서 레코드의 크기를 읽어내고
-그 크기만큼 실제 레코드를 반환한다.
+그 크기만큼 실제 레코드를 반환한다. 버전 1의 파일이라면 체크섬을 확인하고
+맞지 않거나 레코드가 중간에 잘려 있다면 errCorruptRecord를 리턴한다.
 */
 func (s *store) Read(pos uint64) ([]byte, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if err := s.buf.Flush(); err != nil {
-		return nil, err
+	// 버퍼에 남은 데이터가 있을 때만 비운다. 이미 파일에 쓴 레코드를 이어서 읽을 때는 쓰기가 일어나지 않는다.
+	if s.buf.Buffered() > 0 {
+		if err := s.buf.Flush(); err != nil {
+			return nil, err
+		}
 	}
 
-	// 레코드의 크기를 읽기위한 부분
-	size := make([]byte, lenWidth)
-	// pos 에서부터 size크기만큼 읽는다.
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
-		return nil, err
+	// 레코드의 크기(와 체크섬)를 읽기위한 부분
+	frame := make([]byte, s.frameWidth())
+	// pos 에서부터 frame 크기만큼 읽는다.
+	if _, err := s.File.ReadAt(frame, int64(pos)); err != nil {
+		return nil, corruptIfEOF(err)
+	}
+
+	// 길이가 파일의 남은 크기보다 크다면 길이 자체가 깨진 것이다.
+	size := enc.Uint64(frame)
+	if size > s.size-pos-uint64(len(frame)) {
+		return nil, errCorruptRecord
 	}
 
 	// 앞에서 가져온 레코드의 크기를 통해서 파일에서 실제 레코드만 읽어낸다.
-	b := make([]byte, enc.Uint64(size))
-	if _, err := s.File.ReadAt(b, int64(pos+lenWidth)); err != nil {
-		return nil, err
+	b := make([]byte, size)
+	if _, err := s.File.ReadAt(b, int64(pos)+int64(len(frame))); err != nil {
+		return nil, corruptIfEOF(err)
+	}
+	if s.version != storeVersionLegacy &&
+		enc.Uint32(frame[lenWidth:]) != checksum(frame[:lenWidth], b) {
+		return nil, errCorruptRecord
 	}
 	return b, nil
 }
@@ -90,6 +222,85 @@ func (s *store) ReadAt(p []byte, off int64) (int, error) {
 	return s.File.ReadAt(p, off)
 }
 
+/*
+scan 메서드는 스토어를 처음부터 끝까지 읽으면서 온전한 레코드들의 위치와 마지막 온전한 레코드의 끝 위치(end)를 리턴한다.
+쓰다가 멈춘 레코드(파일 끝에서 잘린 레코드, 체크섬이 맞지 않는 마지막 레코드들)는 포함하지 않는다.
+중간의 레코드가 손상되었더라도 뒤에 온전한 레코드가 있다면 위치에 포함하고 corrupt로 개수를 알려준다.
+손상된 레코드는 읽을 때 errCorruptRecord로 드러난다.
+*/
+func (s *store) scan() (positions []uint64, end uint64, corrupt int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.buf.Flush(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	fw := s.frameWidth()
+	frame := make([]byte, fw)
+	pos := s.dataStart()
+	end = pos
+	valid := 0      // 마지막 온전한 레코드까지의 개수
+	pendingBad := 0 // 마지막 온전한 레코드 뒤에 나온 손상된 레코드의 개수
+	for s.size >= pos+fw {
+		if _, err := s.File.ReadAt(frame, int64(pos)); err != nil {
+			return nil, 0, 0, err
+		}
+		size := enc.Uint64(frame)
+		if size > s.size-pos-fw {
+			break
+		}
+		ok := true
+		if s.version != storeVersionLegacy {
+			b := make([]byte, size)
+			if _, err := s.File.ReadAt(b, int64(pos+fw)); err != nil {
+				return nil, 0, 0, err
+			}
+			ok = enc.Uint32(frame[lenWidth:]) == checksum(frame[:lenWidth], b)
+		}
+		positions = append(positions, pos)
+		pos += fw + size
+		if ok {
+			corrupt += pendingBad
+			pendingBad = 0
+			valid = len(positions)
+			end = pos
+		} else {
+			pendingBad++
+		}
+	}
+	return positions[:valid], end, corrupt, nil
+}
+
+// truncate 메서드는 스토어를 size 크기로 잘라낸다. 헤더까지 잘렸다면 헤더를 다시 쓴다.
+func (s *store) truncate(size uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.version == storeVersionLegacy && size == 0 {
+		if err := s.File.Truncate(0); err != nil {
+			return err
+		}
+		return s.writeHeader()
+	}
+	if err := s.File.Truncate(int64(size)); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+// Sync 메서드는 버퍼를 비우고 파일을 fsync해서 레코드가 디스크에 기록되도록 한다.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.File.Sync()
+}
+
 func (s *store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -98,3 +309,17 @@ func (s *store) Close() error {
 	}
 	return s.File.Close()
 }
+
+// checksum 함수는 레코드의 길이와 레코드를 합쳐서 CRC32C를 계산한다. 길이가 깨진 경우도 잡아낼 수 있다.
+func checksum(length, p []byte) uint32 {
+	crc := crc32.Update(0, crcTable, length)
+	return crc32.Update(crc, crcTable, p)
+}
+
+// 파일 끝에서 레코드가 잘렸다면(쓰다가 멈춘 경우) 손상된 레코드로 본다.
+func corruptIfEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errCorruptRecord
+	}
+	return err
+}
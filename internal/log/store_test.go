@@ -9,7 +9,7 @@ import (
 
 var (
 	write = []byte("hello world")
-	width = uint64(len(write)) + lenWidth
+	width = uint64(len(write)) + lenWidth + crcWidth
 )
 
 func TestStoreAppendRead(t *testing.T) {
@@ -34,13 +34,13 @@ func testAppend(t *testing.T, s *store) {
 	for i := uint64(1); i < 4; i++ {
 		n, pos, err := s.Append(write)
 		require.NoError(t, err)
-		require.Equal(t, pos+n, width*i) // n(실제로 쓴 바이트 크기) + pos(쓰기전 파일의 크기) 와 width*i(실제로 테스트에서 파일에 쓰는 크기)
+		require.Equal(t, pos+n, headerWidth+width*i) // n(실제로 쓴 바이트 크기) + pos(쓰기전 파일의 크기) 와 헤더+width*i(실제로 테스트에서 파일에 쓰는 크기)
 	}
 }
 
 func testRead(t *testing.T, s *store) {
 	t.Helper()
-	var pos uint64
+	pos := uint64(headerWidth)
 	for i := uint64(1); i < 4; i++ {
 		read, err := s.Read(pos)
 		require.NoError(t, err)
@@ -49,6 +49,61 @@ func testRead(t *testing.T, s *store) {
 	}
 }
 
+// 헤더가 없는 기존 포맷의 파일도 읽을 수 있어야 하고, 이어서 쓰는 레코드도 기존 포맷을 따라야 한다.
+func TestStoreLegacyFormat(t *testing.T) {
+	f, err := os.CreateTemp("", "store_legacy_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	legacy := make([]byte, lenWidth)
+	enc.PutUint64(legacy, uint64(len(write)))
+	_, err = f.Write(append(legacy, write...))
+	require.NoError(t, err)
+
+	s, err := newStore(f)
+	require.NoError(t, err)
+	require.Equal(t, storeVersionLegacy, s.version)
+
+	read, err := s.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, write, read)
+
+	n, pos, err := s.Append(write)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(write))+lenWidth, n)
+	read, err = s.Read(pos)
+	require.NoError(t, err)
+	require.Equal(t, write, read)
+}
+
+func TestStoreCorruptRecord(t *testing.T) {
+	f, err := os.CreateTemp("", "store_corrupt_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	s, err := newStore(f)
+	require.NoError(t, err)
+	_, pos, err := s.Append(write)
+	require.NoError(t, err)
+	_, torn, err := s.Append(write)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// 첫 번째 레코드의 한 바이트를 바꾸고, 두 번째 레코드는 중간에서 잘라낸다.
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{'H'}, int64(pos+lenWidth+crcWidth))
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(int64(torn+lenWidth+crcWidth+2)))
+
+	s, err = newStore(f)
+	require.NoError(t, err)
+	_, err = s.Read(pos)
+	require.Equal(t, errCorruptRecord, err)
+	_, err = s.Read(torn)
+	require.Equal(t, errCorruptRecord, err)
+}
+
 func TestStoreClose(t *testing.T) {
 	f, err := os.CreateTemp("", "store_close_test")
 	require.NoError(t, err)
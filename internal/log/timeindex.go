@@ -0,0 +1,113 @@
+package log
+
+import (
+	"os"
+	"sort"
+)
+
+// 시간 인덱스 항목의 바이트 수를 정의
+var (
+	tsWidth    uint64 = 8                  // 타임스탬프(유닉스 나노초)
+	tsEntWidth        = tsWidth + offWidth // 시간 인덱스 한 항목의 크기
+)
+
+/*
+timeIndex는 세그먼트마다 하나씩 있는 .timeindex 파일이다. 레코드마다 항목을 쓰는 offset 인덱스와 달리,
+스토어에 Config.Segment.TimeIndexIntervalBytes 이상 쓸 때마다 한 번씩 항목을 쓰는 희소(sparse) 인덱스이다.
+
+각 항목은 (그때까지의 가장 큰 타임스탬프, 그 타임스탬프를 가진 레코드의 상대 오프셋)이다. 생산자가 정한 타임스탬프는
+순서가 뒤바뀔 수 있기 때문에 가장 큰 값을 기록해서 항목의 타임스탬프가 항상 증가하도록 한다.
+그러면 어떤 시각 t 이후의 첫 번째 레코드는, 타임스탬프가 t보다 작은 마지막 항목의 오프셋부터 차례로 읽어서 찾을 수 있다.
+
+항목이 적기 때문에 파일 전체를 메모리에 올려두고, 새 항목은 파일 끝에 바로 쓴다.
+*/
+type timeIndex struct {
+	file    *os.File
+	entries []timeEntry
+}
+
+type timeEntry struct {
+	timestamp int64
+	off       uint32 // 세그먼트의 베이스 오프셋에서의 상댓값
+}
+
+func newTimeIndex(f *os.File) (*timeIndex, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// 쓰다가 멈춘 항목은 버린다.
+	size := uint64(fi.Size()) / tsEntWidth * tsEntWidth
+	b := make([]byte, size)
+	if _, err := f.ReadAt(b, 0); err != nil && size > 0 {
+		return nil, err
+	}
+	t := &timeIndex{file: f}
+	for pos := uint64(0); pos < size; pos += tsEntWidth {
+		t.entries = append(t.entries, timeEntry{
+			timestamp: int64(enc.Uint64(b[pos : pos+tsWidth])),
+			off:       enc.Uint32(b[pos+tsWidth : pos+tsEntWidth]),
+		})
+	}
+	if uint64(fi.Size()) != size {
+		if err := f.Truncate(int64(size)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Write 메서드는 항목을 파일 끝에 추가한다.
+func (t *timeIndex) Write(timestamp int64, off uint32) error {
+	b := make([]byte, tsEntWidth)
+	enc.PutUint64(b[:tsWidth], uint64(timestamp))
+	enc.PutUint32(b[tsWidth:], off)
+	if _, err := t.file.Write(b); err != nil {
+		return err
+	}
+	t.entries = append(t.entries, timeEntry{timestamp: timestamp, off: off})
+	return nil
+}
+
+// Last 메서드는 마지막 항목을 리턴한다. 항목이 없다면 ok는 false이다.
+func (t *timeIndex) Last() (entry timeEntry, ok bool) {
+	if len(t.entries) == 0 {
+		return timeEntry{}, false
+	}
+	return t.entries[len(t.entries)-1], true
+}
+
+// Lookup 메서드는 timestamp 이상인 레코드를 찾기 시작할 상대 오프셋을 리턴한다.
+// 타임스탬프가 timestamp보다 작은 마지막 항목의 오프셋이며, 그런 항목이 없다면 0이다.
+func (t *timeIndex) Lookup(timestamp int64) uint32 {
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].timestamp >= timestamp
+	})
+	if i == 0 {
+		return 0
+	}
+	return t.entries[i-1].off
+}
+
+// truncate 메서드는 상대 오프셋이 n 이상인 항목을 지운다. 세그먼트를 복구한 후에 사용한다.
+func (t *timeIndex) truncate(n uint32) error {
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].off >= n
+	})
+	if i == len(t.entries) {
+		return nil
+	}
+	t.entries = t.entries[:i]
+	return t.file.Truncate(int64(uint64(i) * tsEntWidth))
+}
+
+func (t *timeIndex) Close() error {
+	if err := t.file.Sync(); err != nil {
+		return err
+	}
+	return t.file.Close()
+}
+
+func (t *timeIndex) Name() string {
+	return t.file.Name()
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeIndex(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "timeindex_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	idx, err := newTimeIndex(f)
+	require.NoError(t, err)
+	_, ok := idx.Last()
+	require.False(t, ok)
+	require.Equal(t, uint32(0), idx.Lookup(100))
+
+	entries := []timeEntry{
+		{timestamp: 100, off: 0},
+		{timestamp: 200, off: 4},
+		{timestamp: 300, off: 9},
+	}
+	for _, e := range entries {
+		require.NoError(t, idx.Write(e.timestamp, e.off))
+	}
+
+	// timestamp보다 작은 마지막 항목의 오프셋부터 찾기 시작한다.
+	require.Equal(t, uint32(0), idx.Lookup(50))
+	require.Equal(t, uint32(0), idx.Lookup(100))
+	require.Equal(t, uint32(0), idx.Lookup(150))
+	require.Equal(t, uint32(4), idx.Lookup(250))
+	require.Equal(t, uint32(9), idx.Lookup(400))
+	require.NoError(t, idx.Close())
+
+	// 쓰다가 멈춘 항목은 버리고 파일로부터 항목을 다시 읽는다.
+	f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+	idx, err = newTimeIndex(f)
+	require.NoError(t, err)
+	require.Equal(t, entries, idx.entries)
+
+	require.NoError(t, idx.truncate(5))
+	last, ok := idx.Last()
+	require.True(t, ok)
+	require.Equal(t, entries[1], last)
+	require.NoError(t, idx.Close())
+}
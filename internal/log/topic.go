@@ -0,0 +1,245 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+TopicManager는 한 서버에서 여러 개의 독립된 로그(토픽)를 관리한다. 토픽마다 루트 디렉터리 아래에 자신의 디렉터리를 가지는 PartitionedLog이다.
+
+	Dir/.topics       : 토픽들의 메타데이터(이름, 파티션 수, 세그먼트 설정)
+	Dir/<topic>/<p>/  : 토픽의 p번 파티션의 Log 디렉터리
+
+토픽의 Log는 처음 요청할 때 연다(lazy). 토픽이 많더라도 사용하지 않는 토픽은 파일을 열지 않는다.
+토픽의 세그먼트 설정은 메타데이터 파일에 저장하므로 서버를 다시 시작해도 같은 설정으로 연다. 0인 설정은 Config의 값을 사용한다.
+*/
+type TopicManager struct {
+	Dir    string
+	Config Config
+
+	mu     sync.Mutex
+	topics map[string]*api.Topic
+	logs   map[string]*PartitionedLog
+}
+
+// topicsFile은 토픽들의 메타데이터 파일의 이름이다. 토픽의 이름은 점(.)으로 시작할 수 없으므로 토픽의 디렉터리와 겹치지 않는다.
+const topicsFile = ".topics"
+
+// validTopicName은 토픽 이름의 규칙이다. 디렉터리 이름으로 쓰므로 경로 구분자나 ".."이 들어갈 수 없다.
+var validTopicName = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]{0,248}$`)
+
+// maxPartitions는 토픽의 최대 파티션 수이다. 파티션마다 세그먼트 파일들을 열어두므로 너무 많은 파티션은 파일 디스크립터를 다 써버린다.
+const maxPartitions = 1024
+
+/*
+토픽의 세그먼트 설정은 원격 요청으로 받으므로 범위를 확인한다. 0은 Config의 값을 사용한다는 뜻이다.
+  - 스토어는 헤더(headerWidth)보다, 인덱스는 한 항목(entWidth)보다 커야 레코드를 하나라도 쓸 수 있다.
+    그렇지 않으면 새 세그먼트가 만들자마자 가득 차서 Append가 io.EOF를 리턴하고 세그먼트 파일만 계속 생긴다.
+  - 인덱스 파일은 MaxIndexBytes 크기로 만들어서 메모리 맵하므로 너무 큰 값은 파티션마다 거대한 파일을 만든다.
+*/
+var (
+	minStoreBytes   uint64 = headerWidth + 1
+	minIndexBytes          = entWidth + 1
+	maxSegmentBytes uint64 = 1 << 30
+)
+
+// NewTopicManager 함수는 dir에 저장된 토픽들의 메타데이터를 읽는다. 토픽의 Log는 아직 열지 않는다.
+func NewTopicManager(dir string, c Config) (*TopicManager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &TopicManager{
+		Dir:    dir,
+		Config: c,
+		topics: make(map[string]*api.Topic),
+		logs:   make(map[string]*PartitionedLog),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load 메서드는 메타데이터 파일에서 토픽들을 읽는다. 파일이 없다면 토픽이 없는 것이다.
+func (m *TopicManager) load() error {
+	b, err := os.ReadFile(filepath.Join(m.Dir, topicsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var meta api.ListTopicsResponse
+	if err = protojson.Unmarshal(b, &meta); err != nil {
+		return err
+	}
+	for _, topic := range meta.Topics {
+		m.topics[topic.Name] = topic
+	}
+	return nil
+}
+
+// save 메서드는 토픽들의 메타데이터를 임시 파일에 쓴 후 이름을 바꿔서, 쓰는 도중에 멈추더라도 이전 파일이 남게 한다. m.mu를 잡은 상태에서 호출한다.
+func (m *TopicManager) save() error {
+	meta := &api.ListTopicsResponse{Topics: m.list()}
+	b, err := protojson.MarshalOptions{Multiline: true}.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.Dir, topicsFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// CreateTopic 메서드는 토픽을 만들고 메타데이터 파일에 저장한다. Log는 처음 사용할 때 연다.
+func (m *TopicManager) CreateTopic(topic *api.Topic) error {
+	if !validTopicName.MatchString(topic.Name) {
+		return api.ErrInvalidTopic{
+			Topic:  topic.Name,
+			Reason: "name must be 1-249 characters of [a-zA-Z0-9._-] and not start with '.'",
+		}
+	}
+	if topic.Partitions > maxPartitions {
+		return api.ErrInvalidTopic{
+			Topic:  topic.Name,
+			Reason: fmt.Sprintf("partitions must be at most %d", maxPartitions),
+		}
+	}
+	if n := topic.MaxStoreBytes; n != 0 && (n < minStoreBytes || n > maxSegmentBytes) {
+		return api.ErrInvalidTopic{
+			Topic:  topic.Name,
+			Reason: fmt.Sprintf("max_store_bytes must be 0 or between %d and %d", minStoreBytes, maxSegmentBytes),
+		}
+	}
+	if n := topic.MaxIndexBytes; n != 0 && (n < minIndexBytes || n > maxSegmentBytes) {
+		return api.ErrInvalidTopic{
+			Topic:  topic.Name,
+			Reason: fmt.Sprintf("max_index_bytes must be 0 or between %d and %d", minIndexBytes, maxSegmentBytes),
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.topics[topic.Name]; ok {
+		return api.ErrTopicExists{Topic: topic.Name}
+	}
+	// 토픽을 지우는 도중에 멈췄다면 디렉터리가 남아있을 수 있다. 새 토픽이 이전 레코드를 보지 않도록 지운다.
+	if err := os.RemoveAll(filepath.Join(m.Dir, topic.Name)); err != nil {
+		return err
+	}
+	topic = proto.Clone(topic).(*api.Topic)
+	if topic.Partitions == 0 {
+		topic.Partitions = 1
+	}
+	m.topics[topic.Name] = topic
+	if err := m.save(); err != nil {
+		delete(m.topics, topic.Name)
+		return err
+	}
+	return nil
+}
+
+/*
+DeleteTopic 메서드는 토픽을 메타데이터에서 지우고, 토픽의 Log를 닫은 후 디렉터리를 지운다.
+토픽의 Log를 사용하던 요청들이 끝나기를 기다린 후에 닫는다. 이후에 그 Log를 사용하는 요청(레코드를 기다리던 ConsumeStream 포함)은
+파일 에러 대신 api.ErrTopicNotFound를 받는다.
+*/
+func (m *TopicManager) DeleteTopic(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topic, ok := m.topics[name]
+	if !ok {
+		return api.ErrTopicNotFound{Topic: name}
+	}
+	delete(m.topics, name)
+	if err := m.save(); err != nil {
+		m.topics[name] = topic
+		return err
+	}
+	if l, ok := m.logs[name]; ok {
+		delete(m.logs, name)
+		return l.remove(api.ErrTopicNotFound{Topic: name})
+	}
+	return os.RemoveAll(filepath.Join(m.Dir, name))
+}
+
+// ListTopics 메서드는 토픽들을 이름 순서로 리턴한다.
+func (m *TopicManager) ListTopics() ([]*api.Topic, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(), nil
+}
+
+func (m *TopicManager) list() []*api.Topic {
+	topics := make([]*api.Topic, 0, len(m.topics))
+	for _, topic := range m.topics {
+		topics = append(topics, proto.Clone(topic).(*api.Topic))
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Name < topics[j].Name
+	})
+	return topics
+}
+
+// Topic 메서드는 토픽의 PartitionedLog를 리턴한다. 아직 열지 않았다면 토픽의 파티션 수와 세그먼트 설정으로 연다.
+func (m *TopicManager) Topic(name string) (*PartitionedLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.logs[name]; ok {
+		return l, nil
+	}
+	topic, ok := m.topics[name]
+	if !ok {
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	c := m.Config
+	if topic.MaxStoreBytes != 0 {
+		c.Segment.MaxStoreBytes = topic.MaxStoreBytes
+	}
+	if topic.MaxIndexBytes != 0 {
+		c.Segment.MaxIndexBytes = topic.MaxIndexBytes
+	}
+	l, err := NewPartitionedLog(filepath.Join(m.Dir, name), c, topic.Partitions)
+	if err != nil {
+		return nil, err
+	}
+	m.logs[name] = l
+	return l, nil
+}
+
+// Close 메서드는 열어둔 모든 토픽의 Log를 닫는다.
+func (m *TopicManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	for name, l := range m.logs {
+		if cerr := l.Close(); err == nil {
+			err = cerr
+		}
+		delete(m.logs, name)
+	}
+	return err
+}
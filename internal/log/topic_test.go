@@ -0,0 +1,246 @@
+package log
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicManager(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, dir string){
+		"topics are independent logs":        testTopicsIndependent,
+		"topics persist across restarts":     testTopicsPersist,
+		"delete topic removes its records":   testDeleteTopic,
+		"delete topic fails in-flight users": testDeleteTopicInFlight,
+		"invalid and duplicate topics fail":  testInvalidTopics,
+		"topic segment config overrides log": testTopicSegmentConfig,
+		"topics open their partitions":       testTopicPartitions,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "topic-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			fn(t, dir)
+		})
+	}
+}
+
+func testTopicsIndependent(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "orders"}))
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "payments"}))
+
+	orders, err := m.Topic("orders")
+	require.NoError(t, err)
+	payments, err := m.Topic("payments")
+	require.NoError(t, err)
+
+	for _, v := range []string{"o1", "o2"} {
+		_, err = orders.Append(&api.Record{Value: []byte(v)})
+		require.NoError(t, err)
+	}
+	off, err := payments.Append(&api.Record{Value: []byte("p1")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	// 같은 토픽은 같은 Log를 리턴한다.
+	again, err := m.Topic("orders")
+	require.NoError(t, err)
+	require.Same(t, orders, again)
+
+	record, err := payments.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("p1"), record.Value)
+	_, err = payments.Read(1)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+
+	_, err = m.Topic("missing")
+	require.Equal(t, api.ErrTopicNotFound{Topic: "missing"}, err)
+}
+
+func testTopicsPersist(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "b", MaxStoreBytes: 2048}))
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "a"}))
+	a, err := m.Topic("a")
+	require.NoError(t, err)
+	_, err = a.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+
+	m, err = NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+	topics, err := m.ListTopics()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(topics))
+	require.Equal(t, "a", topics[0].Name)
+	require.Equal(t, "b", topics[1].Name)
+	require.Equal(t, uint64(2048), topics[1].MaxStoreBytes)
+
+	a, err = m.Topic("a")
+	require.NoError(t, err)
+	record, err := a.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+}
+
+func testDeleteTopic(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "events"}))
+	events, err := m.Topic("events")
+	require.NoError(t, err)
+	_, err = events.Append(&api.Record{Value: []byte("old")})
+	require.NoError(t, err)
+
+	require.NoError(t, m.DeleteTopic("events"))
+	_, err = os.Stat(filepath.Join(dir, "events"))
+	require.True(t, os.IsNotExist(err))
+	_, err = m.Topic("events")
+	require.Equal(t, api.ErrTopicNotFound{Topic: "events"}, err)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "events"}, m.DeleteTopic("events"))
+
+	// 같은 이름으로 다시 만든 토픽은 비어있다.
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "events"}))
+	events, err = m.Topic("events")
+	require.NoError(t, err)
+	_, err = events.Read(0)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+}
+
+// 지운 토픽의 Log를 아직 가지고 있는 요청들은 파일 에러 대신 ErrTopicNotFound를 받는다.
+func testDeleteTopicInFlight(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "events"}))
+	events, err := m.Topic("events")
+	require.NoError(t, err)
+	_, err = events.Append(&api.Record{Value: []byte("old")})
+	require.NoError(t, err)
+
+	// 다음 레코드를 기다리는 ConsumeStream
+	waited := make(chan error, 1)
+	go func() {
+		waited <- events.Wait(context.Background(), 1)
+	}()
+
+	require.NoError(t, m.DeleteTopic("events"))
+	notFound := api.ErrTopicNotFound{Topic: "events"}
+	select {
+	case err = <-waited:
+		require.Equal(t, notFound, err)
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the topic was deleted")
+	}
+
+	_, err = events.Append(&api.Record{Value: []byte("new")})
+	require.Equal(t, notFound, err)
+	_, err = events.Read(0)
+	require.Equal(t, notFound, err)
+	_, err = events.ReadRange(0, 10, 0)
+	require.Equal(t, notFound, err)
+	_, err = events.LastStableOffsetPartition(0)
+	require.Equal(t, notFound, err)
+	require.Equal(t, notFound, events.Wait(context.Background(), 0))
+}
+
+func testInvalidTopics(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+
+	for _, name := range []string{"", ".", "..", ".topics", "a/b", "a b"} {
+		err := m.CreateTopic(&api.Topic{Name: name})
+		require.IsType(t, api.ErrInvalidTopic{}, err, name)
+	}
+	err = m.CreateTopic(&api.Topic{Name: "many", Partitions: maxPartitions + 1})
+	require.IsType(t, api.ErrInvalidTopic{}, err)
+	// 세그먼트 설정은 레코드를 하나라도 쓸 수 있는 크기부터 maxSegmentBytes까지만 받는다.
+	for _, topic := range []*api.Topic{
+		{Name: "tiny-store", MaxStoreBytes: minStoreBytes - 1},
+		{Name: "huge-store", MaxStoreBytes: maxSegmentBytes + 1},
+		{Name: "tiny-index", MaxIndexBytes: minIndexBytes - 1},
+		{Name: "huge-index", MaxIndexBytes: maxSegmentBytes + 1},
+	} {
+		err := m.CreateTopic(topic)
+		require.IsType(t, api.ErrInvalidTopic{}, err, topic.Name)
+	}
+	_, err = m.Topic("tiny-store")
+	require.Equal(t, api.ErrTopicNotFound{Topic: "tiny-store"}, err)
+
+	// 가장 작은 설정으로도 레코드를 추가하고 읽을 수 있다.
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "smallest", MaxStoreBytes: minStoreBytes, MaxIndexBytes: minIndexBytes}))
+	smallest, err := m.Topic("smallest")
+	require.NoError(t, err)
+	for i := uint64(0); i < 3; i++ {
+		off, err := smallest.Append(&api.Record{Value: []byte("hello")})
+		require.NoError(t, err)
+		require.Equal(t, i, off)
+	}
+	record, err := smallest.Read(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "v1.events"}))
+	require.Equal(t, api.ErrTopicExists{Topic: "v1.events"}, m.CreateTopic(&api.Topic{Name: "v1.events"}))
+}
+
+func testTopicSegmentConfig(t *testing.T, dir string) {
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	m, err := NewTopicManager(dir, c)
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "small", MaxStoreBytes: 32}))
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "default"}))
+	small, err := m.Topic("small")
+	require.NoError(t, err)
+	def, err := m.Topic("default")
+	require.NoError(t, err)
+	require.Equal(t, uint64(32), small.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(1024), def.Config.Segment.MaxStoreBytes)
+}
+
+func testTopicPartitions(t *testing.T, dir string) {
+	m, err := NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "orders", Partitions: 3}))
+	require.NoError(t, m.CreateTopic(&api.Topic{Name: "events"}))
+	orders, err := m.Topic("orders")
+	require.NoError(t, err)
+	_, err = orders.AppendPartition(2, &api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	require.NoError(t, m.Close())
+
+	// 파티션 수는 메타데이터에 저장되므로 다시 열어도 같다. 지정하지 않은 토픽은 파티션 하나이다.
+	m, err = NewTopicManager(dir, Config{})
+	require.NoError(t, err)
+	defer m.Close()
+	topics, err := m.ListTopics()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), topics[0].Partitions)
+	require.Equal(t, uint32(3), topics[1].Partitions)
+
+	orders, err = m.Topic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), orders.Partitions())
+	record, err := orders.ReadPartition(2, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), record.Value)
+	_, err = os.Stat(filepath.Join(dir, "orders", "2"))
+	require.NoError(t, err)
+}
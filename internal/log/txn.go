@@ -0,0 +1,201 @@
+package log
+
+import (
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+)
+
+/*
+트랜잭션은 한 로그(파티션)에 여러 레코드를 원자적으로 추가한다. 소비자가 비즈니스 이벤트의 절반만 보는 일이 없도록,
+read_committed 소비자는 커밋된 트랜잭션의 레코드만 받는다.
+
+트랜잭션의 시작과 끝은 로그에 제어 마커(Record.Control)로 쓴다.
+
+	BEGIN(txn) ... 레코드(txn) ... 레코드(txn) ... COMMIT(txn) 또는 ABORT(txn)
+
+트랜잭션의 레코드는 추가한 즉시 로그에 있지만, 커밋하기 전까지는 read_committed 소비자에게 보이지 않는다.
+  - last stable offset(LSO)은 열려있는 트랜잭션 중 가장 먼저 시작한 것의 BEGIN 오프셋이다. 열린 트랜잭션이 없다면 다음 오프셋이다.
+    LSO보다 앞의 레코드는 모두 결과(커밋 또는 중단)가 정해졌으므로 read_committed 소비자는 LSO 앞까지만 읽는다.
+  - 중단한 트랜잭션의 ID들은 aborted에 기억한다. read_committed 소비자는 이 트랜잭션들의 레코드를 건너뛴다.
+  - 제어 마커는 소비자에게 보내지 않는다.
+
+트랜잭션의 상태는 로그의 레코드들로부터 만들 수 있으므로 따로 저장하지 않고, producers처럼 Log를 시작할 때 세그먼트들을 읽어서 다시 만든다.
+그래서 서버가 다시 시작해도 열려있던 트랜잭션의 레코드와 상태가 남아있고, 클라이언트는 같은 트랜잭션을 이어서 커밋하거나 중단할 수 있다.
+Transaction.Timeout이 지나도록 끝나지 않은 트랜잭션은 백그라운드 고루틴이 ABORT 마커를 써서 중단한다. 시작한 시각은 BEGIN 마커의
+타임스탬프이므로, 서버가 멈춰있는 동안 타임아웃이 지난 트랜잭션은 다시 시작한 후 첫 번째 확인에서 중단한다.
+*/
+type transactions struct {
+	open map[uint64]openTxn
+	// aborted는 중단한 트랜잭션의 ID와 ABORT 마커의 오프셋이다. 트랜잭션의 레코드는 모두 마커보다 앞에 있으므로
+	// 보존 정책이 마커를 지웠다면 레코드도 모두 지워진 것이고, 그 항목도 지운다(forget).
+	aborted map[uint64]uint64
+}
+
+type openTxn struct {
+	// first는 트랜잭션의 첫 번째 레코드(BEGIN 마커)의 오프셋이다.
+	first   uint64
+	started time.Time
+}
+
+func newTransactions() *transactions {
+	return &transactions{
+		open:    make(map[uint64]openTxn),
+		aborted: make(map[uint64]uint64),
+	}
+}
+
+// check 메서드는 레코드를 추가해도 되는지 트랜잭션의 상태로 확인한다.
+func (t *transactions) check(record *api.Record) error {
+	switch record.Control {
+	case api.ControlType_CONTROL_NONE:
+		if record.TxnId == 0 {
+			return nil
+		}
+		return t.checkOpen(record.TxnId)
+	case api.ControlType_CONTROL_BEGIN:
+		if record.TxnId == 0 {
+			return api.ErrInvalidTxn{Reason: "no transaction id"}
+		}
+		if _, ok := t.open[record.TxnId]; ok {
+			return api.ErrInvalidTxn{TxnID: record.TxnId, Reason: "transaction is already open"}
+		}
+		if _, ok := t.aborted[record.TxnId]; ok {
+			return api.ErrInvalidTxn{TxnID: record.TxnId, Reason: "transaction was aborted"}
+		}
+		return nil
+	case api.ControlType_CONTROL_COMMIT, api.ControlType_CONTROL_ABORT:
+		return t.checkOpen(record.TxnId)
+	}
+	return api.ErrInvalidTxn{TxnID: record.TxnId, Reason: "unknown control type"}
+}
+
+func (t *transactions) checkOpen(id uint64) error {
+	if _, ok := t.open[id]; ok {
+		return nil
+	}
+	if _, ok := t.aborted[id]; ok {
+		return api.ErrInvalidTxn{TxnID: id, Reason: "transaction was aborted"}
+	}
+	return api.ErrInvalidTxn{TxnID: id, Reason: "transaction is not open"}
+}
+
+/*
+add 메서드는 추가한 레코드를 트랜잭션의 상태에 반영한다.
+세그먼트들로부터 다시 만들 때는 보존 정책이 BEGIN 마커를 지웠을 수 있으므로, 마커 없이 처음 보는 트랜잭션의 레코드가 트랜잭션을 연다.
+*/
+func (t *transactions) add(record *api.Record) {
+	if record.TxnId == 0 {
+		return
+	}
+	switch record.Control {
+	case api.ControlType_CONTROL_NONE, api.ControlType_CONTROL_BEGIN:
+		if _, ok := t.open[record.TxnId]; ok {
+			return
+		}
+		if _, ok := t.aborted[record.TxnId]; ok {
+			return
+		}
+		t.open[record.TxnId] = openTxn{first: record.Offset, started: record.Timestamp.AsTime()}
+	case api.ControlType_CONTROL_COMMIT:
+		delete(t.open, record.TxnId)
+	case api.ControlType_CONTROL_ABORT:
+		delete(t.open, record.TxnId)
+		t.aborted[record.TxnId] = record.Offset
+	}
+}
+
+// lastStableOffset 메서드는 열려있는 트랜잭션 중 가장 먼저 시작한 것의 첫 오프셋을 리턴한다. 없다면 next이다.
+func (t *transactions) lastStableOffset(next uint64) uint64 {
+	lso := next
+	for _, txn := range t.open {
+		if txn.first < lso {
+			lso = txn.first
+		}
+	}
+	return lso
+}
+
+// forget 메서드는 ABORT 마커가 lowest보다 앞에 있는(지워진) 중단한 트랜잭션들을 잊는다.
+func (t *transactions) forget(lowest uint64) {
+	for id, off := range t.aborted {
+		if off < lowest {
+			delete(t.aborted, id)
+		}
+	}
+}
+
+// expired 메서드는 now에 타임아웃이 지난 열린 트랜잭션들의 ID를 리턴한다.
+func (t *transactions) expired(now time.Time, timeout time.Duration) []uint64 {
+	var ids []uint64
+	for id, txn := range t.open {
+		if now.Sub(txn.started) > timeout {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// LastStableOffset 메서드는 read_committed 소비자가 읽을 수 있는 마지막 오프셋의 다음 오프셋(LSO)을 리턴한다.
+func (l *Log) LastStableOffset() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.txns.lastStableOffset(l.activeSegment.nextOffset)
+}
+
+// Aborted 메서드는 트랜잭션이 중단되었는지를 리턴한다. read_committed 소비자는 중단한 트랜잭션의 레코드를 건너뛴다.
+func (l *Log) Aborted(txnID uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.txns.aborted[txnID]
+	return ok
+}
+
+// AbortExpiredTxns 메서드는 Transaction.Timeout이 지난 열린 트랜잭션들을 중단한다. 타임아웃이 0이면 아무것도 하지 않는다.
+func (l *Log) AbortExpiredTxns() error {
+	return l.abortExpiredTxns(time.Now())
+}
+
+func (l *Log) abortExpiredTxns(now time.Time) error {
+	if l.Config.Transaction.Timeout <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	ids := l.txns.expired(now, l.Config.Transaction.Timeout)
+	l.mu.Unlock()
+
+	var err error
+	for _, id := range ids {
+		_, aerr := l.Append(&api.Record{TxnId: id, Control: api.ControlType_CONTROL_ABORT})
+		// 확인한 후에 클라이언트가 먼저 끝냈다면 트랜잭션은 이미 닫혀있다.
+		if _, ok := aerr.(api.ErrInvalidTxn); ok {
+			continue
+		}
+		if aerr != nil && err == nil {
+			err = aerr
+		}
+	}
+	return err
+}
+
+// startTxnJanitor 메서드는 타임아웃이 지난 트랜잭션들을 주기적으로 중단하는 고루틴을 시작한다.
+func (l *Log) startTxnJanitor() {
+	if l.Config.Transaction.Timeout <= 0 {
+		return
+	}
+	l.wg.Add(1)
+	go func(done <-chan struct{}) {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.Config.Transaction.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 중단하지 못한 트랜잭션은 다음 주기에 다시 시도한다.
+				_ = l.AbortExpiredTxns()
+			}
+		}
+	}(l.done)
+}
@@ -0,0 +1,205 @@
+package log
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactions(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, log *Log){
+		"commit advances the last stable offset": testTxnCommit,
+		"aborted transactions are remembered":    testTxnAbort,
+		"invalid transaction states fail":        testTxnInvalid,
+		"open transactions survive a restart":    testTxnRestart,
+		"expired transactions are aborted":       testTxnTimeout,
+		"wait stable wakes on commit":            testTxnWaitStable,
+		"compaction drops aborted records":       testTxnCompaction,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "txn-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			c := Config{}
+			c.Segment.MaxStoreBytes = 128
+			log, err := NewLog(dir, c)
+			require.NoError(t, err)
+			defer log.Close()
+			fn(t, log)
+		})
+	}
+}
+
+// control 함수는 트랜잭션의 제어 마커를 추가한다.
+func control(t *testing.T, log *Log, id uint64, c api.ControlType) uint64 {
+	t.Helper()
+	off, err := log.Append(&api.Record{TxnId: id, Control: c})
+	require.NoError(t, err)
+	return off
+}
+
+// txnRecord 함수는 트랜잭션의 레코드를 추가한다.
+func txnRecord(t *testing.T, log *Log, id uint64, key string) uint64 {
+	t.Helper()
+	off, err := log.Append(&api.Record{Key: []byte(key), Value: []byte("hello"), TxnId: id})
+	require.NoError(t, err)
+	return off
+}
+
+func testTxnCommit(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), log.LastStableOffset())
+
+	begin := control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	txnRecord(t, log, 1, "")
+	// 트랜잭션 밖의 레코드가 추가되어도 LSO는 열린 트랜잭션의 시작에 머문다.
+	_, err = log.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	txnRecord(t, log, 1, "")
+	require.Equal(t, begin, log.LastStableOffset())
+
+	commit := control(t, log, 1, api.ControlType_CONTROL_COMMIT)
+	require.Equal(t, commit+1, log.LastStableOffset())
+	require.False(t, log.Aborted(1))
+}
+
+func testTxnAbort(t *testing.T, log *Log) {
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	control(t, log, 2, api.ControlType_CONTROL_BEGIN)
+	txnRecord(t, log, 1, "")
+	txnRecord(t, log, 2, "")
+	control(t, log, 1, api.ControlType_CONTROL_ABORT)
+	// 1번 트랜잭션이 끝났어도 2번이 열려있으므로 LSO는 2번의 시작이다.
+	require.Equal(t, uint64(1), log.LastStableOffset())
+	require.True(t, log.Aborted(1))
+	require.False(t, log.Aborted(2))
+
+	_, err := log.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_COMMIT})
+	require.Equal(t, api.ErrInvalidTxn{TxnID: 1, Reason: "transaction was aborted"}, err)
+	_, err = log.Append(&api.Record{Value: []byte("hello"), TxnId: 1})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+}
+
+func testTxnInvalid(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("hello"), TxnId: 1})
+	require.Equal(t, api.ErrInvalidTxn{TxnID: 1, Reason: "transaction is not open"}, err)
+	_, err = log.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_COMMIT})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+	_, err = log.Append(&api.Record{Control: api.ControlType_CONTROL_BEGIN})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	_, err = log.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_BEGIN})
+	require.Equal(t, api.ErrInvalidTxn{TxnID: 1, Reason: "transaction is already open"}, err)
+
+	// 배치에는 마커를 담을 수 없고, 열린 트랜잭션의 레코드는 담을 수 있다.
+	_, err = log.AppendBatch([]*api.Record{
+		{Value: []byte("hello"), TxnId: 1},
+		{TxnId: 1, Control: api.ControlType_CONTROL_COMMIT},
+	})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+	_, err = log.AppendBatch([]*api.Record{
+		{Value: []byte("hello"), TxnId: 1},
+		{Value: []byte("hello"), TxnId: 2},
+	})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+	first, err := log.AppendBatch([]*api.Record{
+		{Value: []byte("hello"), TxnId: 1},
+		{Value: []byte("hello"), TxnId: 1},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first)
+}
+
+func testTxnRestart(t *testing.T, log *Log) {
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	control(t, log, 2, api.ControlType_CONTROL_BEGIN)
+	// 여러 세그먼트에 걸쳐서 추가한다.
+	for i := 0; i < 5; i++ {
+		txnRecord(t, log, 1, "")
+		txnRecord(t, log, 2, "")
+	}
+	require.Greater(t, len(log.segments), 1)
+	control(t, log, 2, api.ControlType_CONTROL_ABORT)
+	require.NoError(t, log.Close())
+
+	n, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer n.Close()
+	require.Equal(t, 1, n.Recovery().OpenTransactions)
+	require.Equal(t, uint64(0), n.LastStableOffset())
+	require.True(t, n.Aborted(2))
+
+	// 다시 시작하기 전에 열었던 트랜잭션을 이어서 끝낼 수 있다.
+	txnRecord(t, n, 1, "")
+	commit := control(t, n, 1, api.ControlType_CONTROL_COMMIT)
+	require.Equal(t, commit+1, n.LastStableOffset())
+}
+
+func testTxnTimeout(t *testing.T, log *Log) {
+	log.Config.Transaction.Timeout = time.Minute
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	txnRecord(t, log, 1, "")
+
+	require.NoError(t, log.abortExpiredTxns(time.Now()))
+	require.False(t, log.Aborted(1))
+	require.NoError(t, log.abortExpiredTxns(time.Now().Add(2*time.Minute)))
+	require.True(t, log.Aborted(1))
+	require.Equal(t, uint64(3), log.LastStableOffset())
+
+	_, err := log.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_COMMIT})
+	require.IsType(t, api.ErrInvalidTxn{}, err)
+}
+
+func testTxnWaitStable(t *testing.T, log *Log) {
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	txnRecord(t, log, 1, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 레코드는 있지만 트랜잭션이 열려있으므로 안정되지 않았다.
+	require.Equal(t, context.DeadlineExceeded, log.WaitStable(ctx, 1))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- log.WaitStable(context.Background(), 1)
+	}()
+	// 트랜잭션 밖의 레코드로는 깨어나도 다시 기다린다.
+	_, err := log.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	control(t, log, 1, api.ControlType_CONTROL_COMMIT)
+	select {
+	case err := <-errc:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitStable did not return after commit")
+	}
+}
+
+func testTxnCompaction(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Key: []byte("a"), Value: []byte("committed")})
+	require.NoError(t, err)
+	control(t, log, 1, api.ControlType_CONTROL_BEGIN)
+	aborted := txnRecord(t, log, 1, "a")
+	control(t, log, 1, api.ControlType_CONTROL_ABORT)
+	// 이후의 레코드로 앞의 세그먼트들을 봉인한다.
+	for len(log.segments) < 3 {
+		_, err = log.Append(&api.Record{Value: []byte("filler")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Compact())
+
+	// 중단한 레코드는 지워지고, 그 레코드가 가렸던 키의 커밋된 값은 남는다.
+	record, err := log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("committed"), record.Value)
+	record, err = log.Read(aborted)
+	require.NoError(t, err)
+	require.NotEqual(t, aborted, record.Offset)
+	require.Equal(t, api.ControlType_CONTROL_ABORT, record.Control)
+}
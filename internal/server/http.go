@@ -1,100 +1,178 @@
 /*
-JSON/HTTP 웹 서버를 만든다. Go 웹 서버는 API 하나의 엔드포인트마다 하나의 함수로 구성된다.
-바로 net/http 패키지의 HandleFunc(pattern string, handler(ResponseWriter, *Request)) 함수다.
-로그에 쓰는 Produce와 로그에서 읽는 Consume 엔드 포인트를 만들어보겠다.
-JSON/HTTP 웹 서버를 만들 때 각 핸들러는 세 단계로 구성한다.
-1. 요청의 JSON 본문(body)을 역직렬화하기
-2. 요청에 관한 엔드포인트의 로직을 실행해서 결과 얻기
-3. 결과를 직렬화하여 응답에 쓰기
-
-핸들러가 복잡해지면 코드를 분리하고, 요청-응답 처리를 미들웨어로 옮기고, 비즈니스 로직을 스택의 아래쪽으로 옮겨야 한다.
+JSON/HTTP API. gRPC를 쓸 수 없는 클라이언트(curl, 브라우저의 도구 등)를 위해 gRPC 서버와 같은 로그를 HTTP로 서비스한다.
+
+처음에는 HTTP 핸들러를 직접 작성해서 요청을 api의 요청 메시지로 바꾸었지만, 이제는 api/v1/log.proto의 HTTP 규칙(google.api.http)으로
+생성한 게이트웨이(grpc-gateway, api/v1/log.pb.gw.go)가 요청을 바꾼다. RPC를 추가하거나 필드를 바꾸면 .proto 파일의 규칙만 고치고
+다시 컴파일하면 된다. 게이트웨이는 grpcServer의 메서드를 같은 프로세스 안에서 그대로 호출하므로(RegisterLogHandlerServer)
+같은 Config를 사용하고, 토픽과 파티션, 트랜잭션의 격리 수준, 롱 폴링(MaxConsumeWait)과 권한 확인이 gRPC와 똑같이 동작한다.
+
+  - POST /v1/records                 본문의 ProduceRequest로 레코드를 추가한다. 응답은 ProduceResponse이다.
+  - GET  /v1/records/{offset}        오프셋의 레코드를 읽는다. 응답은 ConsumeResponse이다.
+  - GET  /v1/records?offset=&max_records=&max_bytes=
+                                     오프셋부터 이어지는 레코드들을 읽는다(ConsumeBatch). 응답은 ConsumeBatchResponse이다.
+  - 토픽, 컨슈머 그룹, 트랜잭션 등 나머지 RPC의 경로는 log.proto를 보라.
+  - GET  /v1/records/stream, /v1/records/ws
+                                     로그를 따라가며 레코드들을 Server-Sent Events나 WebSocket으로 보낸다(tail.go).
+  - GET  /openapi.json               생성한 OpenAPI(Swagger 2.0) 문서이다.
+
+본문이 없는 요청의 필드들은 쿼리 파라미터로 받는다(topic, partition, isolation_level=READ_COMMITTED, start_time=RFC 3339 등).
+본문과 응답은 protobuf 메시지의 JSON 표현(protojson)이며, 필드 이름은 .proto 파일의 이름을 그대로 쓴다. bytes 필드는 base64이다.
+
+	$ curl --cert client.pem --key client-key.pem --cacert ca.pem \
+		-d '{"record": {"value": "aGVsbG8="}}' https://127.0.0.1:8400/v1/records
+
+에러는 gRPC 상태 코드에 해당하는 HTTP 상태 코드와 함께 google.rpc.Status의 JSON 표현으로 회신한다. 상태의 details도 그대로 회신하므로
+api.ErrOffsetOutOfRange는 LocalizedMessage를 담고 있다. 로그의 범위를 벗어난 오프셋은 오프셋 하나를 읽을 때는 404 Not Found,
+범위를 읽을 때는 416 Range Not Satisfiable이다.
+
+TLS 상호 인증으로 연결했다면 gRPC와 마찬가지로 클라이언트 인증서의 주체(CommonName)로 ACL 권한을 확인한다.
+gRPC와 같은 포트로 서비스하려면 NewMux를 사용한다(mux.go).
 */
 
 package server
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"net/http"
 
-	"github.com/gorilla/mux"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-func NewHTTPServer(addr string) *http.Server {
-	httpsrv := newHTTPServer()
-	r := mux.NewRouter()
-	r.HandleFunc("/", httpsrv.handleProduce).Methods("POST")
-	r.HandleFunc("/", httpsrv.handleConsume).Methods("GET")
+// NewHTTPServer 함수는 config의 로그를 서비스하는 HTTP 서버를 만든다.
+// TLS 상호 인증을 하려면 리턴한 서버의 TLSConfig를 설정하고 ServeTLS로 서비스하거나, tls.NewListener로 감싼 리스너로 Serve를 호출한다.
+func NewHTTPServer(addr string, config *Config) (*http.Server, error) {
+	srv, err := newgrpcServer(config)
+	if err != nil {
+		return nil, err
+	}
+	httpsrv := &httpServer{srv}
+	gw := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   marshaler,
+			UnmarshalOptions: unmarshaler,
+		}),
+		runtime.WithErrorHandler(handleGatewayError),
+	)
+	if err = api.RegisterLogHandlerServer(context.Background(), gw, srv); err != nil {
+		return nil, err
+	}
+	// 나중에 등록한 경로를 먼저 확인하므로 /v1/records/{offset}보다 먼저 매칭된다.
+	for path, h := range map[string]http.HandlerFunc{
+		"/v1/records/stream": httpsrv.handleSSE,
+		"/v1/records/ws":     httpsrv.handleWebSocket,
+		"/openapi.json":      handleOpenAPI,
+	} {
+		if err = gw.HandlePath(http.MethodGet, path, func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+			h(w, r)
+		}); err != nil {
+			return nil, err
+		}
+	}
 	return &http.Server{
 		Addr:    addr,
-		Handler: r,
-	}
+		Handler: authenticateHTTP(gw),
+	}, nil
 }
 
 type httpServer struct {
-	Log *Log
-}
-
-func newHTTPServer() *httpServer {
-	return &httpServer{
-		Log: NewLog(),
-	}
-}
-
-type ProduceRequest struct {
-	Record Record `json:"record"`
+	*grpcServer
 }
 
-type ProduceResponse struct {
-	Offset uint64 `json:"offset"`
+// authenticateHTTP 함수는 gRPC의 authenticate 인터셉터처럼 클라이언트 인증서의 주체를 요청의 콘텍스트에 쓰는 미들웨어이다.
+// TLS가 아니거나 클라이언트 인증서가 없다면 주체는 빈 문자열이다.
+func authenticateHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject := ""
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			subject = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		ctx := context.WithValue(r.Context(), subjectContextKey{}, subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
-type ConsumeRequest struct {
-	Offset uint64 `json:"offset"`
-}
+var (
+	marshaler   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
 
-type ConsumeResponse struct {
-	Record Record `json:"record"`
+// handleOpenAPI 함수는 log.proto로 생성한 OpenAPI 문서를 회신한다. API의 설명이므로 권한을 확인하지 않는다.
+func handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.OpenAPI)
 }
 
-func (s *httpServer) handleProduce(w http.ResponseWriter, r *http.Request) {
-	var req ProduceRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// handleGatewayError 함수는 게이트웨이의 에러 핸들러이다. 요청을 파싱하지 못한 에러와 RPC의 에러를 writeError처럼 회신한다.
+// 범위를 읽을 때(ConsumeBatch) 시작 오프셋이 로그의 범위를 벗어났다면 416이다.
+func handleGatewayError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	var herr *runtime.HTTPStatusError
+	if errors.As(err, &herr) {
+		writeErrorCode(w, herr.Err, herr.HTTPStatus)
 		return
 	}
-	off, err := s.Log.Append(req.Record)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	code := httpStatus(err)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		if method, _ := runtime.RPCMethod(ctx); method == "/log.v1.Log/ConsumeBatch" {
+			code = http.StatusRequestedRangeNotSatisfiable
+		}
 	}
+	writeErrorCode(w, err, code)
+}
 
-	res := ProduceResponse{Offset: off}
-	err = json.NewEncoder(w).Encode(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// writeError 함수는 에러를 gRPC 상태 코드에 해당하는 HTTP 상태 코드와 google.rpc.Status의 JSON으로 회신한다.
+// 응답을 쓴 다음에는 핸들러가 더 쓰지 않고 바로 리턴해야 한다.
+func writeError(w http.ResponseWriter, err error) {
+	writeErrorCode(w, err, httpStatus(err))
 }
 
-func (s *httpServer) handleConsume(w http.ResponseWriter, r *http.Request) {
-	var req ConsumeRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+func writeErrorCode(w http.ResponseWriter, err error, code int) {
+	st := status.Convert(err)
+	b, merr := marshaler.Marshal(st.Proto())
+	if merr != nil {
+		http.Error(w, st.Message(), code)
 		return
 	}
-	record, err := s.Log.Read(req.Offset)
-	if err == ErrOffsetNotFound {
-		http.Error(w, err.Error(), http.StatusNotFound)
-	}
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// httpStatus 함수는 에러의 gRPC 상태 코드에 해당하는 HTTP 상태 코드를 리턴한다.
+// api.ErrOffsetOutOfRange는 상태 코드로 HTTP의 404를 그대로 쓰므로 따로 확인한다.
+func httpStatus(err error) int {
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		return http.StatusNotFound
 	}
-	res := ConsumeResponse{Record: record}
-	err = json.NewEncoder(w).Encode(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // 클라이언트가 요청을 취소했다(nginx의 관례).
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
 	}
+	return http.StatusInternalServerError
 }
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/config"
+	"github.com/sodami-hub/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTP(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, root, nobody *httpClient, clog *log.Log){
+		"produce and consume a record":      testHTTPProduceConsume,
+		"consume a range of records":        testHTTPConsumeRange,
+		"offsets out of range are 404/416":  testHTTPOutOfRange,
+		"invalid requests are 400":          testHTTPBadRequest,
+		"unauthorized clients are rejected": testHTTPUnauthorized,
+		"read committed skips aborted txns": testHTTPReadCommitted,
+		"errors carry status details":       testHTTPErrorDetails,
+		"serve the OpenAPI document":        testHTTPOpenAPI,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			root, nobody, clog, teardown := setupHTTPTest(t)
+			defer teardown()
+			fn(t, root, nobody, clog)
+		})
+	}
+}
+
+// setupHTTPTest 함수는 TLS 상호 인증을 하는 서버(Mux)와 root, nobody 인증서로 연결하는 클라이언트를 만든다.
+func setupHTTPTest(t *testing.T) (root, nobody *httpClient, clog *log.Log, teardown func()) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	newClient := func(crtPath, keyPath string) *httpClient {
+		tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile: crtPath,
+			KeyFile:  keyPath,
+			CAFile:   config.CAFile,
+		})
+		require.NoError(t, err)
+		return &httpClient{
+			t:    t,
+			base: "https://" + l.Addr().String(),
+			tls:  tlsConfig,
+			client: &http.Client{
+				Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			},
+		}
+	}
+	root = newClient(config.RootClientCertFile, config.RootClientKeyFile)
+	nobody = newClient(config.NobodyClientCertFile, config.NobodyClientKeyFile)
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: l.Addr().String(),
+		Server:        true,
+	})
+	require.NoError(t, err)
+
+	dir, err := os.MkdirTemp("", "http-test")
+	require.NoError(t, err)
+	clog, err = log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+
+	srv, err := NewMux(l, serverTLSConfig, &Config{
+		CommitLog:  clog,
+		Authorizer: auth.New(config.ACLModelFile, config.ACLPolicyFile),
+	})
+	require.NoError(t, err)
+	go func() {
+		srv.Serve()
+	}()
+
+	return root, nobody, clog, func() {
+		srv.Close()
+		clog.Remove()
+	}
+}
+
+type httpClient struct {
+	t      *testing.T
+	base   string
+	tls    *tls.Config
+	client *http.Client
+}
+
+// do 메서드는 요청을 보내고 응답의 상태 코드와 본문을 리턴한다.
+func (c *httpClient) do(method, path, body string) (int, []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	require.NoError(c.t, err)
+	res, err := c.client.Do(req)
+	require.NoError(c.t, err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	require.NoError(c.t, err)
+	return res.StatusCode, b
+}
+
+// call 메서드는 요청을 보내고 200 OK 응답의 본문을 m으로 읽는다.
+func (c *httpClient) call(method, path, body string, m proto.Message) {
+	c.t.Helper()
+	code, b := c.do(method, path, body)
+	require.Equal(c.t, http.StatusOK, code, string(b))
+	require.NoError(c.t, protojson.Unmarshal(b, m))
+}
+
+// produce 메서드는 값을 레코드로 추가하고 오프셋을 리턴한다.
+func (c *httpClient) produce(value string) uint64 {
+	c.t.Helper()
+	body, err := protojson.Marshal(&api.ProduceRequest{Record: &api.Record{Value: []byte(value)}})
+	require.NoError(c.t, err)
+	res := &api.ProduceResponse{}
+	c.call(http.MethodPost, "/v1/records", string(body), res)
+	return res.Offset
+}
+
+// errorBody는 에러 응답의 본문(google.rpc.Status)이다.
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *httpClient) expectError(method, path, body string, want int) errorBody {
+	c.t.Helper()
+	code, b := c.do(method, path, body)
+	require.Equal(c.t, want, code, string(b))
+	var e errorBody
+	require.NoError(c.t, json.Unmarshal(b, &e))
+	return e
+}
+
+func testHTTPProduceConsume(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	for i := 0; i < 2; i++ {
+		require.Equal(t, uint64(i), root.produce(fmt.Sprintf("hello %d", i)))
+	}
+	res := &api.ConsumeResponse{}
+	root.call(http.MethodGet, "/v1/records/1", "", res)
+	require.Equal(t, uint64(1), res.Record.Offset)
+	require.Equal(t, []byte("hello 1"), res.Record.Value)
+
+	// 본문은 .proto의 필드 이름을 쓰고 bytes는 base64이다.
+	code, b := root.do(http.MethodPost, "/v1/records", `{"record": {"value": "aGVsbG8=", "producer_id": "0"}}`)
+	require.Equal(t, http.StatusOK, code, string(b))
+	require.JSONEq(t, `{"offset": "2", "partition": 0}`, string(b))
+}
+
+func testHTTPConsumeRange(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	for i := 0; i < 5; i++ {
+		root.produce(fmt.Sprintf("hello %d", i))
+	}
+	res := &api.ConsumeBatchResponse{}
+	root.call(http.MethodGet, "/v1/records?offset=1&max_records=3", "", res)
+	require.Len(t, res.Records, 3)
+	for i, record := range res.Records {
+		require.Equal(t, uint64(i+1), record.Offset)
+	}
+
+	res = &api.ConsumeBatchResponse{}
+	root.call(http.MethodGet, "/v1/records?offset=3", "", res)
+	require.Len(t, res.Records, 2)
+}
+
+func testHTTPOutOfRange(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	root.produce("hello")
+	e := root.expectError(http.MethodGet, "/v1/records/1", "", http.StatusNotFound)
+	require.Equal(t, "offset out of range: 1", e.Message)
+	root.expectError(http.MethodGet, "/v1/records?offset=1", "", http.StatusRequestedRangeNotSatisfiable)
+	root.expectError(http.MethodGet, "/v1/records?topic=missing", "", http.StatusNotImplemented)
+}
+
+func testHTTPBadRequest(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	root.expectError(http.MethodPost, "/v1/records", "not json", http.StatusBadRequest)
+	root.expectError(http.MethodPost, "/v1/records", "{}", http.StatusBadRequest)
+	root.expectError(http.MethodGet, "/v1/records?offset=-1", "", http.StatusBadRequest)
+	root.expectError(http.MethodGet, "/v1/records?isolation_level=SERIALIZABLE", "", http.StatusBadRequest)
+	root.expectError(http.MethodGet, "/v1/records/99999999999999999999", "", http.StatusBadRequest)
+}
+
+func testHTTPUnauthorized(t *testing.T, _, nobody *httpClient, _ *log.Log) {
+	body := `{"record": {"value": "aGVsbG8="}}`
+	nobody.expectError(http.MethodPost, "/v1/records", body, http.StatusForbidden)
+	nobody.expectError(http.MethodGet, "/v1/records/0", "", http.StatusForbidden)
+	nobody.expectError(http.MethodGet, "/v1/records?offset=0", "", http.StatusForbidden)
+}
+
+func testHTTPReadCommitted(t *testing.T, root, _ *httpClient, clog *log.Log) {
+	root.produce("before")
+	_, err := clog.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_BEGIN})
+	require.NoError(t, err)
+	_, err = clog.Append(&api.Record{Value: []byte("aborted"), TxnId: 1})
+	require.NoError(t, err)
+	_, err = clog.Append(&api.Record{TxnId: 1, Control: api.ControlType_CONTROL_ABORT})
+	require.NoError(t, err)
+	root.produce("after")
+
+	res := &api.ConsumeBatchResponse{}
+	root.call(http.MethodGet, "/v1/records?isolation_level=READ_COMMITTED", "", res)
+	require.Len(t, res.Records, 2)
+	require.Equal(t, []byte("before"), res.Records[0].Value)
+	require.Equal(t, []byte("after"), res.Records[1].Value)
+}
+
+func testHTTPErrorDetails(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	code, b := root.do(http.MethodGet, "/v1/records/3", "")
+	require.Equal(t, http.StatusNotFound, code, string(b))
+	st := &spb.Status{}
+	require.NoError(t, protojson.Unmarshal(b, st))
+	require.Len(t, st.Details, 1)
+	d := &errdetails.LocalizedMessage{}
+	require.NoError(t, st.Details[0].UnmarshalTo(d))
+	require.Equal(t, "en-US", d.Locale)
+	require.Equal(t, "The requested offset is outside the log's range: 3", d.Message)
+}
+
+func testHTTPOpenAPI(t *testing.T, _, nobody *httpClient, _ *log.Log) {
+	// API의 설명이므로 권한이 없는 클라이언트도 받을 수 있다.
+	code, b := nobody.do(http.MethodGet, "/openapi.json", "")
+	require.Equal(t, http.StatusOK, code)
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(b, &doc))
+	require.Equal(t, "Log_Produce", doc.Paths["/v1/records"]["post"].OperationID)
+	require.Equal(t, "Log_ConsumeBatch", doc.Paths["/v1/records"]["get"].OperationID)
+	require.Equal(t, "Log_Consume", doc.Paths["/v1/records/{offset}"]["get"].OperationID)
+}
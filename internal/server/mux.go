@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+Mux는 포트 하나로 gRPC와 JSON/HTTP 게이트웨이를 함께 서비스한다. 연결이 보내는 첫 요청을 보고(cmux) 나눈다.
+content-type이 application/grpc인 HTTP/2 요청으로 시작하는 연결은 gRPC 서버로, 나머지 연결(HTTP/1.1, HTTP/2)은 HTTP 서버로 보낸다.
+
+TLS를 쓰면 gRPC와 HTTP 모두 TLS로 시작하므로 TLS 핸드셰이크만으로는 나눌 수 없다. 그래서 리스너에서 TLS를 먼저 풀고(tls.NewListener)
+평문으로 요청을 확인한다. 두 서버는 TLS를 직접 하지 않으므로 클라이언트 인증서는 이미 맺은 TLS 연결에서 꺼낸다.
+
+  - gRPC 서버는 tlsConnCredentials로 핸드셰이크를 건너뛰고 연결의 TLS 상태를 peer.AuthInfo로 넘긴다. 그래서 authenticate 인터셉터가 그대로 동작한다.
+  - HTTP 서버는 연결의 TLS 상태를 요청의 r.TLS에 다시 넣는다(restoreTLS). HTTP/2 요청은 TLS를 푼 평문 위의 HTTP/2이므로 h2c로 받는다.
+
+TLS의 ALPN은 h2와 http/1.1을 모두 알린다. gRPC 클라이언트는 h2를 요구하고, HTTP 클라이언트는 둘 중 하나를 고른다.
+*/
+type Mux struct {
+	GRPC *grpc.Server
+	HTTP *http.Server
+
+	ln    net.Listener
+	cmux  cmux.CMux
+	grpcL net.Listener
+	httpL net.Listener
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// muxReadTimeout은 새 연결이 TLS 핸드셰이크를 마치고 첫 요청을 보내기까지 기다리는 최대 시간이다.
+const muxReadTimeout = 10 * time.Second
+
+/*
+NewMux 함수는 ln으로 config의 로그를 gRPC와 JSON/HTTP로 서비스하는 Mux를 만든다. tlsConfig가 nil이면 TLS를 쓰지 않는다.
+opts는 gRPC 서버의 옵션이다. TLS는 Mux가 하므로 opts에 grpc.Creds를 넣으면 안 된다.
+*/
+func NewMux(ln net.Listener, tlsConfig *tls.Config, config *Config, opts ...grpc.ServerOption) (*Mux, error) {
+	if tlsConfig != nil {
+		creds := credentials.NewTLS(tlsConfig)
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		ln = tls.NewListener(ln, tlsConfig)
+		opts = append(opts, grpc.Creds(tlsConnCredentials{creds}))
+	}
+	gsrv, err := NewGRPCServer(config, opts...)
+	if err != nil {
+		return nil, err
+	}
+	hsrv, err := NewHTTPServer(ln.Addr().String(), config)
+	if err != nil {
+		return nil, err
+	}
+	hsrv.Handler = h2c.NewHandler(restoreTLS(hsrv.Handler), &http2.Server{})
+	hsrv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if tc, ok := tlsConn(c); ok {
+			ctx = context.WithValue(ctx, tlsConnContextKey{}, tc)
+		}
+		return ctx
+	}
+
+	m := cmux.New(ln)
+	m.SetReadTimeout(muxReadTimeout)
+	return &Mux{
+		GRPC: gsrv,
+		HTTP: hsrv,
+		ln:   ln,
+		cmux: m,
+		// 순서대로 확인하므로 gRPC를 먼저 확인한다. grpc-go 클라이언트는 서버의 SETTINGS 프레임을 받은 후에 요청을 보낸다.
+		grpcL: m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc")),
+		httpL: m.Match(cmux.Any()),
+	}, nil
+}
+
+// Addr 메서드는 Mux가 받는 주소를 리턴한다.
+func (m *Mux) Addr() net.Addr {
+	return m.ln.Addr()
+}
+
+// Serve 메서드는 연결을 받아서 서비스한다. Shutdown이나 Close로 멈추면 nil을 리턴한다.
+func (m *Mux) Serve() error {
+	go m.GRPC.Serve(m.grpcL)
+	go m.HTTP.Serve(m.httpL)
+	err := m.cmux.Serve()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown 메서드는 새 연결을 받지 않고, 처리 중인 요청과 스트림이 끝나기를 기다린다.
+// ctx가 끝날 때까지 끝나지 않으면 연결을 강제로 끊고 ctx의 에러를 리턴한다.
+func (m *Mux) Shutdown(ctx context.Context) error {
+	m.stopListening()
+	stopped := make(chan struct{})
+	go func() {
+		m.GRPC.GracefulStop()
+		close(stopped)
+	}()
+	err := m.HTTP.Shutdown(ctx)
+	if err != nil {
+		m.HTTP.Close()
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		m.GRPC.Stop()
+		<-stopped
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Close 메서드는 기다리지 않고 모든 연결을 끊는다.
+func (m *Mux) Close() error {
+	m.stopListening()
+	m.GRPC.Stop()
+	return m.HTTP.Close()
+}
+
+func (m *Mux) stopListening() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.ln.Close()
+	m.cmux.Close()
+}
+
+// tlsConn 함수는 cmux가 감싼 연결에서 TLS 연결을 꺼낸다.
+func tlsConn(c net.Conn) (*tls.Conn, bool) {
+	if mc, ok := c.(*cmux.MuxConn); ok {
+		c = mc.Conn
+	}
+	tc, ok := c.(*tls.Conn)
+	return tc, ok
+}
+
+type tlsConnContextKey struct{}
+
+// restoreTLS 함수는 TLS를 풀어낸 연결로 받은 요청에 연결의 TLS 상태(r.TLS)를 넣는 미들웨어이다.
+func restoreTLS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tc, ok := r.Context().Value(tlsConnContextKey{}).(*tls.Conn); ok && r.TLS == nil {
+			state := tc.ConnectionState()
+			r.TLS = &state
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tlsConnCredentials는 리스너가 이미 TLS 핸드셰이크를 마친 연결을 받는 gRPC 서버의 TransportCredentials이다.
+// 핸드셰이크를 다시 하지 않고 연결의 TLS 상태를 AuthInfo로 리턴한다. 나머지 메서드는 TLS 자격 증명의 것을 그대로 쓴다.
+type tlsConnCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (tlsConnCredentials) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tc, ok := tlsConn(c)
+	if !ok {
+		return nil, nil, errors.New("mux: connection is not a TLS connection")
+	}
+	return c, credentials.TLSInfo{
+		State:          tc.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (c tlsConnCredentials) Clone() credentials.TransportCredentials {
+	return tlsConnCredentials{c.TransportCredentials.Clone()}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// gRPC 클라이언트와 HTTP/1.1, HTTP/2 클라이언트가 같은 포트로 같은 로그를 사용한다.
+func TestMuxServesGRPCAndHTTP(t *testing.T) {
+	root, _, _, teardown := setupHTTPTest(t)
+	defer teardown()
+
+	cc, err := grpc.NewClient(
+		strings.TrimPrefix(root.base, "https://"),
+		grpc.WithTransportCredentials(credentials.NewTLS(root.tls)),
+	)
+	require.NoError(t, err)
+	defer cc.Close()
+	client := api.NewLogClient(cc)
+	ctx := context.Background()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("grpc")}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produce.Offset)
+
+	require.Equal(t, uint64(1), root.produce("http"))
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, []byte("http"), consume.Record.Value)
+
+	h2 := &http.Client{Transport: &http.Transport{TLSClientConfig: root.tls.Clone(), ForceAttemptHTTP2: true}}
+	res, err := h2.Get(root.base + "/v1/records/0")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, 2, res.ProtoMajor)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	record := &api.ConsumeResponse{}
+	require.NoError(t, protojson.Unmarshal(b, record))
+	require.Equal(t, []byte("grpc"), record.Record.Value)
+}
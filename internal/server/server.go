@@ -2,8 +2,12 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
 
 	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/group"
 	"google.golang.org/grpc"
 
 	"google.golang.org/grpc/codes"
@@ -27,14 +31,64 @@ srv, err := newgrpcServer(config)
 */
 type CommitLog interface {
 	Append(*api.Record) (uint64, error)
+	AppendBatch([]*api.Record) (uint64, error)
 	Read(uint64) (*api.Record, error)
+	ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error)
+	OffsetForTime(time.Time) (uint64, error)
+	// Wait 메서드는 오프셋의 레코드를 읽을 수 있을 때까지 기다린다. 스트림과 롱 폴링에서 사용한다.
+	Wait(ctx context.Context, off uint64) error
+}
+
+/*
+PartitionedCommitLog는 N개의 파티션으로 나눈 로그이다. 오프셋은 파티션마다 따로 매기므로 모든 메서드가 파티션 번호를 받는다.
+log.PartitionedLog가 구현한다. 파티션을 모르는 CommitLog는 0번 파티션 하나뿐인 로그로 다룬다(singlePartition).
+
+Route 메서드는 생산 요청의 레코드를 추가할 파티션을 고른다. 같은 키의 레코드는 같은 파티션으로 가므로 키 안에서는 순서가 지켜진다.
+*/
+type PartitionedCommitLog interface {
+	CommitLog
+	Partitions() uint32
+	Route(*api.Record) uint32
+	AppendPartition(p uint32, record *api.Record) (uint64, error)
+	AppendBatchPartition(p uint32, records []*api.Record) (uint64, error)
+	ReadPartition(p uint32, offset uint64) (*api.Record, error)
+	ReadRangePartition(p uint32, from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error)
+	OffsetForTimePartition(p uint32, t time.Time) (uint64, error)
+	WaitPartition(ctx context.Context, p uint32, off uint64) error
 }
 
 type Config struct {
 	CommitLog  CommitLog
 	Authorizer Authorizer // 권한에 사용할 필드
+	// MaxConsumeWait는 Consume, ConsumeBatch 요청의 오프셋에 아직 레코드가 없을 때 새 레코드를 기다리는 최대 시간이다(롱 폴링).
+	// 0이면 기다리지 않고 바로 범위를 벗어났다는 에러를 회신한다.
+	MaxConsumeWait time.Duration
+	// Shutdown 채널이 닫히면 새 레코드를 기다리던 ConsumeStream은 스트림을 끝낸다.
+	// 서버를 GracefulStop으로 멈출 때 로그의 끝까지 보낸 스트림들이 끝나도록 해서 GracefulStop이 리턴할 수 있게 한다.
+	Shutdown <-chan struct{}
+	// GetServerer는 클러스터의 서버 목록을 알려준다. GetServers 요청에서 사용한다. 클러스터가 아니라면 비워둔다.
+	GetServerer GetServerer
+	// Topics는 이름을 가진 토픽들의 로그를 관리한다. 요청의 topic이 비어있다면 CommitLog를 사용한다.
+	// 비워두면 토픽을 사용할 수 없다.
+	Topics TopicManager
+	// Offsets는 컨슈머 그룹이 커밋한 오프셋을 저장한다. 비워두면 컨슈머 그룹을 사용할 수 없다.
+	Offsets OffsetStore
+	// Groups는 컨슈머 그룹의 멤버십을 관리하고 파티션을 할당한다. 비워두면 JoinGroup 등을 사용할 수 없고,
+	// 오프셋 커밋은 멤버십을 확인하지 않는다.
+	Groups GroupCoordinator
+	// TailBuffer는 HTTP로 로그를 따라가는(SSE, WebSocket) 연결마다 쌓아둘 수 있는 레코드의 수이다.
+	// 클라이언트가 느려서 버퍼가 차면 연결을 끊는다. 0이면 256개이다.
+	TailBuffer int
 }
 
+// ConsumeBatch 요청에서 개수나 크기를 정하지 않았을 때 사용하는 기본값과 최댓값
+const (
+	defaultBatchRecords = 100
+	maxBatchRecords     = 10000
+	defaultBatchBytes   = 1 << 20
+	maxBatchBytes       = 16 << 20
+)
+
 // 권한에 사용할 상수들. 이 상수들은 ACL 정책 테이블의 값과 매칭된다. 여러번 참조하기 때문에 상수로 정의했다.
 const (
 	objextWildcard = "*"
@@ -42,11 +96,43 @@ const (
 	consumeAction  = "consume"
 )
 
+// groupObject 함수는 컨슈머 그룹의 ACL 대상을 리턴한다. 정책에서 "group/orders-*"처럼 그룹 이름의 접두사로 권한을 줄 수 있다.
+func groupObject(group string) string {
+	return "group/" + group
+}
+
 // Config의 Authorizer필드는 인터페이스다.
 type Authorizer interface {
 	Authorize(subject, object, action string) error
 }
 
+// TopicManager는 토픽들을 만들고 지우며, 토픽의 로그를 리턴한다. log.TopicManager를 감싸서 구현한다.
+type TopicManager interface {
+	Topic(name string) (CommitLog, error)
+	CreateTopic(*api.Topic) error
+	DeleteTopic(name string) error
+	ListTopics() ([]*api.Topic, error)
+}
+
+// OffsetStore는 컨슈머 그룹이 토픽의 파티션마다 커밋한 오프셋을 저장한다. log.OffsetStore가 구현한다.
+type OffsetStore interface {
+	CommitOffset(group, topic string, partition uint32, offset uint64) error
+	FetchCommittedOffset(group, topic string, partition uint32) (uint64, error)
+}
+
+// GroupCoordinator는 컨슈머 그룹의 멤버들에게 파티션을 할당하고, 오프셋 커밋이 현재 세대의 것인지 확인한다. group.Coordinator가 구현한다.
+type GroupCoordinator interface {
+	Join(group.JoinRequest) (group.Assignment, error)
+	Heartbeat(groupID, memberID string) (group.Assignment, error)
+	Leave(groupID, memberID string) error
+	ValidateCommit(groupID, memberID string, generation uint64) error
+}
+
+// GetServerer는 클러스터의 서버 목록을 알려준다. Raft로 복제하는 log.DistributedLog가 구현한다.
+type GetServerer interface {
+	GetServers() ([]*api.Server, error)
+}
+
 var _ api.LogServer = (*grpcServer)(nil)
 
 type grpcServer struct {
@@ -108,11 +194,66 @@ func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api
 		return nil, err
 	}
 
-	offset, err := s.CommitLog.Append(req.Record)
+	plog, err := s.commitLog(txnTopic(req.Topic, req.Txn))
+	if err != nil {
+		return nil, err
+	}
+	if req.Record == nil {
+		return nil, status.Error(codes.InvalidArgument, "no record")
+	}
+	if err = checkControl(req.Record); err != nil {
+		return nil, err
+	}
+	req.Record.ProducerId, req.Record.Sequence = req.ProducerId, req.Sequence
+	req.Record.TxnId = req.Txn.GetId()
+	p := plog.Route(req.Record)
+	if req.Txn != nil {
+		p = req.Txn.Partition
+	}
+	offset, err := plog.AppendPartition(p, req.Record)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ProduceResponse{Offset: offset, Partition: p}, nil
+}
+
+// ProduceBatch 메서드는 여러 레코드를 한 번에 로그에 추가하고 첫 번째와 마지막 레코드의 오프셋을 회신한다.
+// 배치의 오프셋이 연속하도록 배치 전체를 첫 번째 레코드로 고른 한 파티션에 추가한다.
+func (s *grpcServer) ProduceBatch(ctx context.Context, req *api.ProduceBatchRequest) (*api.ProduceBatchResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return nil, err
+	}
+	if len(req.Records) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no records in batch")
+	}
+
+	plog, err := s.commitLog(txnTopic(req.Topic, req.Txn))
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range req.Records {
+		if err = checkControl(record); err != nil {
+			return nil, err
+		}
+		record.ProducerId, record.Sequence = req.ProducerId, 0
+		if req.ProducerId != 0 {
+			record.Sequence = req.FirstSequence + uint64(i)
+		}
+		record.TxnId = req.Txn.GetId()
+	}
+	p := plog.Route(req.Records[0])
+	if req.Txn != nil {
+		p = req.Txn.Partition
+	}
+	first, err := plog.AppendBatchPartition(p, req.Records)
 	if err != nil {
 		return nil, err
 	}
-	return &api.ProduceResponse{Offset: offset}, nil
+	return &api.ProduceBatchResponse{
+		FirstOffset: first,
+		LastOffset:  first + uint64(len(req.Records)) - 1,
+		Partition:   p,
+	}, nil
 }
 
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
@@ -121,8 +262,19 @@ func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api
 	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
 		return nil, err
 	}
+	clog, err := s.consumeLog(req.Topic, req.Partition, req.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
 
-	record, err := s.CommitLog.Read(req.Offset)
+	offset, err := s.startOffset(ctx, clog, req)
+	if err != nil {
+		return nil, err
+	}
+	record, err := clog.Read(offset)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok && s.longPoll(ctx, clog, offset) {
+		record, err = clog.Read(offset)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +282,123 @@ func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api
 	return &api.ConsumeResponse{Record: record}, nil
 }
 
+/*
+startOffset 메서드는 Consume, ConsumeStream 요청을 시작할 오프셋을 정한다.
+그룹을 지정했고 그룹이 커밋한 오프셋이 있다면 그 오프셋이고, 없다면 start_time으로 찾은 오프셋이나 요청의 offset이다.
+*/
+func (s *grpcServer) startOffset(ctx context.Context, clog CommitLog, req *api.ConsumeRequest) (uint64, error) {
+	if req.Group != "" {
+		offsets, err := s.offsets(ctx, req.Group)
+		if err != nil {
+			return 0, err
+		}
+		offset, err := offsets.FetchCommittedOffset(req.Group, req.Topic, req.Partition)
+		if _, ok := err.(api.ErrNoCommittedOffset); !ok {
+			return offset, err
+		}
+	}
+	if req.StartTime != nil {
+		return clog.OffsetForTime(req.StartTime.AsTime())
+	}
+	return req.Offset, nil
+}
+
+/*
+longPoll 메서드는 offset의 레코드가 추가될 때까지 최대 MaxConsumeWait만큼 기다리고, 기다리는 동안 레코드가 추가되었다면 true를 리턴한다.
+시간이 다 되거나 요청이 취소되었다면 false를 리턴하므로 처음 받은 범위를 벗어났다는 에러를 그대로 회신한다.
+*/
+func (s *grpcServer) longPoll(ctx context.Context, clog CommitLog, offset uint64) bool {
+	if s.MaxConsumeWait <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.MaxConsumeWait)
+	defer cancel()
+	return clog.Wait(ctx, offset) == nil
+}
+
+// ConsumeBatch 메서드는 요청한 오프셋부터 이어지는 레코드들을 한 번에 회신한다.
+func (s *grpcServer) ConsumeBatch(ctx context.Context, req *api.ConsumeBatchRequest) (*api.ConsumeBatchResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	clog, err := s.consumeLog(req.Topic, req.Partition, req.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := req.Offset
+	if req.StartTime != nil {
+		if offset, err = clog.OffsetForTime(req.StartTime.AsTime()); err != nil {
+			return nil, err
+		}
+	}
+	maxRecords := int(req.MaxRecords)
+	if maxRecords == 0 {
+		maxRecords = defaultBatchRecords
+	} else if maxRecords > maxBatchRecords {
+		maxRecords = maxBatchRecords
+	}
+	maxBytes := req.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultBatchBytes
+	} else if maxBytes > maxBatchBytes {
+		maxBytes = maxBatchBytes
+	}
+	records, err := clog.ReadRange(offset, maxRecords, maxBytes)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok && s.longPoll(ctx, clog, offset) {
+		records, err = clog.ReadRange(offset, maxRecords, maxBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.ConsumeBatchResponse{Records: records}, nil
+}
+
+// OffsetForTime 메서드는 요청한 시각 이후에 추가된 첫 번째 레코드의 오프셋을 회신한다. 소비 권한이 필요하다.
+func (s *grpcServer) OffsetForTime(ctx context.Context, req *api.OffsetForTimeRequest) (*api.OffsetForTimeResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+
+	clog, err := s.partition(req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := clog.OffsetForTime(req.Time.AsTime())
+	if err != nil {
+		return nil, err
+	}
+	return &api.OffsetForTimeResponse{Offset: offset}, nil
+}
+
+/*
+InitProducer 메서드는 멱등 생산에 사용할 새 프로듀서 ID를 회신한다. ID는 임의의 64비트 수이므로 서버를 다시 시작하거나
+클러스터의 다른 서버에서 받더라도 겹칠 걱정이 없다. 생산 권한이 필요하다.
+*/
+func (s *grpcServer) InitProducer(ctx context.Context, req *api.InitProducerRequest) (*api.InitProducerResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return nil, err
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	return &api.InitProducerResponse{ProducerId: id}, nil
+}
+
+// randomID 함수는 0이 아닌 임의의 64비트 ID를 리턴한다. 프로듀서 ID와 트랜잭션 ID에서 0은 사용하지 않는다는 뜻이다.
+func randomID() (uint64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id, nil
+		}
+	}
+}
+
 // 스트리밍 API
 
 // ProduceStream 메서드는 양방향 스트리밍 RPC이다. 클라이언트는 서버의 로그로 데이터를 스트리밍할 수 있고,
@@ -153,27 +422,395 @@ func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 }
 
 // 서버측 스트리밍 RPC이다. 클라이언트가 로그의 어느 위치의 레코드를 읽고 싶은지 밝히면, 서버는 그 위치부터 이어지는 모든 레코드를 스트리밍한다.
-// 나아가 서버가 로그 끝까지 스트리밍하면 레코드의 변화가 생길 때마다 클라이언트에 스트리밍한다.
+// 파티션으로 나눈 로그라면 요청한 파티션 하나만 따라간다. 모든 파티션을 읽으려면 파티션마다 스트림을 연다.
+// 나아가 서버가 로그 끝까지 스트리밍하면 새 레코드가 추가될 때까지 기다렸다가(CommitLog.Wait) 클라이언트에 스트리밍한다.
+// start_time을 지정했다면 처음 한 번만 시각으로 오프셋을 찾고, 그 다음부터는 오프셋으로 이어서 읽는다.
 func (s *grpcServer) ConsumeStream(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	if s.Shutdown != nil {
+		go func() {
+			select {
+			case <-s.Shutdown:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return err
+	}
+	clog, err := s.consumeLog(req.Topic, req.Partition, req.IsolationLevel)
+	if err != nil {
+		return err
+	}
+	offset, err := s.startOffset(ctx, clog, req)
+	if err != nil {
+		return err
+	}
+	waited := false
 	for {
-		select {
-		case <-stream.Context().Done():
-			return nil
-		default:
-			res, err := s.Consume(stream.Context(), req)
-			switch err.(type) {
-			case nil:
-			case api.ErrOffsetOutOfRange:
-				continue
-			default:
+		record, err := clog.Read(offset)
+		switch err.(type) {
+		case nil:
+		case api.ErrOffsetOutOfRange:
+			// 기다린 후에도 읽을 수 없다면 보존 정책 등으로 지워진 오프셋이다.
+			if waited {
 				return err
 			}
-			if err = stream.Send(res); err != nil {
+			if err = clog.Wait(ctx, offset); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 				return err
 			}
-			req.Offset++
+			waited = true
+			continue
+		default:
+			return err
+		}
+		waited = false
+		if err = stream.Send(&api.ConsumeResponse{Record: record}); err != nil {
+			return err
+		}
+		// 압축한 로그는 오프셋 사이에 빈 곳이 있으므로 받은 레코드의 다음 오프셋부터 이어서 읽는다.
+		offset = record.Offset + 1
+	}
+}
+
+// commitLog 메서드는 요청의 토픽에 해당하는 로그를 리턴한다. 토픽이 비어있다면 기본 로그(CommitLog)이다.
+// 파티션을 모르는 로그는 파티션이 하나인 로그로 감싼다.
+func (s *grpcServer) commitLog(topic string) (PartitionedCommitLog, error) {
+	clog := s.CommitLog
+	if topic != "" {
+		if s.Topics == nil {
+			return nil, status.Error(codes.Unimplemented, "server has no topics")
 		}
+		var err error
+		if clog, err = s.Topics.Topic(topic); err != nil {
+			return nil, err
+		}
+	}
+	if plog, ok := clog.(PartitionedCommitLog); ok {
+		return plog, nil
+	}
+	return singlePartition{clog}, nil
+}
+
+// partition 메서드는 소비 요청의 토픽과 파티션에 해당하는 로그를 리턴한다. 소비 핸들러들은 이 로그를 파티션이 없는 CommitLog처럼 읽는다.
+func (s *grpcServer) partition(topic string, p uint32) (partition, error) {
+	plog, err := s.commitLog(topic)
+	if err != nil {
+		return partition{}, err
+	}
+	if p >= plog.Partitions() {
+		return partition{}, api.ErrPartitionNotFound{Partition: p}
+	}
+	return partition{plog, p}, nil
+}
+
+// partition은 PartitionedCommitLog의 한 파티션을 CommitLog로 다룬다.
+type partition struct {
+	log PartitionedCommitLog
+	p   uint32
+}
+
+func (l partition) Append(record *api.Record) (uint64, error) {
+	return l.log.AppendPartition(l.p, record)
+}
+
+func (l partition) AppendBatch(records []*api.Record) (uint64, error) {
+	return l.log.AppendBatchPartition(l.p, records)
+}
+
+func (l partition) Read(offset uint64) (*api.Record, error) {
+	return l.log.ReadPartition(l.p, offset)
+}
+
+func (l partition) ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	return l.log.ReadRangePartition(l.p, from, maxRecords, maxBytes)
+}
+
+func (l partition) OffsetForTime(t time.Time) (uint64, error) {
+	return l.log.OffsetForTimePartition(l.p, t)
+}
+
+func (l partition) Wait(ctx context.Context, off uint64) error {
+	return l.log.WaitPartition(ctx, l.p, off)
+}
+
+// singlePartition은 파티션을 모르는 CommitLog를 0번 파티션 하나뿐인 PartitionedCommitLog로 다룬다.
+type singlePartition struct {
+	CommitLog
+}
+
+func (l singlePartition) Partitions() uint32 { return 1 }
+
+func (l singlePartition) Route(*api.Record) uint32 { return 0 }
+
+func (l singlePartition) AppendPartition(p uint32, record *api.Record) (uint64, error) {
+	if p != 0 {
+		return 0, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.Append(record)
+}
+
+func (l singlePartition) AppendBatchPartition(p uint32, records []*api.Record) (uint64, error) {
+	if p != 0 {
+		return 0, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.AppendBatch(records)
+}
+
+func (l singlePartition) ReadPartition(p uint32, offset uint64) (*api.Record, error) {
+	if p != 0 {
+		return nil, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.Read(offset)
+}
+
+func (l singlePartition) ReadRangePartition(p uint32, from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	if p != 0 {
+		return nil, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.ReadRange(from, maxRecords, maxBytes)
+}
+
+func (l singlePartition) OffsetForTimePartition(p uint32, t time.Time) (uint64, error) {
+	if p != 0 {
+		return 0, api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.OffsetForTime(t)
+}
+
+func (l singlePartition) WaitPartition(ctx context.Context, p uint32, off uint64) error {
+	if p != 0 {
+		return api.ErrPartitionNotFound{Partition: p}
+	}
+	return l.Wait(ctx, off)
+}
+
+// topics 메서드는 토픽을 관리하는 요청에서 사용할 TopicManager를 리턴한다.
+func (s *grpcServer) topics() (TopicManager, error) {
+	if s.Topics == nil {
+		return nil, status.Error(codes.Unimplemented, "server has no topics")
+	}
+	return s.Topics, nil
+}
+
+/*
+CreateTopic, DeleteTopic 메서드는 토픽을 만들고 지운다. 토픽을 만들고 지우는 것은 로그에 쓰는 것이므로 생산 권한이 필요하다.
+ListTopics 메서드는 토픽들의 목록과 설정을 회신하며 소비 권한이 필요하다.
+*/
+func (s *grpcServer) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return nil, err
+	}
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	if req.Topic == nil {
+		return nil, status.Error(codes.InvalidArgument, "no topic")
+	}
+	if err = topics.CreateTopic(req.Topic); err != nil {
+		return nil, err
+	}
+	return &api.CreateTopicResponse{Topic: req.Topic}, nil
+}
+
+func (s *grpcServer) DeleteTopic(ctx context.Context, req *api.DeleteTopicRequest) (*api.DeleteTopicResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return nil, err
+	}
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	if err = topics.DeleteTopic(req.Name); err != nil {
+		return nil, err
+	}
+	return &api.DeleteTopicResponse{}, nil
+}
+
+func (s *grpcServer) ListTopics(ctx context.Context, req *api.ListTopicsRequest) (*api.ListTopicsResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	topics, err := s.topics()
+	if err != nil {
+		return nil, err
+	}
+	list, err := topics.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+	return &api.ListTopicsResponse{Topics: list}, nil
+}
+
+// offsets 메서드는 그룹에 대한 소비 권한을 확인하고 컨슈머 그룹의 오프셋을 저장하는 OffsetStore를 리턴한다.
+func (s *grpcServer) offsets(ctx context.Context, groupID string) (OffsetStore, error) {
+	if s.Offsets == nil {
+		return nil, status.Error(codes.Unimplemented, "server has no consumer groups")
+	}
+	if err := s.authorizeGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.Offsets, nil
+}
+
+// groups 메서드는 그룹에 대한 소비 권한을 확인하고 그룹의 멤버십을 관리하는 GroupCoordinator를 리턴한다.
+func (s *grpcServer) groups(ctx context.Context, groupID string) (GroupCoordinator, error) {
+	if s.Groups == nil {
+		return nil, status.Error(codes.Unimplemented, "server has no group coordinator")
+	}
+	if err := s.authorizeGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.Groups, nil
+}
+
+// authorizeGroup 메서드는 요청한 클라이언트가 그룹(group/<그룹>)에 대한 소비 권한이 있는지 확인한다.
+func (s *grpcServer) authorizeGroup(ctx context.Context, groupID string) error {
+	if groupID == "" {
+		return status.Error(codes.InvalidArgument, "no group")
+	}
+	return s.Authorizer.Authorize(subject(ctx), groupObject(groupID), consumeAction)
+}
+
+/*
+CommitOffset 메서드는 그룹이 토픽의 파티션에서 다음에 읽을 오프셋을 서버에 저장한다. FetchCommittedOffset 메서드는 저장한 오프셋을 회신한다.
+둘 다 토픽에 대한 소비 권한과 그룹에 대한 소비 권한(group/<그룹>)이 모두 필요하다.
+GroupCoordinator가 있다면 멤버가 있는 그룹의 커밋은 현재 세대의 멤버가 보낸 것이어야 한다.
+*/
+func (s *grpcServer) CommitOffset(ctx context.Context, req *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	offsets, err := s.offsets(ctx, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	// 없는 토픽이나 파티션의 오프셋은 커밋하지 않는다.
+	if _, err = s.partition(req.Topic, req.Partition); err != nil {
+		return nil, err
+	}
+	if s.Groups != nil {
+		if err = s.Groups.ValidateCommit(req.Group, req.MemberId, req.Generation); err != nil {
+			return nil, err
+		}
+	}
+	if err = offsets.CommitOffset(req.Group, req.Topic, req.Partition, req.Offset); err != nil {
+		return nil, err
+	}
+	return &api.CommitOffsetResponse{}, nil
+}
+
+func (s *grpcServer) FetchCommittedOffset(ctx context.Context, req *api.FetchCommittedOffsetRequest) (*api.FetchCommittedOffsetResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	offsets, err := s.offsets(ctx, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := offsets.FetchCommittedOffset(req.Group, req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchCommittedOffsetResponse{Offset: offset}, nil
+}
+
+/*
+JoinGroup, Heartbeat, LeaveGroup 메서드는 컨슈머 그룹의 멤버십 요청이다. 셋 모두 CommitOffset처럼 토픽에 대한 소비 권한과
+그룹에 대한 소비 권한이 모두 필요하다. 그래서 토픽에 대한 권한을 잃은 멤버는 하트비트로 할당을 받거나 그룹의 세대를 바꿀 수 없다.
+멤버들은 할당받은 파티션만 ConsumeStream으로 소비하고 현재 세대로 오프셋을 커밋한다.
+*/
+func (s *grpcServer) JoinGroup(ctx context.Context, req *api.JoinGroupRequest) (*api.JoinGroupResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	groups, err := s.groups(ctx, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	// 할당 전략은 토픽마다의 파티션 수로 파티션을 나눈다.
+	partitions := make(map[string]uint32, len(req.Topics))
+	for _, topic := range req.Topics {
+		plog, err := s.commitLog(topic)
+		if err != nil {
+			return nil, err
+		}
+		partitions[topic] = plog.Partitions()
+	}
+	a, err := groups.Join(group.JoinRequest{
+		Group:          req.Group,
+		MemberID:       req.MemberId,
+		Strategy:       req.Strategy,
+		SessionTimeout: time.Duration(req.SessionTimeoutMs) * time.Millisecond,
+		Partitions:     partitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.JoinGroupResponse{
+		MemberId:    a.MemberID,
+		Generation:  a.Generation,
+		Assignments: a.Partitions,
+	}, nil
+}
+
+func (s *grpcServer) Heartbeat(ctx context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	groups, err := s.groups(ctx, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	a, err := groups.Heartbeat(req.Group, req.MemberId)
+	if err != nil {
+		return nil, err
+	}
+	return &api.HeartbeatResponse{
+		Generation:  a.Generation,
+		Assignments: a.Partitions,
+	}, nil
+}
+
+func (s *grpcServer) LeaveGroup(ctx context.Context, req *api.LeaveGroupRequest) (*api.LeaveGroupResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return nil, err
+	}
+	groups, err := s.groups(ctx, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	if err = groups.Leave(req.Group, req.MemberId); err != nil {
+		return nil, err
+	}
+	return &api.LeaveGroupResponse{}, nil
+}
+
+/*
+GetServers 메서드는 클러스터의 서버 목록과 각 서버가 리더인지를 회신한다. 클라이언트의 리졸버는 이 목록으로 서버들에 연결하고,
+피커는 생산 요청을 리더에게, 소비 요청을 팔로워들에게 보낸다. 서버 목록은 클러스터의 주소들을 알려주므로 생산이나 소비 권한 중
+하나가 있어야 볼 수 있다. 생산만 하는 클라이언트도 리졸버로 리더를 찾아야 하기 때문이다.
+*/
+func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		if err = s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+			return nil, err
+		}
+	}
+	if s.GetServerer == nil {
+		return nil, status.Error(codes.Unimplemented, "server is not part of a cluster")
+	}
+	servers, err := s.GetServerer.GetServers()
+	if err != nil {
+		return nil, err
 	}
+	return &api.GetServersResponse{Servers: servers}, nil
 }
 
 func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
@@ -2,12 +2,18 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	api "github.com/sodami-hub/proglog/api/v1"
 	"github.com/sodami-hub/proglog/internal/auth"
+	"github.com/sodami-hub/proglog/internal/group"
 	"github.com/sodami-hub/proglog/internal/log"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
@@ -19,6 +25,19 @@ import (
 	// 권한이 없는 클라이언트는 거부하는지 확인하는 테스트를 위한 임포트
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// 단일 노드의 Log와 Raft로 복제하는 DistributedLog 모두 서버의 CommitLog로 사용할 수 있다.
+var (
+	_ CommitLog = (*log.Log)(nil)
+	_ CommitLog = (*log.DistributedLog)(nil)
+
+	_ PartitionedCommitLog = (*log.PartitionedLog)(nil)
+
+	_ TxnLog            = (*log.Log)(nil)
+	_ TxnLog            = (*log.DistributedLog)(nil)
+	_ PartitionedTxnLog = (*log.PartitionedLog)(nil)
 )
 
 func TestServ(t *testing.T) {
@@ -33,7 +52,16 @@ func TestServ(t *testing.T) {
 		"produce/consume a message to/from the log succeeds": testProduceConsume,
 		"produce/consume stream succeeds":                    testProduceConsumeStream,
 		"consume past log boundary fails":                    testConsumePastBoundary,
+		"consume from a timestamp succeeds":                  testConsumeFromTime,
+		"produce batch succeeds":                             testProduceBatch,
+		"consume batch succeeds":                             testConsumeBatch,
 		"unauthorized fails":                                 testUnauthorized,
+		"get servers without a cluster fails":                testGetServersUnimplemented,
+		"topics without a topic manager fail":                testTopicsUnimplemented,
+		"unpartitioned log has only partition 0":             testSinglePartition,
+		"groups without an offset store fail":                testGroupsUnimplemented,
+		"idempotent producer deduplicates retries":           testIdempotentProduce,
+		"read committed consumers see committed records":     testTransactions,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			/*client,*/ rootClient, nobodyClient, config, teardown := setupTest(t, nil)
@@ -43,6 +71,183 @@ func TestServ(t *testing.T) {
 	}
 }
 
+// 롱 폴링 테스트는 서버의 MaxConsumeWait를 설정해서 실행한다.
+func TestServLongPoll(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T,
+		rootClient api.LogClient,
+		nobodyClient api.LogClient,
+		config *Config,
+	){
+		"consume waits for a new record":   testConsumeLongPoll,
+		"consume wait times out":           testConsumeLongPollTimeout,
+		"consume stream waits for records": testConsumeStreamWaits,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			rootClient, nobodyClient, config, teardown := setupTest(t, func(c *Config) {
+				c.MaxConsumeWait = 500 * time.Millisecond
+			})
+			defer teardown()
+			fn(t, rootClient, nobodyClient, config)
+		})
+	}
+}
+
+// Shutdown 채널을 닫으면 로그의 끝까지 보낸 ConsumeStream이 끝난다.
+func TestServShutdownEndsStreams(t *testing.T) {
+	shutdown := make(chan struct{})
+	client, _, _, teardown := setupTest(t, func(c *Config) {
+		c.Shutdown = shutdown
+	})
+	defer teardown()
+	ctx := context.Background()
+
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), res.Record.Offset)
+
+	close(shutdown)
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+}
+
+// GetServerer를 설정하면 클러스터의 서버 목록을 회신한다.
+func TestServGetServers(t *testing.T) {
+	servers := []*api.Server{
+		{Id: "0", RpcAddr: "127.0.0.1:8400", IsLeader: true, HighestOffset: 9, ProgressKnown: true},
+		{Id: "1", RpcAddr: "127.0.0.1:8401", HighestOffset: 6, Lag: 3, ProgressKnown: true},
+	}
+	client, nobody, _, teardown := setupTest(t, func(c *Config) {
+		c.GetServerer = getServers(servers)
+	})
+	defer teardown()
+
+	// 권한이 없는 클라이언트는 클러스터의 주소들을 볼 수 없다.
+	_, err := nobody.GetServers(context.Background(), &api.GetServersRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err := client.GetServers(context.Background(), &api.GetServersRequest{})
+	require.NoError(t, err)
+	require.Equal(t, len(servers), len(res.Servers))
+	for i, server := range res.Servers {
+		require.Equal(t, servers[i].Id, server.Id)
+		require.Equal(t, servers[i].RpcAddr, server.RpcAddr)
+		require.Equal(t, servers[i].IsLeader, server.IsLeader)
+		require.Equal(t, servers[i].HighestOffset, server.HighestOffset)
+		require.Equal(t, servers[i].Lag, server.Lag)
+		require.Equal(t, servers[i].ProgressKnown, server.ProgressKnown)
+	}
+}
+
+type getServers []*api.Server
+
+func (s getServers) GetServers() ([]*api.Server, error) {
+	return s, nil
+}
+
+// 토픽 테스트는 log.TopicManager로 토픽들을 관리하는 서버로 실행한다.
+func TestServTopics(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T,
+		rootClient api.LogClient,
+		nobodyClient api.LogClient,
+		config *Config,
+	){
+		"create, list and delete topics":       testTopicAdmin,
+		"topics are independent of each other": testTopicProduceConsume,
+		"unknown topic fails":                  testUnknownTopic,
+		"unauthorized topic admin fails":       testUnauthorizedTopicAdmin,
+		"partitioned topic routes by key":      testPartitionedTopic,
+		"transaction on a topic partition":     testTopicTransaction,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "server-topics-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			topics, err := log.NewTopicManager(dir, log.Config{})
+			require.NoError(t, err)
+			defer topics.Close()
+
+			rootClient, nobodyClient, config, teardown := setupTest(t, func(c *Config) {
+				c.Topics = topicManager{topics}
+			})
+			defer teardown()
+			fn(t, rootClient, nobodyClient, config)
+		})
+	}
+}
+
+// 컨슈머 그룹 테스트는 서버에 log.OffsetStore와 토픽들을 설정해서 실행한다.
+func TestServGroups(t *testing.T) {
+	for scenario, fn := range map[string]func(
+		t *testing.T,
+		rootClient api.LogClient,
+		nobodyClient api.LogClient,
+		config *Config,
+	){
+		"commit and fetch offsets":              testCommitFetchOffset,
+		"consume stream resumes from the group": testConsumeStreamGroup,
+		"commit for an unknown partition fails": testCommitUnknownPartition,
+		"unauthorized group fails":              testUnauthorizedGroup,
+		"members share partitions":              testGroupMembership,
+		"revoked members cannot heartbeat":      testRevokedGroupMember,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "server-groups-test")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			topics, err := log.NewTopicManager(filepath.Join(dir, "topics"), log.Config{})
+			require.NoError(t, err)
+			defer topics.Close()
+			offsets, err := log.NewOffsetStore(filepath.Join(dir, "offsets"), log.Config{})
+			require.NoError(t, err)
+			defer offsets.Close()
+
+			rootClient, nobodyClient, config, teardown := setupTest(t, func(c *Config) {
+				c.Topics = topicManager{topics}
+				c.Offsets = offsets
+				c.Groups = group.New(group.Config{})
+				c.Authorizer = &revocableAuthorizer{Authorizer: c.Authorizer}
+			})
+			defer teardown()
+			fn(t, rootClient, nobodyClient, config)
+		})
+	}
+}
+
+// revocableAuthorizer는 토픽(*)에 대한 소비 권한만 거둘 수 있는 Authorizer이다. 그룹에 대한 권한은 남아있는 클라이언트를 흉내낸다.
+type revocableAuthorizer struct {
+	Authorizer
+	revoked atomic.Bool
+}
+
+func (a *revocableAuthorizer) Authorize(subject, object, action string) error {
+	if a.revoked.Load() && object == objextWildcard && action == consumeAction {
+		return status.Errorf(codes.PermissionDenied, "%s not permitted to %s to %s", subject, action, object)
+	}
+	return a.Authorizer.Authorize(subject, object, action)
+}
+
+// topicManager는 log.TopicManager의 토픽 로그를 CommitLog로 리턴한다.
+type topicManager struct {
+	*log.TopicManager
+}
+
+func (m topicManager) Topic(name string) (CommitLog, error) {
+	l, err := m.TopicManager.Topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
 /*
 setupTest 함수는 각각의 테스트 케이스를 위한 준비를 해주는 도우미 함수이다.
 테스트는 서버를 실행할 컴퓨터의 로컬 네트워크 주소를 가진 리스너부터 만든다.
@@ -390,14 +595,147 @@ func testProduceConsumeStream(t *testing.T, client, _ api.LogClient, config *Con
 		for i, record := range records {
 			res, err := stream.Recv()
 			require.NoError(t, err)
-			require.Equal(t, res.Record, &api.Record{
-				Value:  record.Value,
-				Offset: uint64(i),
-			})
+			require.Equal(t, record.Value, res.Record.Value)
+			require.Equal(t, uint64(i), res.Record.Offset)
+			require.NotNil(t, res.Record.Timestamp)
 		}
 	}
 }
 
+/*
+testConsumeFromTime 테스트는 시각으로 오프셋을 찾고, start_time을 지정한 소비 요청이 그 시각 이후의 레코드부터 읽는지 확인한다.
+*/
+func testProduceBatch(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	records := []*api.Record{
+		{Value: []byte("first message")},
+		{Value: []byte("second message")},
+		{Value: []byte("third message")},
+	}
+	produce, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produce.FirstOffset)
+	require.Equal(t, uint64(2), produce.LastOffset)
+
+	for i, record := range records {
+		consume, err := client.Consume(ctx, &api.ConsumeRequest{
+			Offset: produce.FirstOffset + uint64(i),
+		})
+		require.NoError(t, err)
+		require.Equal(t, record.Value, consume.Record.Value)
+	}
+
+	_, err = client.ProduceBatch(ctx, &api.ProduceBatchRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testConsumeBatch(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	records := []*api.Record{
+		{Value: []byte("first message")},
+		{Value: []byte("second message")},
+		{Value: []byte("third message")},
+	}
+	_, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+	require.NoError(t, err)
+
+	consume, err := client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(consume.Records))
+	for i, record := range consume.Records {
+		require.Equal(t, uint64(i+1), record.Offset)
+		require.Equal(t, records[i+1].Value, record.Value)
+	}
+
+	consume, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 0, MaxRecords: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(consume.Records))
+
+	_, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 3})
+	got := status.Code(err)
+	want := status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
+	require.Equal(t, want, got)
+}
+
+func testConsumeLongPoll(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}()
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), consume.Record.Value)
+}
+
+func testConsumeLongPollTimeout(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	got := status.Code(err)
+	want := status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
+	require.Equal(t, want, got)
+	require.GreaterOrEqual(t, time.Since(start), config.MaxConsumeWait)
+}
+
+func testConsumeStreamWaits(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+
+	// 스트림이 기다리는 중에 추가한 레코드를 받는다.
+	for i := 0; i < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), res.Record.Offset)
+	}
+}
+
+func testConsumeFromTime(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("before")},
+	})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("after")},
+	})
+	require.NoError(t, err)
+
+	res, err := client.OffsetForTime(ctx, &api.OffsetForTimeRequest{
+		Time: timestamppb.New(since),
+	})
+	require.NoError(t, err)
+	require.Equal(t, produce.Offset, res.Offset)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
+		StartTime: timestamppb.New(since),
+	})
+	require.NoError(t, err)
+	consume, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, []byte("after"), consume.Record.Value)
+}
+
 // 권한에 대한 테스트에서는 nobody 클라이언트를 사용한다.
 func testUnauthorized(t *testing.T, _, client api.LogClient, config *Config) {
 	ctx := context.Background()
@@ -424,3 +762,502 @@ func testUnauthorized(t *testing.T, _, client api.LogClient, config *Config) {
 		t.Fatalf("got code : %d, want code : %d", gotCode, wantCode)
 	}
 }
+
+// 클러스터가 아닌 서버는 GetServers를 구현하지 않았다는 에러를 회신한다.
+func testGetServersUnimplemented(t *testing.T, client, _ api.LogClient, config *Config) {
+	_, err := client.GetServers(context.Background(), &api.GetServersRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func testTopicAdmin(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", MaxStoreBytes: 4096},
+	})
+	require.NoError(t, err)
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "audit"},
+	})
+	require.NoError(t, err)
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders"},
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "../escape"},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(list.Topics))
+	require.Equal(t, "audit", list.Topics[0].Name)
+	require.Equal(t, "orders", list.Topics[1].Name)
+	require.Equal(t, uint64(4096), list.Topics[1].MaxStoreBytes)
+
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "audit"})
+	require.NoError(t, err)
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "audit"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	list, err = client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(list.Topics))
+}
+
+// 토픽마다 오프셋이 0부터 시작하고, 토픽이 없는 요청은 기본 로그를 사용한다.
+func testTopicProduceConsume(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	for _, topic := range []string{"a", "b"} {
+		_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Topic: &api.Topic{Name: topic}})
+		require.NoError(t, err)
+	}
+	for _, req := range []*api.ProduceRequest{
+		{Topic: "a", Record: &api.Record{Value: []byte("a0")}},
+		{Topic: "a", Record: &api.Record{Value: []byte("a1")}},
+		{Topic: "b", Record: &api.Record{Value: []byte("b0")}},
+		{Record: &api.Record{Value: []byte("default")}},
+	} {
+		_, err := client.Produce(ctx, req)
+		require.NoError(t, err)
+	}
+
+	for topic, want := range map[string][]string{
+		"a": {"a0", "a1"},
+		"b": {"b0"},
+		"":  {"default"},
+	} {
+		res, err := client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Topic: topic})
+		require.NoError(t, err)
+		var got []string
+		for _, record := range res.Records {
+			got = append(got, string(record.Value))
+		}
+		require.Equal(t, want, got, topic)
+	}
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Topic: "a", Offset: 1})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, []byte("a1"), res.Record.Value)
+}
+
+func testUnknownTopic(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Topic:  "missing",
+		Record: &api.Record{Value: []byte("hello")},
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func testUnauthorizedTopicAdmin(t *testing.T, _, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Topic: &api.Topic{Name: "a"}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "a"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// 토픽을 설정하지 않은 서버는 토픽 요청을 구현하지 않았다는 에러를 회신한다.
+func testTopicsUnimplemented(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Topic:  "a",
+		Record: &api.Record{Value: []byte("hello")},
+	})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// 파티션을 모르는 로그는 0번 파티션 하나뿐이다.
+func testSinglePartition(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Key: []byte("k"), Value: []byte("hello")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), produce.Partition)
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), consume.Record.Value)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Partition: 1})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+/*
+파티션이 세 개인 토픽에 키가 다른 레코드들을 생산한다. 같은 키의 레코드는 같은 파티션에 순서대로 추가되고,
+오프셋은 파티션마다 0부터 시작한다. ConsumeStream은 요청한 파티션의 레코드만 보낸다.
+*/
+func testPartitionedTopic(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 3},
+	})
+	require.NoError(t, err)
+
+	type position struct {
+		partition uint32
+		offset    uint64
+	}
+	partitions := make(map[string]uint32)
+	next := make(map[uint32]uint64)
+	produced := make(map[position]string)
+	for i := 0; i < 5; i++ {
+		for _, key := range []string{"alice", "bob", "carol", "dave"} {
+			value := fmt.Sprintf("%s-%d", key, i)
+			res, err := client.Produce(ctx, &api.ProduceRequest{
+				Topic:  "orders",
+				Record: &api.Record{Key: []byte(key), Value: []byte(value)},
+			})
+			require.NoError(t, err)
+			if p, ok := partitions[key]; ok {
+				require.Equal(t, p, res.Partition, key)
+			}
+			partitions[key] = res.Partition
+			require.Equal(t, next[res.Partition], res.Offset)
+			next[res.Partition]++
+			produced[position{res.Partition, res.Offset}] = value
+		}
+	}
+
+	for p, n := range next {
+		stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Topic: "orders", Partition: p})
+		require.NoError(t, err)
+		for off := uint64(0); off < n; off++ {
+			res, err := stream.Recv()
+			require.NoError(t, err)
+			require.Equal(t, off, res.Record.Offset)
+			require.Equal(t, produced[position{p, off}], string(res.Record.Value))
+		}
+	}
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Partition: 3})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func testCommitFetchOffset(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "g"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{Topic: &api.Topic{Name: "orders", Partitions: 2}})
+	require.NoError(t, err)
+	for _, req := range []*api.CommitOffsetRequest{
+		{Group: "g", Offset: 4},
+		{Group: "g", Topic: "orders", Partition: 1, Offset: 2},
+		{Group: "h", Topic: "orders", Partition: 1, Offset: 9},
+	} {
+		_, err = client.CommitOffset(ctx, req)
+		require.NoError(t, err)
+	}
+	for _, want := range []*api.CommitOffsetRequest{
+		{Group: "g", Offset: 4},
+		{Group: "g", Topic: "orders", Partition: 1, Offset: 2},
+		{Group: "h", Topic: "orders", Partition: 1, Offset: 9},
+	} {
+		res, err := client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{
+			Group:     want.Group,
+			Topic:     want.Topic,
+			Partition: want.Partition,
+		})
+		require.NoError(t, err)
+		require.Equal(t, want.Offset, res.Offset)
+	}
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Offset: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+/*
+그룹을 지정한 ConsumeStream은 그룹이 커밋한 오프셋부터 소비한다. 커밋한 적이 없는 그룹은 요청의 offset부터 소비한다.
+*/
+func testConsumeStreamGroup(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	for _, v := range []string{"first", "second", "third"} {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte(v)}})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Group: "g"})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), res.Record.Value)
+
+	// 첫 번째 레코드를 처리했으므로 다음에 읽을 오프셋을 커밋한다.
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g", Offset: res.Record.Offset + 1})
+	require.NoError(t, err)
+
+	// Offset은 무시하고 커밋한 위치부터 이어서 소비한다.
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{Group: "g", Offset: 0})
+	require.NoError(t, err)
+	for _, want := range []string{"second", "third"} {
+		res, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, []byte(want), res.Record.Value)
+	}
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Group: "g"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), consume.Record.Value)
+	consume, err = client.Consume(ctx, &api.ConsumeRequest{Group: "other", Offset: 2})
+	require.NoError(t, err)
+	require.Equal(t, []byte("third"), consume.Record.Value)
+}
+
+func testCommitUnknownPartition(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g", Topic: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g", Partition: 1})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func testUnauthorizedGroup(t *testing.T, _, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "g"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{""}})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "g", MemberId: "g-1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// 그룹에 참여한 후에 토픽에 대한 소비 권한을 잃은 멤버는 하트비트와 그룹 탈퇴도 할 수 없다.
+func testRevokedGroupMember(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Topic: &api.Topic{Name: "orders"}})
+	require.NoError(t, err)
+	a, err := client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{"orders"}})
+	require.NoError(t, err)
+
+	config.Authorizer.(*revocableAuthorizer).revoked.Store(true)
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "g", MemberId: a.MemberId})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "g", MemberId: a.MemberId})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// OffsetStore를 설정하지 않은 서버는 컨슈머 그룹 요청을 구현하지 않았다는 에러를 회신한다.
+func testGroupsUnimplemented(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g"})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Group: "g"})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{""}})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+/*
+두 멤버가 파티션이 네 개인 토픽을 구독하면 두 개씩 나눠 받는다. 두 번째 멤버가 들어와서 리밸런스한 후에는
+첫 번째 멤버가 이전 세대로 커밋할 수 없고, 하트비트로 새 세대와 할당을 받은 후에야 커밋할 수 있다.
+*/
+func testGroupMembership(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Topic: &api.Topic{Name: "orders", Partitions: 4}})
+	require.NoError(t, err)
+
+	a, err := client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{"orders"}})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(a.Assignments))
+	b, err := client.JoinGroup(ctx, &api.JoinGroupRequest{
+		Group:    "g",
+		Topics:   []string{"orders"},
+		Strategy: "range",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(b.Assignments))
+	require.Equal(t, a.Generation+1, b.Generation)
+
+	commit := &api.CommitOffsetRequest{
+		Group:      "g",
+		Topic:      "orders",
+		Partition:  a.Assignments[0].Partition,
+		Offset:     1,
+		MemberId:   a.MemberId,
+		Generation: a.Generation,
+	}
+	_, err = client.CommitOffset(ctx, commit)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	heartbeat, err := client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "g", MemberId: a.MemberId})
+	require.NoError(t, err)
+	require.Equal(t, b.Generation, heartbeat.Generation)
+	require.Equal(t, 2, len(heartbeat.Assignments))
+	commit.Partition = heartbeat.Assignments[0].Partition
+	commit.Generation = heartbeat.Generation
+	_, err = client.CommitOffset(ctx, commit)
+	require.NoError(t, err)
+
+	// 멤버가 있는 그룹에는 멤버가 아닌 커밋을 받지 않는다.
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "g", Topic: "orders"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "g", MemberId: b.MemberId})
+	require.NoError(t, err)
+	heartbeat, err = client.Heartbeat(ctx, &api.HeartbeatRequest{Group: "g", MemberId: a.MemberId})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(heartbeat.Assignments))
+
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{"missing"}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "g", Topics: []string{"orders"}, Strategy: "sticky"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+/*
+응답을 받지 못한 프로듀서가 같은 시퀀스로 다시 보내면 서버는 레코드를 다시 추가하지 않고 처음의 오프셋을 회신한다.
+시퀀스를 건너뛴 요청은 거부한다.
+*/
+func testIdempotentProduce(t *testing.T, client, nobody api.LogClient, config *Config) {
+	ctx := context.Background()
+	init, err := client.InitProducer(ctx, &api.InitProducerRequest{})
+	require.NoError(t, err)
+	require.NotZero(t, init.ProducerId)
+	_, err = nobody.InitProducer(ctx, &api.InitProducerRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.ProduceStream(ctx)
+	require.NoError(t, err)
+	for _, seq := range []uint64{0, 1, 1, 0} {
+		require.NoError(t, stream.Send(&api.ProduceRequest{
+			Record:     &api.Record{Value: []byte(fmt.Sprintf("record-%d", seq))},
+			ProducerId: init.ProducerId,
+			Sequence:   seq,
+		}))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, seq, res.Offset)
+	}
+
+	batch, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records:       []*api.Record{{Value: []byte("record-2")}, {Value: []byte("record-3")}},
+		ProducerId:    init.ProducerId,
+		FirstSequence: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), batch.FirstOffset)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record:     &api.Record{Value: []byte("record-5")},
+		ProducerId: init.ProducerId,
+		Sequence:   5,
+	})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	res, err := client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(res.Records))
+	for i, record := range res.Records {
+		require.Equal(t, fmt.Sprintf("record-%d", i), string(record.Value))
+		require.Equal(t, uint64(i), record.Sequence)
+	}
+}
+
+func testTransactions(t *testing.T, client, nobody api.LogClient, config *Config) {
+	ctx := context.Background()
+	outOfRange := status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
+	committed := api.IsolationLevel_READ_COMMITTED
+
+	_, err := nobody.BeginTxn(ctx, &api.BeginTxnRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Control: api.ControlType_CONTROL_COMMIT},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	begin, err := client.BeginTxn(ctx, &api.BeginTxnRequest{})
+	require.NoError(t, err)
+	txn := begin.Txn
+	for _, value := range []string{"first", "second"} {
+		_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte(value)}, Txn: txn})
+		require.NoError(t, err)
+	}
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("third")}})
+	require.NoError(t, err)
+
+	// read_uncommitted 소비자는 마커를 뺀 모든 레코드를 바로 받는다.
+	res, err := client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res.Records))
+	require.Equal(t, uint64(1), res.Records[0].Offset)
+	require.Equal(t, txn.Id, res.Records[0].TxnId)
+
+	// read_committed 소비자는 트랜잭션이 끝날 때까지 그 뒤의 레코드도 받지 못한다.
+	_, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{IsolationLevel: committed})
+	require.Equal(t, outOfRange, status.Code(err))
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{IsolationLevel: committed})
+	require.NoError(t, err)
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{Txn: txn})
+	require.NoError(t, err)
+	for _, value := range []string{"first", "second", "third"} {
+		recv, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, value, string(recv.Record.Value))
+	}
+
+	// 중단한 트랜잭션의 레코드는 read_committed 소비자에게 보이지 않는다.
+	begin, err = client.BeginTxn(ctx, &api.BeginTxnRequest{})
+	require.NoError(t, err)
+	_, err = client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records: []*api.Record{{Value: []byte("aborted")}, {Value: []byte("aborted")}},
+		Txn:     begin.Txn,
+	})
+	require.NoError(t, err)
+	_, err = client.AbortTxn(ctx, &api.AbortTxnRequest{Txn: begin.Txn})
+	require.NoError(t, err)
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{Txn: begin.Txn})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("fourth")}})
+	require.NoError(t, err)
+
+	recv, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "fourth", string(recv.Record.Value))
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 5, IsolationLevel: committed})
+	require.NoError(t, err)
+	require.Equal(t, "fourth", string(consume.Record.Value))
+}
+
+func testTopicTransaction(t *testing.T, client, _ api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Topic: &api.Topic{Name: "orders", Partitions: 3},
+	})
+	require.NoError(t, err)
+	_, err = client.BeginTxn(ctx, &api.BeginTxnRequest{Topic: "orders", Partition: 3})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	begin, err := client.BeginTxn(ctx, &api.BeginTxnRequest{Topic: "orders", Partition: 2})
+	require.NoError(t, err)
+	// 트랜잭션의 레코드는 키와 상관없이 트랜잭션의 파티션에 추가된다.
+	for _, key := range []string{"alice", "bob", "carol"} {
+		res, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Key: []byte(key), Value: []byte(key)},
+			Txn:    begin.Txn,
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), res.Partition)
+	}
+	committed := &api.ConsumeBatchRequest{Topic: "orders", Partition: 2, IsolationLevel: api.IsolationLevel_READ_COMMITTED}
+	_, err = client.ConsumeBatch(ctx, committed)
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{Txn: begin.Txn})
+	require.NoError(t, err)
+	res, err := client.ConsumeBatch(ctx, committed)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res.Records))
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	api "github.com/sodami-hub/proglog/api/v1"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+HTTP로 로그를 따라가는(tail) 엔드포인트. gRPC 스트리밍을 쓸 수 없는 브라우저의 도구들을 위해 ConsumeStream처럼 레코드를 보내고,
+로그의 끝까지 보낸 후에는 새 레코드가 추가될 때마다 보낸다.
+
+  - GET /v1/records/stream  Server-Sent Events(text/event-stream). 레코드마다 이벤트를 하나 보내고, 이벤트의 id는 레코드의 오프셋이다.
+    data는 레코드의 JSON이다. 브라우저의 EventSource는 연결이 끊기면 마지막으로 받은 id를 Last-Event-ID 헤더로 보내며 다시 연결하므로,
+    서버는 그 다음 오프셋부터 이어서 보낸다.
+  - GET /v1/records/ws      WebSocket. 레코드마다 ConsumeResponse의 JSON을 텍스트 메시지 하나로 보낸다.
+    다른 사이트의 페이지에서 연 연결은 Origin으로 거부한다(checkOrigin).
+
+쿼리 파라미터는 ConsumeRequest의 필드들(offset, start_time, group, topic, partition, isolation_level)이다.
+실제로 레코드를 읽는 일은 grpcServer.ConsumeStream이 하므로 시작 오프셋(그룹, 시각), 격리 수준, 권한 확인, 서버 종료(Shutdown)가 gRPC와 같다.
+
+ConsumeStream이 보내는 레코드는 연결마다 TailBuffer개의 버퍼에 넣고, 다른 고루틴이 버퍼에서 꺼내서 클라이언트에 쓴다.
+클라이언트가 느려서 버퍼가 차면 ConsumeStream을 기다리게 하지 않고 클라이언트의 연결을 끊는다(ResourceExhausted).
+스트림이 에러로 끝나면 SSE는 error 이벤트로, WebSocket은 google.rpc.Status의 JSON 메시지로 알리고 연결을 닫는다.
+*/
+
+// defaultTailBuffer는 Config.TailBuffer를 정하지 않았을 때 연결마다 쌓아둘 수 있는 레코드의 수이다.
+const defaultTailBuffer = 256
+
+// tailWriteTimeout은 클라이언트에 이벤트 하나를 쓰는 최대 시간이다. 읽지 않는 클라이언트에 쓰다가 핸들러가 멈춰있지 않게 한다.
+const tailWriteTimeout = 10 * time.Second
+
+// tailStream은 ConsumeStream이 보내는 레코드들을 버퍼(records)에 넣는 api.Log_ConsumeStreamServer이다.
+type tailStream struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	records chan *api.Record
+	// dropped는 버퍼가 차서 클라이언트를 끊을 때 닫힌다.
+	dropped chan struct{}
+	// err는 ConsumeStream의 결과이다. records가 닫힌 후에 읽는다.
+	err error
+}
+
+var _ api.Log_ConsumeStreamServer = (*tailStream)(nil)
+
+func (s *tailStream) Send(res *api.ConsumeResponse) error {
+	select {
+	case s.records <- res.Record:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	default:
+		// 에러를 리턴하면 ConsumeStream이 끝나므로 Send는 다시 호출되지 않는다.
+		close(s.dropped)
+		return status.Error(codes.ResourceExhausted, "client is too slow: send buffer is full")
+	}
+}
+
+func (s *tailStream) Context() context.Context     { return s.ctx }
+func (s *tailStream) SetHeader(metadata.MD) error  { return nil }
+func (s *tailStream) SendHeader(metadata.MD) error { return nil }
+func (s *tailStream) SetTrailer(metadata.MD)       {}
+func (s *tailStream) SendMsg(any) error            { return nil }
+func (s *tailStream) RecvMsg(any) error            { return nil }
+
+// tailRequest 함수는 게이트웨이처럼 쿼리 파라미터로 소비 요청을 만든다.
+func tailRequest(r *http.Request) (*api.ConsumeRequest, error) {
+	req := &api.ConsumeRequest{}
+	if err := runtime.PopulateQueryParameters(req, r.URL.Query(), utilities.NewDoubleArray(nil)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return req, nil
+}
+
+/*
+checkTail 메서드는 응답을 시작하기 전에 권한과 토픽의 파티션을 확인한다. SSE의 헤더를 보내거나 WebSocket으로 업그레이드한 후에는
+HTTP 상태 코드로 에러를 알릴 수 없으므로, 흔한 에러(403, 404)는 미리 확인한다. ConsumeStream이 다시 확인하지만 비용은 작다.
+*/
+func (s *httpServer) checkTail(ctx context.Context, req *api.ConsumeRequest) error {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, consumeAction); err != nil {
+		return err
+	}
+	_, err := s.consumeLog(req.Topic, req.Partition, req.IsolationLevel)
+	return err
+}
+
+// tail 메서드는 ConsumeStream을 시작한다. 스트림은 ctx를 취소하거나 forward가 끝나면 끝난다.
+func (s *httpServer) tail(ctx context.Context, req *api.ConsumeRequest) *tailStream {
+	size := s.TailBuffer
+	if size <= 0 {
+		size = defaultTailBuffer
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &tailStream{
+		ctx:     ctx,
+		cancel:  cancel,
+		records: make(chan *api.Record, size),
+		dropped: make(chan struct{}),
+	}
+	go func() {
+		stream.err = s.ConsumeStream(req, stream)
+		close(stream.records)
+	}()
+	return stream
+}
+
+/*
+forward 메서드는 버퍼의 레코드들을 send로 클라이언트에 쓰고, 스트림이 끝나면 클라이언트에 알릴 에러를 리턴한다.
+클라이언트가 떠났거나 쓰지 못했다면 알릴 수 없으므로 nil이다. 느린 클라이언트를 끊을 때는 버퍼에 남은 레코드를 쓰지 않는다.
+*/
+func (s *tailStream) forward(send func(*api.Record) error) error {
+	defer s.cancel()
+	for record := range s.records {
+		select {
+		case <-s.dropped:
+			s.discard()
+			return s.err
+		default:
+		}
+		if err := send(record); err != nil {
+			s.cancel()
+			s.discard()
+			return nil
+		}
+	}
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	return s.err
+}
+
+// discard 메서드는 ConsumeStream이 끝날 때까지 버퍼의 레코드들을 버린다.
+func (s *tailStream) discard() {
+	for range s.records {
+	}
+}
+
+// handleSSE 메서드는 로그를 Server-Sent Events로 따라간다. Last-Event-ID 헤더가 있으면 그 다음 오프셋부터 보낸다.
+func (s *httpServer) handleSSE(w http.ResponseWriter, r *http.Request) {
+	req, err := tailRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		last, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			writeError(w, status.Errorf(codes.InvalidArgument, "invalid Last-Event-ID: %q", id))
+			return
+		}
+		// 이어서 받는 것이므로 그룹이나 시각으로 시작 오프셋을 정하지 않는다.
+		req.Offset, req.StartTime, req.Group = last+1, nil, ""
+	}
+	if err = s.checkTail(r.Context(), req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	stream := s.tail(r.Context(), req)
+	// write 함수는 이벤트 하나를 쓴다.
+	write := func(event string) error {
+		rc.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+		if _, err := fmt.Fprint(w, event); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	err = stream.forward(func(record *api.Record) error {
+		b, err := marshaler.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return write(fmt.Sprintf("id: %d\ndata: %s\n\n", record.Offset, b))
+	})
+	if err != nil {
+		if b, merr := marshaler.Marshal(status.Convert(err).Proto()); merr == nil {
+			write(fmt.Sprintf("event: error\ndata: %s\n\n", b))
+		}
+	}
+}
+
+/*
+checkOrigin 함수는 WebSocket 핸드셰이크에서 요청의 Origin을 확인한다. 브라우저는 다른 사이트의 페이지에서도 WebSocket을 열 수 있고
+(같은 출처 정책을 따르지 않는다) 그 연결에도 사용자의 클라이언트 인증서를 보내므로, 확인하지 않으면 다른 사이트가 로그를 읽을 수 있다.
+  - Origin 헤더가 없다면 브라우저가 아닌 클라이언트이므로 허용한다.
+  - Origin의 호스트가 요청의 Host와 같다면(같은 서버가 제공한 페이지) 허용한다.
+  - 그 밖의 Origin은 거부한다. 핸드셰이크가 에러를 리턴하면 websocket.Server는 403 Forbidden으로 응답한다.
+*/
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && !strings.EqualFold(origin.Host, r.Host) {
+		return fmt.Errorf("cross-origin websocket from %s is not allowed", origin)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// handleWebSocket 메서드는 로그를 WebSocket으로 따라간다. 클라이언트가 보내는 메시지는 읽어서 버리고, 연결이 닫혔는지만 확인한다.
+func (s *httpServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	req, err := tailRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = s.checkTail(r.Context(), req); err != nil {
+		writeError(w, err)
+		return
+	}
+	websocket.Server{Handshake: checkOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		// 업그레이드한 연결은 서버에서 떼어내므로 요청의 콘텍스트는 연결이 끊겨도 취소되지 않는다. 읽기가 실패하면 끊긴 것이다.
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			defer cancel()
+			var discard []byte
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		}()
+
+		stream := s.tail(ctx, req)
+		send := func(m proto.Message) error {
+			b, err := marshaler.Marshal(m)
+			if err != nil {
+				return err
+			}
+			ws.SetWriteDeadline(time.Now().Add(tailWriteTimeout))
+			return websocket.Message.Send(ws, string(b))
+		}
+		err := stream.forward(func(record *api.Record) error {
+			return send(&api.ConsumeResponse{Record: record})
+		})
+		if err != nil {
+			send(status.Convert(err).Proto())
+		}
+	}}.ServeHTTP(w, r)
+}
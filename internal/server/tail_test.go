@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"github.com/sodami-hub/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestHTTPTail(t *testing.T) {
+	for scenario, fn := range map[string]func(t *testing.T, root, nobody *httpClient, clog *log.Log){
+		"server-sent events resume after Last-Event-ID": testTailSSE,
+		"websocket streams new records":                 testTailWebSocket,
+		"unauthorized clients are rejected":             testTailUnauthorized,
+		"cross-origin websockets are rejected":          testTailCrossOrigin,
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			root, nobody, clog, teardown := setupHTTPTest(t)
+			defer teardown()
+			fn(t, root, nobody, clog)
+		})
+	}
+}
+
+// sseEvent는 Server-Sent Events의 이벤트 하나이다.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent 함수는 빈 줄로 끝나는 이벤트 하나를 읽는다.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return e
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data = value
+		}
+	}
+}
+
+func appendValue(t *testing.T, clog *log.Log, value string) {
+	t.Helper()
+	_, err := clog.Append(&api.Record{Value: []byte(value)})
+	require.NoError(t, err)
+}
+
+func testTailSSE(t *testing.T, root, _ *httpClient, clog *log.Log) {
+	for _, v := range []string{"zero", "one", "two"} {
+		appendValue(t, clog, v)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, root.base+"/v1/records/stream", nil)
+	require.NoError(t, err)
+	// 0번 이벤트까지 받았던 클라이언트가 다시 연결했다.
+	req.Header.Set("Last-Event-ID", "0")
+	res, err := root.client.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(res.Body)
+	for i, want := range []string{"one", "two"} {
+		e := readEvent(t, r)
+		require.Equal(t, fmt.Sprint(i+1), e.id)
+		record := &api.Record{}
+		require.NoError(t, protojson.Unmarshal([]byte(e.data), record))
+		require.Equal(t, []byte(want), record.Value)
+	}
+
+	// 로그의 끝까지 보낸 후에는 새 레코드를 기다렸다가 보낸다.
+	appendValue(t, clog, "three")
+	e := readEvent(t, r)
+	require.Equal(t, "3", e.id)
+}
+
+func testTailWebSocket(t *testing.T, root, _ *httpClient, clog *log.Log) {
+	appendValue(t, clog, "zero")
+	config, err := websocket.NewConfig(
+		strings.Replace(root.base, "https", "wss", 1)+"/v1/records/ws?offset=0",
+		root.base,
+	)
+	require.NoError(t, err)
+	config.TlsConfig = root.tls
+	ws, err := websocket.DialConfig(config)
+	require.NoError(t, err)
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	receive := func() *api.Record {
+		t.Helper()
+		var msg string
+		require.NoError(t, websocket.Message.Receive(ws, &msg))
+		res := &api.ConsumeResponse{}
+		require.NoError(t, protojson.Unmarshal([]byte(msg), res))
+		return res.Record
+	}
+	require.Equal(t, []byte("zero"), receive().Value)
+	appendValue(t, clog, "one")
+	record := receive()
+	require.Equal(t, uint64(1), record.Offset)
+	require.Equal(t, []byte("one"), record.Value)
+}
+
+func testTailUnauthorized(t *testing.T, _, nobody *httpClient, _ *log.Log) {
+	// 응답을 시작하기 전에 권한을 확인하므로 보통의 HTTP 에러이다.
+	e := nobody.expectError(http.MethodGet, "/v1/records/stream", "", http.StatusForbidden)
+	require.Equal(t, int(codes.PermissionDenied), e.Code)
+	nobody.expectError(http.MethodGet, "/v1/records/ws", "", http.StatusForbidden)
+}
+
+func testTailCrossOrigin(t *testing.T, root, _ *httpClient, _ *log.Log) {
+	// upgrade 함수는 origin을 Origin 헤더로 보내며 WebSocket 핸드셰이크를 하고 응답의 상태 코드를 리턴한다.
+	upgrade := func(origin string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, root.base+"/v1/records/ws", nil)
+		require.NoError(t, err)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		res, err := root.client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// 다른 사이트의 페이지가 사용자의 인증서로 연결하는 경우이다.
+	require.Equal(t, http.StatusForbidden, upgrade("https://evil.example"))
+	// 같은 서버가 제공한 페이지와 Origin 헤더가 없는 브라우저가 아닌 클라이언트는 허용한다.
+	require.Equal(t, http.StatusSwitchingProtocols, upgrade(root.base))
+	require.Equal(t, http.StatusSwitchingProtocols, upgrade(""))
+}
+
+// 버퍼가 찬 느린 클라이언트는 ConsumeStream을 기다리게 하지 않고 끊는다. 버퍼에 남은 레코드는 쓰지 않는다.
+func TestTailStreamDropsSlowClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &tailStream{
+		ctx:     ctx,
+		cancel:  cancel,
+		records: make(chan *api.Record, 1),
+		dropped: make(chan struct{}),
+	}
+	require.NoError(t, stream.Send(&api.ConsumeResponse{Record: &api.Record{Offset: 0}}))
+	err := stream.Send(&api.ConsumeResponse{Record: &api.Record{Offset: 1}})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	stream.err = err
+	close(stream.records)
+
+	sent := 0
+	err = stream.forward(func(*api.Record) error {
+		sent++
+		return nil
+	})
+	require.Equal(t, 0, sent)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"math"
+
+	api "github.com/sodami-hub/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+트랜잭션은 한 토픽의 한 파티션에 여러 레코드를 원자적으로 추가한다.
+
+  - BeginTxn: 로그에 BEGIN 마커를 추가하고 트랜잭션(토픽, 파티션, ID)을 회신한다.
+  - Produce, ProduceBatch: 요청의 txn을 지정하면 레코드는 트랜잭션의 파티션에 트랜잭션 ID와 함께 추가된다.
+  - CommitTxn, AbortTxn: 로그에 COMMIT 또는 ABORT 마커를 추가해서 트랜잭션을 끝낸다.
+
+마커는 보통의 레코드처럼 CommitLog.Append로 추가하므로, DistributedLog라면 Raft로 복제되어 모든 노드의 로그가 같은 트랜잭션 상태를 가진다.
+트랜잭션의 상태(열린 트랜잭션, 중단한 트랜잭션)는 로그가 관리하고(log.Log), 서버는 상태를 따로 가지지 않는다.
+그래서 서버가 다시 시작하더라도 클라이언트는 가지고 있던 트랜잭션을 그대로 커밋하거나 중단할 수 있다.
+
+소비 요청의 isolation_level이 READ_COMMITTED라면 LSO 앞까지만 읽고 중단한 트랜잭션의 레코드를 건너뛴다.
+어느 격리 수준이든 제어 마커는 소비자에게 보내지 않는다.
+*/
+
+// TxnLog는 트랜잭션을 지원하는 로그이다. log.Log와 log.DistributedLog가 구현한다.
+// 구현하지 않은 로그는 트랜잭션이 없는 로그로 다루므로 모든 레코드가 커밋된 것이다.
+type TxnLog interface {
+	// LastStableOffset 메서드는 read_committed 소비자가 읽을 수 있는 마지막 오프셋의 다음 오프셋을 리턴한다.
+	LastStableOffset() uint64
+	Aborted(txnID uint64) bool
+	// WaitStable 메서드는 LastStableOffset이 off보다 커질 때까지 기다린다.
+	WaitStable(ctx context.Context, off uint64) error
+}
+
+// PartitionedTxnLog는 파티션마다 트랜잭션을 지원하는 로그이다. log.PartitionedLog가 구현한다.
+type PartitionedTxnLog interface {
+	LastStableOffsetPartition(p uint32) (uint64, error)
+	AbortedPartition(p uint32, txnID uint64) (bool, error)
+	WaitStablePartition(ctx context.Context, p uint32, off uint64) error
+}
+
+// BeginTxn 메서드는 토픽의 파티션에 새 트랜잭션을 시작한다. 트랜잭션 ID는 프로듀서 ID처럼 임의의 수이다. 생산 권한이 필요하다.
+func (s *grpcServer) BeginTxn(ctx context.Context, req *api.BeginTxnRequest) (*api.BeginTxnResponse, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return nil, err
+	}
+	clog, err := s.partition(req.Topic, req.Partition)
+	if err != nil {
+		return nil, err
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = clog.Append(&api.Record{TxnId: id, Control: api.ControlType_CONTROL_BEGIN}); err != nil {
+		return nil, err
+	}
+	return &api.BeginTxnResponse{
+		Txn: &api.Transaction{Topic: req.Topic, Partition: req.Partition, Id: id},
+	}, nil
+}
+
+func (s *grpcServer) CommitTxn(ctx context.Context, req *api.CommitTxnRequest) (*api.CommitTxnResponse, error) {
+	offset, err := s.endTxn(ctx, req.Txn, api.ControlType_CONTROL_COMMIT)
+	if err != nil {
+		return nil, err
+	}
+	return &api.CommitTxnResponse{Offset: offset}, nil
+}
+
+func (s *grpcServer) AbortTxn(ctx context.Context, req *api.AbortTxnRequest) (*api.AbortTxnResponse, error) {
+	offset, err := s.endTxn(ctx, req.Txn, api.ControlType_CONTROL_ABORT)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AbortTxnResponse{Offset: offset}, nil
+}
+
+// endTxn 메서드는 트랜잭션의 파티션에 COMMIT 또는 ABORT 마커를 추가하고 마커의 오프셋을 리턴한다.
+// 열려있지 않은 트랜잭션이라면 로그가 api.ErrInvalidTxn을 리턴한다.
+func (s *grpcServer) endTxn(ctx context.Context, txn *api.Transaction, control api.ControlType) (uint64, error) {
+	if err := s.Authorizer.Authorize(subject(ctx), objextWildcard, produceAction); err != nil {
+		return 0, err
+	}
+	if txn.GetId() == 0 {
+		return 0, status.Error(codes.InvalidArgument, "no transaction")
+	}
+	clog, err := s.partition(txn.Topic, txn.Partition)
+	if err != nil {
+		return 0, err
+	}
+	return clog.Append(&api.Record{TxnId: txn.Id, Control: control})
+}
+
+// txnTopic 함수는 생산 요청의 레코드를 추가할 토픽을 리턴한다. 트랜잭션으로 생산한다면 트랜잭션의 토픽이다.
+func txnTopic(topic string, txn *api.Transaction) string {
+	if txn != nil {
+		return txn.Topic
+	}
+	return topic
+}
+
+// checkControl 함수는 생산 요청의 레코드가 제어 마커가 아닌지 확인한다. 마커는 서버만 쓸 수 있다.
+func checkControl(record *api.Record) error {
+	if record.Control != api.ControlType_CONTROL_NONE {
+		return status.Error(codes.InvalidArgument, "control records are written by the server")
+	}
+	return nil
+}
+
+// consumeLog 메서드는 소비 요청의 토픽과 파티션을 요청의 격리 수준으로 읽는 로그를 리턴한다.
+func (s *grpcServer) consumeLog(topic string, p uint32, level api.IsolationLevel) (CommitLog, error) {
+	clog, err := s.partition(topic, p)
+	if err != nil {
+		return nil, err
+	}
+	return isolation{
+		partition: clog,
+		committed: level == api.IsolationLevel_READ_COMMITTED,
+	}, nil
+}
+
+/*
+isolation은 소비자에게 보낼 레코드만 읽는 파티션이다. 제어 마커는 건너뛰고, committed라면 LSO 앞까지만 읽으며
+중단한 트랜잭션의 레코드도 건너뛴다. LSO 앞의 트랜잭션은 모두 끝났으므로 중단하지 않은 트랜잭션의 레코드는 커밋된 것이다.
+*/
+type isolation struct {
+	partition
+	committed bool
+}
+
+// limit 메서드는 읽을 수 있는 마지막 오프셋의 다음 오프셋을 리턴한다.
+func (l isolation) limit() uint64 {
+	if !l.committed {
+		return math.MaxUint64
+	}
+	return l.LastStableOffset()
+}
+
+func (l isolation) visible(record *api.Record) bool {
+	if record.Control != api.ControlType_CONTROL_NONE {
+		return false
+	}
+	return !l.committed || record.TxnId == 0 || !l.Aborted(record.TxnId)
+}
+
+func (l isolation) Read(off uint64) (*api.Record, error) {
+	record, _, err := l.read(off)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	return record, err
+}
+
+// read 메서드는 off부터 보이는 첫 번째 레코드를 읽는다. 없다면 api.ErrOffsetOutOfRange와 함께 더 읽을 수 없게 된 오프셋(stop)을 리턴한다.
+func (l isolation) read(off uint64) (record *api.Record, stop uint64, err error) {
+	for {
+		limit := l.limit()
+		if off >= limit {
+			return nil, off, api.ErrOffsetOutOfRange{Offset: off}
+		}
+		record, err := l.partition.Read(off)
+		if err != nil {
+			return nil, off, err
+		}
+		if record.Offset >= limit {
+			return nil, limit, api.ErrOffsetOutOfRange{Offset: off}
+		}
+		if l.visible(record) {
+			return record, 0, nil
+		}
+		off = record.Offset + 1
+	}
+}
+
+func (l isolation) ReadRange(from uint64, maxRecords int, maxBytes uint64) ([]*api.Record, error) {
+	for {
+		limit := l.limit()
+		if from >= limit {
+			return nil, api.ErrOffsetOutOfRange{Offset: from}
+		}
+		records, err := l.partition.ReadRange(from, maxRecords, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, api.ErrOffsetOutOfRange{Offset: from}
+		}
+		var visible []*api.Record
+		stopped := false
+		for _, record := range records {
+			if record.Offset >= limit {
+				stopped = true
+				break
+			}
+			if l.visible(record) {
+				visible = append(visible, record)
+			}
+		}
+		if len(visible) > 0 {
+			return visible, nil
+		}
+		if stopped {
+			return nil, api.ErrOffsetOutOfRange{Offset: from}
+		}
+		// 읽은 레코드가 모두 보이지 않는 것이었다면 그 다음부터 다시 읽는다.
+		from = records[len(records)-1].Offset + 1
+	}
+}
+
+/*
+Wait 메서드는 off부터 보이는 레코드를 읽을 수 있을 때까지 기다린다. 마커나 중단한 트랜잭션의 레코드만 추가되었다면 계속 기다린다.
+기다린 후에도 같은 곳에서 멈춘다면 보존 정책 등으로 지워진 오프셋이므로 리턴해서 호출자가 읽다가 에러를 받게 한다.
+*/
+func (l isolation) Wait(ctx context.Context, off uint64) error {
+	waited := false
+	var last uint64
+	for {
+		_, stop, err := l.read(off)
+		if _, ok := err.(api.ErrOffsetOutOfRange); !ok {
+			return nil
+		}
+		if waited && stop == last {
+			return nil
+		}
+		if l.committed {
+			err = l.WaitStable(ctx, stop)
+		} else {
+			err = l.partition.Wait(ctx, stop)
+		}
+		if err != nil {
+			return err
+		}
+		waited, last = true, stop
+	}
+}
+
+func (l partition) LastStableOffset() uint64 {
+	tlog, ok := l.log.(PartitionedTxnLog)
+	if !ok {
+		return math.MaxUint64
+	}
+	// 파티션은 partition 메서드가 이미 확인했다.
+	off, _ := tlog.LastStableOffsetPartition(l.p)
+	return off
+}
+
+func (l partition) Aborted(txnID uint64) bool {
+	tlog, ok := l.log.(PartitionedTxnLog)
+	if !ok {
+		return false
+	}
+	aborted, _ := tlog.AbortedPartition(l.p, txnID)
+	return aborted
+}
+
+func (l partition) WaitStable(ctx context.Context, off uint64) error {
+	tlog, ok := l.log.(PartitionedTxnLog)
+	if !ok {
+		return l.Wait(ctx, off)
+	}
+	return tlog.WaitStablePartition(ctx, l.p, off)
+}
+
+func (l singlePartition) LastStableOffsetPartition(p uint32) (uint64, error) {
+	if p != 0 {
+		return 0, api.ErrPartitionNotFound{Partition: p}
+	}
+	if tlog, ok := l.CommitLog.(TxnLog); ok {
+		return tlog.LastStableOffset(), nil
+	}
+	return math.MaxUint64, nil
+}
+
+func (l singlePartition) AbortedPartition(p uint32, txnID uint64) (bool, error) {
+	if p != 0 {
+		return false, api.ErrPartitionNotFound{Partition: p}
+	}
+	if tlog, ok := l.CommitLog.(TxnLog); ok {
+		return tlog.Aborted(txnID), nil
+	}
+	return false, nil
+}
+
+func (l singlePartition) WaitStablePartition(ctx context.Context, p uint32, off uint64) error {
+	if p != 0 {
+		return api.ErrPartitionNotFound{Partition: p}
+	}
+	if tlog, ok := l.CommitLog.(TxnLog); ok {
+		return tlog.WaitStable(ctx, off)
+	}
+	return l.Wait(ctx, off)
+}